@@ -25,6 +25,198 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type ScaleMode int32
+
+const (
+	// preserve the aspect ratio, padding with black bars.
+	ScaleMode_FIT ScaleMode = 0
+	// preserve the aspect ratio, cropping the edges.
+	ScaleMode_FILL ScaleMode = 1
+	// ignore the aspect ratio.
+	ScaleMode_STRETCH ScaleMode = 2
+)
+
+// Enum value maps for ScaleMode.
+var (
+	ScaleMode_name = map[int32]string{
+		0: "FIT",
+		1: "FILL",
+		2: "STRETCH",
+	}
+	ScaleMode_value = map[string]int32{
+		"FIT":     0,
+		"FILL":    1,
+		"STRETCH": 2,
+	}
+)
+
+func (x ScaleMode) Enum() *ScaleMode {
+	p := new(ScaleMode)
+	*p = x
+	return p
+}
+
+func (x ScaleMode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ScaleMode) Descriptor() protoreflect.EnumDescriptor {
+	return file_transcoder_proto_enumTypes[0].Descriptor()
+}
+
+func (ScaleMode) Type() protoreflect.EnumType {
+	return &file_transcoder_proto_enumTypes[0]
+}
+
+func (x ScaleMode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ScaleMode.Descriptor instead.
+func (ScaleMode) EnumDescriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{0}
+}
+
+type TapDirection int32
+
+const (
+	// both the published and the transcoded packets.
+	TapDirection_BOTH TapDirection = 0
+	// the packets published to the server.
+	TapDirection_INPUT TapDirection = 1
+	// the packets sent to subscribers.
+	TapDirection_OUTPUT TapDirection = 2
+)
+
+// Enum value maps for TapDirection.
+var (
+	TapDirection_name = map[int32]string{
+		0: "BOTH",
+		1: "INPUT",
+		2: "OUTPUT",
+	}
+	TapDirection_value = map[string]int32{
+		"BOTH":   0,
+		"INPUT":  1,
+		"OUTPUT": 2,
+	}
+)
+
+func (x TapDirection) Enum() *TapDirection {
+	p := new(TapDirection)
+	*p = x
+	return p
+}
+
+func (x TapDirection) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TapDirection) Descriptor() protoreflect.EnumDescriptor {
+	return file_transcoder_proto_enumTypes[1].Descriptor()
+}
+
+func (TapDirection) Type() protoreflect.EnumType {
+	return &file_transcoder_proto_enumTypes[1]
+}
+
+func (x TapDirection) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TapDirection.Descriptor instead.
+func (TapDirection) EnumDescriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{1}
+}
+
+// a simulcast layer overrides the encoder parameters of the request for one rendition.
+type SimulcastLayer struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Rid        string  `protobuf:"bytes,1,opt,name=rid,proto3" json:"rid,omitempty"`
+	Width      uint32  `protobuf:"varint,2,opt,name=width,proto3" json:"width,omitempty"`
+	Height     uint32  `protobuf:"varint,3,opt,name=height,proto3" json:"height,omitempty"`
+	Bitrate    uint32  `protobuf:"varint,4,opt,name=bitrate,proto3" json:"bitrate,omitempty"`
+	MaxBitrate uint32  `protobuf:"varint,5,opt,name=max_bitrate,json=maxBitrate,proto3" json:"max_bitrate,omitempty"`
+	Framerate  float64 `protobuf:"fixed64,6,opt,name=framerate,proto3" json:"framerate,omitempty"`
+}
+
+func (x *SimulcastLayer) Reset() {
+	*x = SimulcastLayer{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transcoder_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SimulcastLayer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SimulcastLayer) ProtoMessage() {}
+
+func (x *SimulcastLayer) ProtoReflect() protoreflect.Message {
+	mi := &file_transcoder_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SimulcastLayer.ProtoReflect.Descriptor instead.
+func (*SimulcastLayer) Descriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SimulcastLayer) GetRid() string {
+	if x != nil {
+		return x.Rid
+	}
+	return ""
+}
+
+func (x *SimulcastLayer) GetWidth() uint32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *SimulcastLayer) GetHeight() uint32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *SimulcastLayer) GetBitrate() uint32 {
+	if x != nil {
+		return x.Bitrate
+	}
+	return 0
+}
+
+func (x *SimulcastLayer) GetMaxBitrate() uint32 {
+	if x != nil {
+		return x.MaxBitrate
+	}
+	return 0
+}
+
+func (x *SimulcastLayer) GetFramerate() float64 {
+	if x != nil {
+		return x.Framerate
+	}
+	return 0
+}
+
 type TranscodeRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -35,12 +227,23 @@ type TranscodeRequest struct {
 	RtpStreamId       string `protobuf:"bytes,3,opt,name=rtp_stream_id,json=rtpStreamId,proto3" json:"rtp_stream_id,omitempty"`
 	MimeType          string `protobuf:"bytes,4,opt,name=mime_type,json=mimeType,proto3" json:"mime_type,omitempty"`
 	GstreamerPipeline string `protobuf:"bytes,5,opt,name=gstreamer_pipeline,json=gstreamerPipeline,proto3" json:"gstreamer_pipeline,omitempty"`
+	// encoder parameters, zero values use the encoder defaults.
+	Bitrate          uint32    `protobuf:"varint,6,opt,name=bitrate,proto3" json:"bitrate,omitempty"`
+	MaxBitrate       uint32    `protobuf:"varint,7,opt,name=max_bitrate,json=maxBitrate,proto3" json:"max_bitrate,omitempty"`
+	Width            uint32    `protobuf:"varint,8,opt,name=width,proto3" json:"width,omitempty"`
+	Height           uint32    `protobuf:"varint,9,opt,name=height,proto3" json:"height,omitempty"`
+	Framerate        float64   `protobuf:"fixed64,10,opt,name=framerate,proto3" json:"framerate,omitempty"`
+	KeyframeInterval uint32    `protobuf:"varint,11,opt,name=keyframe_interval,json=keyframeInterval,proto3" json:"keyframe_interval,omitempty"`
+	Profile          string    `protobuf:"bytes,12,opt,name=profile,proto3" json:"profile,omitempty"`
+	ScaleMode        ScaleMode `protobuf:"varint,13,opt,name=scale_mode,json=scaleMode,proto3,enum=api.ScaleMode" json:"scale_mode,omitempty"`
+	// if set, the track is published as simulcast with one encoding per layer.
+	Layers []*SimulcastLayer `protobuf:"bytes,14,rep,name=layers,proto3" json:"layers,omitempty"`
 }
 
 func (x *TranscodeRequest) Reset() {
 	*x = TranscodeRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_transcoder_proto_msgTypes[0]
+		mi := &file_transcoder_proto_msgTypes[1]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -53,7 +256,7 @@ func (x *TranscodeRequest) String() string {
 func (*TranscodeRequest) ProtoMessage() {}
 
 func (x *TranscodeRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_transcoder_proto_msgTypes[0]
+	mi := &file_transcoder_proto_msgTypes[1]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -66,7 +269,7 @@ func (x *TranscodeRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TranscodeRequest.ProtoReflect.Descriptor instead.
 func (*TranscodeRequest) Descriptor() ([]byte, []int) {
-	return file_transcoder_proto_rawDescGZIP(), []int{0}
+	return file_transcoder_proto_rawDescGZIP(), []int{1}
 }
 
 func (x *TranscodeRequest) GetStreamId() string {
@@ -104,6 +307,69 @@ func (x *TranscodeRequest) GetGstreamerPipeline() string {
 	return ""
 }
 
+func (x *TranscodeRequest) GetBitrate() uint32 {
+	if x != nil {
+		return x.Bitrate
+	}
+	return 0
+}
+
+func (x *TranscodeRequest) GetMaxBitrate() uint32 {
+	if x != nil {
+		return x.MaxBitrate
+	}
+	return 0
+}
+
+func (x *TranscodeRequest) GetWidth() uint32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *TranscodeRequest) GetHeight() uint32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *TranscodeRequest) GetFramerate() float64 {
+	if x != nil {
+		return x.Framerate
+	}
+	return 0
+}
+
+func (x *TranscodeRequest) GetKeyframeInterval() uint32 {
+	if x != nil {
+		return x.KeyframeInterval
+	}
+	return 0
+}
+
+func (x *TranscodeRequest) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+func (x *TranscodeRequest) GetScaleMode() ScaleMode {
+	if x != nil {
+		return x.ScaleMode
+	}
+	return ScaleMode_FIT
+}
+
+func (x *TranscodeRequest) GetLayers() []*SimulcastLayer {
+	if x != nil {
+		return x.Layers
+	}
+	return nil
+}
+
 type SubscribeRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -118,7 +384,7 @@ type SubscribeRequest struct {
 func (x *SubscribeRequest) Reset() {
 	*x = SubscribeRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_transcoder_proto_msgTypes[1]
+		mi := &file_transcoder_proto_msgTypes[2]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -131,7 +397,7 @@ func (x *SubscribeRequest) String() string {
 func (*SubscribeRequest) ProtoMessage() {}
 
 func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_transcoder_proto_msgTypes[1]
+	mi := &file_transcoder_proto_msgTypes[2]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -144,7 +410,7 @@ func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
 func (*SubscribeRequest) Descriptor() ([]byte, []int) {
-	return file_transcoder_proto_rawDescGZIP(), []int{1}
+	return file_transcoder_proto_rawDescGZIP(), []int{2}
 }
 
 func (m *SubscribeRequest) GetOperation() isSubscribeRequest_Operation {
@@ -184,86 +450,1108 @@ func (*SubscribeRequest_Request) isSubscribeRequest_Operation() {}
 
 func (*SubscribeRequest_Signal) isSubscribeRequest_Operation() {}
 
-var File_transcoder_proto protoreflect.FileDescriptor
+type TapRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
 
-var file_transcoder_proto_rawDesc = []byte{
-	0x0a, 0x10, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x63, 0x6f, 0x64, 0x65, 0x72, 0x2e, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x12, 0x03, 0x61, 0x70, 0x69, 0x1a, 0x19, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x61, 0x6e, 0x79, 0x2e, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x22, 0xba, 0x01, 0x0a, 0x10, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x63, 0x6f, 0x64, 0x65,
-	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x73, 0x74, 0x72, 0x65, 0x61,
-	0x6d, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x73, 0x74, 0x72, 0x65,
-	0x61, 0x6d, 0x49, 0x64, 0x12, 0x19, 0x0a, 0x08, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x5f, 0x69, 0x64,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x49, 0x64, 0x12,
-	0x22, 0x0a, 0x0d, 0x72, 0x74, 0x70, 0x5f, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x5f, 0x69, 0x64,
-	0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x72, 0x74, 0x70, 0x53, 0x74, 0x72, 0x65, 0x61,
-	0x6d, 0x49, 0x64, 0x12, 0x1b, 0x0a, 0x09, 0x6d, 0x69, 0x6d, 0x65, 0x5f, 0x74, 0x79, 0x70, 0x65,
-	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6d, 0x69, 0x6d, 0x65, 0x54, 0x79, 0x70, 0x65,
-	0x12, 0x2d, 0x0a, 0x12, 0x67, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x65, 0x72, 0x5f, 0x70, 0x69,
-	0x70, 0x65, 0x6c, 0x69, 0x6e, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x11, 0x67, 0x73,
-	0x74, 0x72, 0x65, 0x61, 0x6d, 0x65, 0x72, 0x50, 0x69, 0x70, 0x65, 0x6c, 0x69, 0x6e, 0x65, 0x22,
-	0x82, 0x01, 0x0a, 0x10, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x52, 0x65, 0x71,
-	0x75, 0x65, 0x73, 0x74, 0x12, 0x31, 0x0a, 0x07, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x54, 0x72, 0x61, 0x6e,
-	0x73, 0x63, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x48, 0x00, 0x52, 0x07,
-	0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2e, 0x0a, 0x06, 0x73, 0x69, 0x67, 0x6e, 0x61,
-	0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
-	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x41, 0x6e, 0x79, 0x48, 0x00, 0x52,
-	0x06, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x42, 0x0b, 0x0a, 0x09, 0x6f, 0x70, 0x65, 0x72, 0x61,
-	0x74, 0x69, 0x6f, 0x6e, 0x32, 0x89, 0x01, 0x0a, 0x0a, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x63, 0x6f,
-	0x64, 0x65, 0x72, 0x12, 0x3b, 0x0a, 0x07, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x73, 0x68, 0x12, 0x14,
-	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
-	0x2e, 0x41, 0x6e, 0x79, 0x1a, 0x14, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
-	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x41, 0x6e, 0x79, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01,
-	0x12, 0x3e, 0x0a, 0x09, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x12, 0x15, 0x2e,
-	0x61, 0x70, 0x69, 0x2e, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x52, 0x65, 0x71,
-	0x75, 0x65, 0x73, 0x74, 0x1a, 0x14, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
-	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x41, 0x6e, 0x79, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01,
-	0x42, 0x23, 0x5a, 0x21, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6d,
-	0x75, 0x78, 0x61, 0x62, 0x6c, 0x65, 0x2f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x63, 0x6f, 0x64, 0x65,
-	0x72, 0x2f, 0x61, 0x70, 0x69, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	// empty values match any track.
+	StreamId    string       `protobuf:"bytes,1,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	TrackId     string       `protobuf:"bytes,2,opt,name=track_id,json=trackId,proto3" json:"track_id,omitempty"`
+	RtpStreamId string       `protobuf:"bytes,3,opt,name=rtp_stream_id,json=rtpStreamId,proto3" json:"rtp_stream_id,omitempty"`
+	Direction   TapDirection `protobuf:"varint,4,opt,name=direction,proto3,enum=api.TapDirection" json:"direction,omitempty"`
+	// if no destination is set, the packets are streamed back to the caller.
+	//
+	// Types that are assignable to Destination:
+	//	*TapRequest_UdpAddress
+	//	*TapRequest_PcapPath
+	Destination isTapRequest_Destination `protobuf_oneof:"destination"`
 }
 
-var (
-	file_transcoder_proto_rawDescOnce sync.Once
-	file_transcoder_proto_rawDescData = file_transcoder_proto_rawDesc
-)
+func (x *TapRequest) Reset() {
+	*x = TapRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transcoder_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
 
-func file_transcoder_proto_rawDescGZIP() []byte {
-	file_transcoder_proto_rawDescOnce.Do(func() {
-		file_transcoder_proto_rawDescData = protoimpl.X.CompressGZIP(file_transcoder_proto_rawDescData)
-	})
-	return file_transcoder_proto_rawDescData
+func (x *TapRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-var file_transcoder_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
-var file_transcoder_proto_goTypes = []interface{}{
-	(*TranscodeRequest)(nil), // 0: api.TranscodeRequest
-	(*SubscribeRequest)(nil), // 1: api.SubscribeRequest
-	(*anypb.Any)(nil),        // 2: google.protobuf.Any
+func (*TapRequest) ProtoMessage() {}
+
+func (x *TapRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_transcoder_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
 }
-var file_transcoder_proto_depIdxs = []int32{
-	0, // 0: api.SubscribeRequest.request:type_name -> api.TranscodeRequest
-	2, // 1: api.SubscribeRequest.signal:type_name -> google.protobuf.Any
-	2, // 2: api.Transcoder.Publish:input_type -> google.protobuf.Any
-	1, // 3: api.Transcoder.Subscribe:input_type -> api.SubscribeRequest
-	2, // 4: api.Transcoder.Publish:output_type -> google.protobuf.Any
-	2, // 5: api.Transcoder.Subscribe:output_type -> google.protobuf.Any
-	4, // [4:6] is the sub-list for method output_type
-	2, // [2:4] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+
+// Deprecated: Use TapRequest.ProtoReflect.Descriptor instead.
+func (*TapRequest) Descriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{3}
 }
 
-func init() { file_transcoder_proto_init() }
-func file_transcoder_proto_init() {
-	if File_transcoder_proto != nil {
-		return
+func (x *TapRequest) GetStreamId() string {
+	if x != nil {
+		return x.StreamId
 	}
-	if !protoimpl.UnsafeEnabled {
-		file_transcoder_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*TranscodeRequest); i {
+	return ""
+}
+
+func (x *TapRequest) GetTrackId() string {
+	if x != nil {
+		return x.TrackId
+	}
+	return ""
+}
+
+func (x *TapRequest) GetRtpStreamId() string {
+	if x != nil {
+		return x.RtpStreamId
+	}
+	return ""
+}
+
+func (x *TapRequest) GetDirection() TapDirection {
+	if x != nil {
+		return x.Direction
+	}
+	return TapDirection_BOTH
+}
+
+func (m *TapRequest) GetDestination() isTapRequest_Destination {
+	if m != nil {
+		return m.Destination
+	}
+	return nil
+}
+
+func (x *TapRequest) GetUdpAddress() string {
+	if x, ok := x.GetDestination().(*TapRequest_UdpAddress); ok {
+		return x.UdpAddress
+	}
+	return ""
+}
+
+func (x *TapRequest) GetPcapPath() string {
+	if x, ok := x.GetDestination().(*TapRequest_PcapPath); ok {
+		return x.PcapPath
+	}
+	return ""
+}
+
+type isTapRequest_Destination interface {
+	isTapRequest_Destination()
+}
+
+type TapRequest_UdpAddress struct {
+	UdpAddress string `protobuf:"bytes,5,opt,name=udp_address,json=udpAddress,proto3,oneof"`
+}
+
+type TapRequest_PcapPath struct {
+	// pcap_path is relative to the server's tap directory.
+	PcapPath string `protobuf:"bytes,6,opt,name=pcap_path,json=pcapPath,proto3,oneof"`
+}
+
+func (*TapRequest_UdpAddress) isTapRequest_Destination() {}
+
+func (*TapRequest_PcapPath) isTapRequest_Destination() {}
+
+type TapPacket struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Rtp       []byte       `protobuf:"bytes,1,opt,name=rtp,proto3" json:"rtp,omitempty"`
+	Direction TapDirection `protobuf:"varint,2,opt,name=direction,proto3,enum=api.TapDirection" json:"direction,omitempty"`
+}
+
+func (x *TapPacket) Reset() {
+	*x = TapPacket{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transcoder_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TapPacket) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TapPacket) ProtoMessage() {}
+
+func (x *TapPacket) ProtoReflect() protoreflect.Message {
+	mi := &file_transcoder_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TapPacket.ProtoReflect.Descriptor instead.
+func (*TapPacket) Descriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *TapPacket) GetRtp() []byte {
+	if x != nil {
+		return x.Rtp
+	}
+	return nil
+}
+
+func (x *TapPacket) GetDirection() TapDirection {
+	if x != nil {
+		return x.Direction
+	}
+	return TapDirection_BOTH
+}
+
+type RecordRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// the track to record and the encoder parameters. if mime_type is empty, the track is recorded as it
+	// was published.
+	Track *TranscodeRequest `protobuf:"bytes,1,opt,name=track,proto3" json:"track,omitempty"`
+	// more tracks to record into the same files, for example the audio of a video track. the tracks are
+	// synchronized with the sender reports of their publishers.
+	Tracks []*TranscodeRequest `protobuf:"bytes,5,rep,name=tracks,proto3" json:"tracks,omitempty"`
+	// the file name relative to the recording directory. the container is guessed from the extension,
+	// for example .webm, .mp4 or .mkv. segments are numbered by replacing %d in the name, or with a
+	// suffix if there's none. no other % is allowed.
+	Path string `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	// a new file is started at the first keyframe after either limit, zero values disable the limit.
+	SegmentDurationSeconds uint32 `protobuf:"varint,3,opt,name=segment_duration_seconds,json=segmentDurationSeconds,proto3" json:"segment_duration_seconds,omitempty"`
+	SegmentSizeBytes       uint64 `protobuf:"varint,4,opt,name=segment_size_bytes,json=segmentSizeBytes,proto3" json:"segment_size_bytes,omitempty"`
+}
+
+func (x *RecordRequest) Reset() {
+	*x = RecordRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transcoder_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RecordRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecordRequest) ProtoMessage() {}
+
+func (x *RecordRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_transcoder_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecordRequest.ProtoReflect.Descriptor instead.
+func (*RecordRequest) Descriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *RecordRequest) GetTrack() *TranscodeRequest {
+	if x != nil {
+		return x.Track
+	}
+	return nil
+}
+
+func (x *RecordRequest) GetTracks() []*TranscodeRequest {
+	if x != nil {
+		return x.Tracks
+	}
+	return nil
+}
+
+func (x *RecordRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *RecordRequest) GetSegmentDurationSeconds() uint32 {
+	if x != nil {
+		return x.SegmentDurationSeconds
+	}
+	return 0
+}
+
+func (x *RecordRequest) GetSegmentSizeBytes() uint64 {
+	if x != nil {
+		return x.SegmentSizeBytes
+	}
+	return 0
+}
+
+type RecordedFile struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// the path relative to the recording directory.
+	Path            string  `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	DurationSeconds float64 `protobuf:"fixed64,2,opt,name=duration_seconds,json=durationSeconds,proto3" json:"duration_seconds,omitempty"`
+	SizeBytes       uint64  `protobuf:"varint,3,opt,name=size_bytes,json=sizeBytes,proto3" json:"size_bytes,omitempty"`
+}
+
+func (x *RecordedFile) Reset() {
+	*x = RecordedFile{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transcoder_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RecordedFile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecordedFile) ProtoMessage() {}
+
+func (x *RecordedFile) ProtoReflect() protoreflect.Message {
+	mi := &file_transcoder_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecordedFile.ProtoReflect.Descriptor instead.
+func (*RecordedFile) Descriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *RecordedFile) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *RecordedFile) GetDurationSeconds() float64 {
+	if x != nil {
+		return x.DurationSeconds
+	}
+	return 0
+}
+
+func (x *RecordedFile) GetSizeBytes() uint64 {
+	if x != nil {
+		return x.SizeBytes
+	}
+	return 0
+}
+
+type SRTOptions struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// the receiver's buffering latency, zero uses the srt default of 120ms.
+	LatencyMs uint32 `protobuf:"varint,1,opt,name=latency_ms,json=latencyMs,proto3" json:"latency_ms,omitempty"`
+	// encrypts the stream if set, it must be 10 to 79 characters long.
+	Passphrase string `protobuf:"bytes,2,opt,name=passphrase,proto3" json:"passphrase,omitempty"`
+	// identifies the stream to the listener.
+	StreamId string `protobuf:"bytes,3,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+}
+
+func (x *SRTOptions) Reset() {
+	*x = SRTOptions{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transcoder_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SRTOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SRTOptions) ProtoMessage() {}
+
+func (x *SRTOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_transcoder_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SRTOptions.ProtoReflect.Descriptor instead.
+func (*SRTOptions) Descriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SRTOptions) GetLatencyMs() uint32 {
+	if x != nil {
+		return x.LatencyMs
+	}
+	return 0
+}
+
+func (x *SRTOptions) GetPassphrase() string {
+	if x != nil {
+		return x.Passphrase
+	}
+	return ""
+}
+
+func (x *SRTOptions) GetStreamId() string {
+	if x != nil {
+		return x.StreamId
+	}
+	return ""
+}
+
+type PushSRTRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// the tracks to push and their encoder parameters, synchronized with the sender reports of their
+	// publishers. if mime_type is empty, a track is pushed as it was published. mpeg-ts supports
+	// video/H264, video/H265, audio/AAC and audio/opus.
+	Tracks []*TranscodeRequest `protobuf:"bytes,1,rep,name=tracks,proto3" json:"tracks,omitempty"`
+	// the address of the srt listener, as host:port.
+	Address string      `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	Options *SRTOptions `protobuf:"bytes,3,opt,name=options,proto3" json:"options,omitempty"`
+}
+
+func (x *PushSRTRequest) Reset() {
+	*x = PushSRTRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transcoder_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PushSRTRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushSRTRequest) ProtoMessage() {}
+
+func (x *PushSRTRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_transcoder_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushSRTRequest.ProtoReflect.Descriptor instead.
+func (*PushSRTRequest) Descriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PushSRTRequest) GetTracks() []*TranscodeRequest {
+	if x != nil {
+		return x.Tracks
+	}
+	return nil
+}
+
+func (x *PushSRTRequest) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *PushSRTRequest) GetOptions() *SRTOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type PushSRTResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *PushSRTResponse) Reset() {
+	*x = PushSRTResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transcoder_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PushSRTResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushSRTResponse) ProtoMessage() {}
+
+func (x *PushSRTResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_transcoder_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushSRTResponse.ProtoReflect.Descriptor instead.
+func (*PushSRTResponse) Descriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{9}
+}
+
+type PublishRTPRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// describes the rtp streams, each media section is published as a track named by its mid or, if it
+	// has none, its media type. only the first payload type of a section is received.
+	Sdp string `protobuf:"bytes,1,opt,name=sdp,proto3" json:"sdp,omitempty"`
+	// the stream id of the tracks, the call fails with ALREADY_EXISTS if it is already publishing.
+	StreamId string `protobuf:"bytes,2,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+}
+
+func (x *PublishRTPRequest) Reset() {
+	*x = PublishRTPRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transcoder_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PublishRTPRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishRTPRequest) ProtoMessage() {}
+
+func (x *PublishRTPRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_transcoder_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishRTPRequest.ProtoReflect.Descriptor instead.
+func (*PublishRTPRequest) Descriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *PublishRTPRequest) GetSdp() string {
+	if x != nil {
+		return x.Sdp
+	}
+	return ""
+}
+
+func (x *PublishRTPRequest) GetStreamId() string {
+	if x != nil {
+		return x.StreamId
+	}
+	return ""
+}
+
+type PublishRTPResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// the request sdp with the server's address and ports, the sender sends each stream there.
+	Sdp string `protobuf:"bytes,1,opt,name=sdp,proto3" json:"sdp,omitempty"`
+	// the rtp port of each media section, rtcp is received on the next port.
+	Ports []uint32 `protobuf:"varint,2,rep,packed,name=ports,proto3" json:"ports,omitempty"`
+}
+
+func (x *PublishRTPResponse) Reset() {
+	*x = PublishRTPResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transcoder_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PublishRTPResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishRTPResponse) ProtoMessage() {}
+
+func (x *PublishRTPResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_transcoder_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishRTPResponse.ProtoReflect.Descriptor instead.
+func (*PublishRTPResponse) Descriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *PublishRTPResponse) GetSdp() string {
+	if x != nil {
+		return x.Sdp
+	}
+	return ""
+}
+
+func (x *PublishRTPResponse) GetPorts() []uint32 {
+	if x != nil {
+		return x.Ports
+	}
+	return nil
+}
+
+type SRTPKeys struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// the protection profile: AES_CM_128_HMAC_SHA1_80, AES_CM_128_HMAC_SHA1_32 or AEAD_AES_128_GCM.
+	// defaults to AES_CM_128_HMAC_SHA1_80.
+	Profile string `protobuf:"bytes,1,opt,name=profile,proto3" json:"profile,omitempty"`
+	// 16 bytes for every profile.
+	MasterKey []byte `protobuf:"bytes,2,opt,name=master_key,json=masterKey,proto3" json:"master_key,omitempty"`
+	// 14 bytes for the AES_CM profiles, 12 bytes for AEAD_AES_128_GCM.
+	MasterSalt []byte `protobuf:"bytes,3,opt,name=master_salt,json=masterSalt,proto3" json:"master_salt,omitempty"`
+}
+
+func (x *SRTPKeys) Reset() {
+	*x = SRTPKeys{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transcoder_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SRTPKeys) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SRTPKeys) ProtoMessage() {}
+
+func (x *SRTPKeys) ProtoReflect() protoreflect.Message {
+	mi := &file_transcoder_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SRTPKeys.ProtoReflect.Descriptor instead.
+func (*SRTPKeys) Descriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *SRTPKeys) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+func (x *SRTPKeys) GetMasterKey() []byte {
+	if x != nil {
+		return x.MasterKey
+	}
+	return nil
+}
+
+func (x *SRTPKeys) GetMasterSalt() []byte {
+	if x != nil {
+		return x.MasterSalt
+	}
+	return nil
+}
+
+type SubscribeRTPRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// the track and its encoder parameters, simulcast layers aren't supported.
+	Track *TranscodeRequest `protobuf:"bytes,1,opt,name=track,proto3" json:"track,omitempty"`
+	// where the rtp is sent, as host:port.
+	Address string `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	// encrypts the stream with srtp if set.
+	Srtp *SRTPKeys `protobuf:"bytes,3,opt,name=srtp,proto3" json:"srtp,omitempty"`
+}
+
+func (x *SubscribeRTPRequest) Reset() {
+	*x = SubscribeRTPRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transcoder_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubscribeRTPRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRTPRequest) ProtoMessage() {}
+
+func (x *SubscribeRTPRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_transcoder_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRTPRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRTPRequest) Descriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *SubscribeRTPRequest) GetTrack() *TranscodeRequest {
+	if x != nil {
+		return x.Track
+	}
+	return nil
+}
+
+func (x *SubscribeRTPRequest) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *SubscribeRTPRequest) GetSrtp() *SRTPKeys {
+	if x != nil {
+		return x.Srtp
+	}
+	return nil
+}
+
+type SubscribeRTPResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// describes the stream, including the srtp keys as a crypto attribute.
+	Sdp string `protobuf:"bytes,1,opt,name=sdp,proto3" json:"sdp,omitempty"`
+}
+
+func (x *SubscribeRTPResponse) Reset() {
+	*x = SubscribeRTPResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transcoder_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubscribeRTPResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRTPResponse) ProtoMessage() {}
+
+func (x *SubscribeRTPResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_transcoder_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRTPResponse.ProtoReflect.Descriptor instead.
+func (*SubscribeRTPResponse) Descriptor() ([]byte, []int) {
+	return file_transcoder_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *SubscribeRTPResponse) GetSdp() string {
+	if x != nil {
+		return x.Sdp
+	}
+	return ""
+}
+
+var File_transcoder_proto protoreflect.FileDescriptor
+
+var file_transcoder_proto_rawDesc = []byte{
+	0x0a, 0x10, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x63, 0x6f, 0x64, 0x65, 0x72, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x12, 0x03, 0x61, 0x70, 0x69, 0x1a, 0x19, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x61, 0x6e, 0x79, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x22, 0xa9, 0x01, 0x0a, 0x0e, 0x53, 0x69, 0x6d, 0x75, 0x6c, 0x63, 0x61, 0x73, 0x74,
+	0x4c, 0x61, 0x79, 0x65, 0x72, 0x12, 0x10, 0x0a, 0x03, 0x72, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x03, 0x72, 0x69, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x77, 0x69, 0x64, 0x74, 0x68,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x77, 0x69, 0x64, 0x74, 0x68, 0x12, 0x16, 0x0a,
+	0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x68,
+	0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x62, 0x69, 0x74, 0x72, 0x61, 0x74, 0x65,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x62, 0x69, 0x74, 0x72, 0x61, 0x74, 0x65, 0x12,
+	0x1f, 0x0a, 0x0b, 0x6d, 0x61, 0x78, 0x5f, 0x62, 0x69, 0x74, 0x72, 0x61, 0x74, 0x65, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a, 0x6d, 0x61, 0x78, 0x42, 0x69, 0x74, 0x72, 0x61, 0x74, 0x65,
+	0x12, 0x1c, 0x0a, 0x09, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x72, 0x61, 0x74, 0x65, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x01, 0x52, 0x09, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x72, 0x61, 0x74, 0x65, 0x22, 0xe4,
+	0x03, 0x0a, 0x10, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x63, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x5f, 0x69, 0x64,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x49, 0x64,
+	0x12, 0x19, 0x0a, 0x08, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x07, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x49, 0x64, 0x12, 0x22, 0x0a, 0x0d, 0x72,
+	0x74, 0x70, 0x5f, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0b, 0x72, 0x74, 0x70, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x49, 0x64, 0x12,
+	0x1b, 0x0a, 0x09, 0x6d, 0x69, 0x6d, 0x65, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x6d, 0x69, 0x6d, 0x65, 0x54, 0x79, 0x70, 0x65, 0x12, 0x2d, 0x0a, 0x12,
+	0x67, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x65, 0x72, 0x5f, 0x70, 0x69, 0x70, 0x65, 0x6c, 0x69,
+	0x6e, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x11, 0x67, 0x73, 0x74, 0x72, 0x65, 0x61,
+	0x6d, 0x65, 0x72, 0x50, 0x69, 0x70, 0x65, 0x6c, 0x69, 0x6e, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x62,
+	0x69, 0x74, 0x72, 0x61, 0x74, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x62, 0x69,
+	0x74, 0x72, 0x61, 0x74, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x6d, 0x61, 0x78, 0x5f, 0x62, 0x69, 0x74,
+	0x72, 0x61, 0x74, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a, 0x6d, 0x61, 0x78, 0x42,
+	0x69, 0x74, 0x72, 0x61, 0x74, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x77, 0x69, 0x64, 0x74, 0x68, 0x18,
+	0x08, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x77, 0x69, 0x64, 0x74, 0x68, 0x12, 0x16, 0x0a, 0x06,
+	0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x68, 0x65,
+	0x69, 0x67, 0x68, 0x74, 0x12, 0x1c, 0x0a, 0x09, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x72, 0x61, 0x74,
+	0x65, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x01, 0x52, 0x09, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x72, 0x61,
+	0x74, 0x65, 0x12, 0x2b, 0x0a, 0x11, 0x6b, 0x65, 0x79, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x5f, 0x69,
+	0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x10, 0x6b,
+	0x65, 0x79, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x12,
+	0x18, 0x0a, 0x07, 0x70, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x07, 0x70, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65, 0x12, 0x2d, 0x0a, 0x0a, 0x73, 0x63, 0x61,
+	0x6c, 0x65, 0x5f, 0x6d, 0x6f, 0x64, 0x65, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0e, 0x2e,
+	0x61, 0x70, 0x69, 0x2e, 0x53, 0x63, 0x61, 0x6c, 0x65, 0x4d, 0x6f, 0x64, 0x65, 0x52, 0x09, 0x73,
+	0x63, 0x61, 0x6c, 0x65, 0x4d, 0x6f, 0x64, 0x65, 0x12, 0x2b, 0x0a, 0x06, 0x6c, 0x61, 0x79, 0x65,
+	0x72, 0x73, 0x18, 0x0e, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x53,
+	0x69, 0x6d, 0x75, 0x6c, 0x63, 0x61, 0x73, 0x74, 0x4c, 0x61, 0x79, 0x65, 0x72, 0x52, 0x06, 0x6c,
+	0x61, 0x79, 0x65, 0x72, 0x73, 0x22, 0x82, 0x01, 0x0a, 0x10, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72,
+	0x69, 0x62, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x31, 0x0a, 0x07, 0x72, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x61, 0x70,
+	0x69, 0x2e, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x63, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x48, 0x00, 0x52, 0x07, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2e, 0x0a,
+	0x06, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e,
+	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e,
+	0x41, 0x6e, 0x79, 0x48, 0x00, 0x52, 0x06, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x42, 0x0b, 0x0a,
+	0x09, 0x6f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0xea, 0x01, 0x0a, 0x0a, 0x54,
+	0x61, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x73, 0x74, 0x72,
+	0x65, 0x61, 0x6d, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x73, 0x74,
+	0x72, 0x65, 0x61, 0x6d, 0x49, 0x64, 0x12, 0x19, 0x0a, 0x08, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x5f,
+	0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x49,
+	0x64, 0x12, 0x22, 0x0a, 0x0d, 0x72, 0x74, 0x70, 0x5f, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x5f,
+	0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x72, 0x74, 0x70, 0x53, 0x74, 0x72,
+	0x65, 0x61, 0x6d, 0x49, 0x64, 0x12, 0x2f, 0x0a, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x69,
+	0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x11, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x54,
+	0x61, 0x70, 0x44, 0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x09, 0x64, 0x69, 0x72,
+	0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x21, 0x0a, 0x0b, 0x75, 0x64, 0x70, 0x5f, 0x61, 0x64,
+	0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x0a, 0x75,
+	0x64, 0x70, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x1d, 0x0a, 0x09, 0x70, 0x63, 0x61,
+	0x70, 0x5f, 0x70, 0x61, 0x74, 0x68, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x08,
+	0x70, 0x63, 0x61, 0x70, 0x50, 0x61, 0x74, 0x68, 0x42, 0x0d, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x74,
+	0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x4e, 0x0a, 0x09, 0x54, 0x61, 0x70, 0x50, 0x61,
+	0x63, 0x6b, 0x65, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x72, 0x74, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x03, 0x72, 0x74, 0x70, 0x12, 0x2f, 0x0a, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74,
+	0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x11, 0x2e, 0x61, 0x70, 0x69, 0x2e,
+	0x54, 0x61, 0x70, 0x44, 0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x09, 0x64, 0x69,
+	0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0xe7, 0x01, 0x0a, 0x0d, 0x52, 0x65, 0x63, 0x6f,
+	0x72, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2b, 0x0a, 0x05, 0x74, 0x72, 0x61,
+	0x63, 0x6b, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x54,
+	0x72, 0x61, 0x6e, 0x73, 0x63, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x52,
+	0x05, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x12, 0x2d, 0x0a, 0x06, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x73,
+	0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x54, 0x72, 0x61,
+	0x6e, 0x73, 0x63, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x52, 0x06, 0x74,
+	0x72, 0x61, 0x63, 0x6b, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x12, 0x38, 0x0a, 0x18, 0x73, 0x65, 0x67,
+	0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x73, 0x65,
+	0x63, 0x6f, 0x6e, 0x64, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x16, 0x73, 0x65, 0x67,
+	0x6d, 0x65, 0x6e, 0x74, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x65, 0x63, 0x6f,
+	0x6e, 0x64, 0x73, 0x12, 0x2c, 0x0a, 0x12, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x73,
+	0x69, 0x7a, 0x65, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x52,
+	0x10, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x53, 0x69, 0x7a, 0x65, 0x42, 0x79, 0x74, 0x65,
+	0x73, 0x22, 0x6c, 0x0a, 0x0c, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x65, 0x64, 0x46, 0x69, 0x6c,
+	0x65, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x70, 0x61, 0x74, 0x68, 0x12, 0x29, 0x0a, 0x10, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x5f, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52,
+	0x0f, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73,
+	0x12, 0x1d, 0x0a, 0x0a, 0x73, 0x69, 0x7a, 0x65, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x73, 0x69, 0x7a, 0x65, 0x42, 0x79, 0x74, 0x65, 0x73, 0x22,
+	0x68, 0x0a, 0x0a, 0x53, 0x52, 0x54, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x1d, 0x0a,
+	0x0a, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x5f, 0x6d, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x09, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x4d, 0x73, 0x12, 0x1e, 0x0a, 0x0a,
+	0x70, 0x61, 0x73, 0x73, 0x70, 0x68, 0x72, 0x61, 0x73, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0a, 0x70, 0x61, 0x73, 0x73, 0x70, 0x68, 0x72, 0x61, 0x73, 0x65, 0x12, 0x1b, 0x0a, 0x09,
+	0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x08, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x49, 0x64, 0x22, 0x84, 0x01, 0x0a, 0x0e, 0x50, 0x75,
+	0x73, 0x68, 0x53, 0x52, 0x54, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2d, 0x0a, 0x06,
+	0x74, 0x72, 0x61, 0x63, 0x6b, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x61,
+	0x70, 0x69, 0x2e, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x63, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x52, 0x06, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x61,
+	0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x61, 0x64,
+	0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x29, 0x0a, 0x07, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x53, 0x52, 0x54,
+	0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x07, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73,
+	0x22, 0x11, 0x0a, 0x0f, 0x50, 0x75, 0x73, 0x68, 0x53, 0x52, 0x54, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x22, 0x42, 0x0a, 0x11, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x73, 0x68, 0x52, 0x54,
+	0x50, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x64, 0x70, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x64, 0x70, 0x12, 0x1b, 0x0a, 0x09, 0x73, 0x74,
+	0x72, 0x65, 0x61, 0x6d, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x73,
+	0x74, 0x72, 0x65, 0x61, 0x6d, 0x49, 0x64, 0x22, 0x3c, 0x0a, 0x12, 0x50, 0x75, 0x62, 0x6c, 0x69,
+	0x73, 0x68, 0x52, 0x54, 0x50, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x10, 0x0a,
+	0x03, 0x73, 0x64, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x64, 0x70, 0x12,
+	0x14, 0x0a, 0x05, 0x70, 0x6f, 0x72, 0x74, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0d, 0x52, 0x05,
+	0x70, 0x6f, 0x72, 0x74, 0x73, 0x22, 0x64, 0x0a, 0x08, 0x53, 0x52, 0x54, 0x50, 0x4b, 0x65, 0x79,
+	0x73, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x07, 0x70, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x6d,
+	0x61, 0x73, 0x74, 0x65, 0x72, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x09, 0x6d, 0x61, 0x73, 0x74, 0x65, 0x72, 0x4b, 0x65, 0x79, 0x12, 0x1f, 0x0a, 0x0b, 0x6d, 0x61,
+	0x73, 0x74, 0x65, 0x72, 0x5f, 0x73, 0x61, 0x6c, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x0a, 0x6d, 0x61, 0x73, 0x74, 0x65, 0x72, 0x53, 0x61, 0x6c, 0x74, 0x22, 0x7f, 0x0a, 0x13, 0x53,
+	0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x52, 0x54, 0x50, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x2b, 0x0a, 0x05, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x15, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x63, 0x6f, 0x64,
+	0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x52, 0x05, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x12,
+	0x18, 0x0a, 0x07, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x07, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x21, 0x0a, 0x04, 0x73, 0x72, 0x74,
+	0x70, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0d, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x53, 0x52,
+	0x54, 0x50, 0x4b, 0x65, 0x79, 0x73, 0x52, 0x04, 0x73, 0x72, 0x74, 0x70, 0x22, 0x28, 0x0a, 0x14,
+	0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x52, 0x54, 0x50, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x64, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x03, 0x73, 0x64, 0x70, 0x2a, 0x2b, 0x0a, 0x09, 0x53, 0x63, 0x61, 0x6c, 0x65, 0x4d,
+	0x6f, 0x64, 0x65, 0x12, 0x07, 0x0a, 0x03, 0x46, 0x49, 0x54, 0x10, 0x00, 0x12, 0x08, 0x0a, 0x04,
+	0x46, 0x49, 0x4c, 0x4c, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x53, 0x54, 0x52, 0x45, 0x54, 0x43,
+	0x48, 0x10, 0x02, 0x2a, 0x2f, 0x0a, 0x0c, 0x54, 0x61, 0x70, 0x44, 0x69, 0x72, 0x65, 0x63, 0x74,
+	0x69, 0x6f, 0x6e, 0x12, 0x08, 0x0a, 0x04, 0x42, 0x4f, 0x54, 0x48, 0x10, 0x00, 0x12, 0x09, 0x0a,
+	0x05, 0x49, 0x4e, 0x50, 0x55, 0x54, 0x10, 0x01, 0x12, 0x0a, 0x0a, 0x06, 0x4f, 0x55, 0x54, 0x50,
+	0x55, 0x54, 0x10, 0x02, 0x32, 0xae, 0x03, 0x0a, 0x0a, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x63, 0x6f,
+	0x64, 0x65, 0x72, 0x12, 0x3b, 0x0a, 0x07, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x73, 0x68, 0x12, 0x14,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x41, 0x6e, 0x79, 0x1a, 0x14, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x41, 0x6e, 0x79, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01,
+	0x12, 0x3e, 0x0a, 0x09, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x12, 0x15, 0x2e,
+	0x61, 0x70, 0x69, 0x2e, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x14, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x41, 0x6e, 0x79, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01,
+	0x12, 0x2a, 0x0a, 0x03, 0x54, 0x61, 0x70, 0x12, 0x0f, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x54, 0x61,
+	0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0e, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x54,
+	0x61, 0x70, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x22, 0x00, 0x30, 0x01, 0x12, 0x33, 0x0a, 0x06,
+	0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x12, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x52, 0x65, 0x63,
+	0x6f, 0x72, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x11, 0x2e, 0x61, 0x70, 0x69,
+	0x2e, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x65, 0x64, 0x46, 0x69, 0x6c, 0x65, 0x22, 0x00, 0x30,
+	0x01, 0x12, 0x36, 0x0a, 0x07, 0x50, 0x75, 0x73, 0x68, 0x53, 0x52, 0x54, 0x12, 0x13, 0x2e, 0x61,
+	0x70, 0x69, 0x2e, 0x50, 0x75, 0x73, 0x68, 0x53, 0x52, 0x54, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x14, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x50, 0x75, 0x73, 0x68, 0x53, 0x52, 0x54, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x41, 0x0a, 0x0a, 0x50, 0x75, 0x62,
+	0x6c, 0x69, 0x73, 0x68, 0x52, 0x54, 0x50, 0x12, 0x16, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x50, 0x75,
+	0x62, 0x6c, 0x69, 0x73, 0x68, 0x52, 0x54, 0x50, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x17, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x73, 0x68, 0x52, 0x54, 0x50,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x30, 0x01, 0x12, 0x47, 0x0a, 0x0c,
+	0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x52, 0x54, 0x50, 0x12, 0x18, 0x2e, 0x61,
+	0x70, 0x69, 0x2e, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x52, 0x54, 0x50, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x53, 0x75, 0x62,
+	0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x52, 0x54, 0x50, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x22, 0x00, 0x30, 0x01, 0x42, 0x23, 0x5a, 0x21, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
+	0x63, 0x6f, 0x6d, 0x2f, 0x6d, 0x75, 0x78, 0x61, 0x62, 0x6c, 0x65, 0x2f, 0x74, 0x72, 0x61, 0x6e,
+	0x73, 0x63, 0x6f, 0x64, 0x65, 0x72, 0x2f, 0x61, 0x70, 0x69, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
+}
+
+var (
+	file_transcoder_proto_rawDescOnce sync.Once
+	file_transcoder_proto_rawDescData = file_transcoder_proto_rawDesc
+)
+
+func file_transcoder_proto_rawDescGZIP() []byte {
+	file_transcoder_proto_rawDescOnce.Do(func() {
+		file_transcoder_proto_rawDescData = protoimpl.X.CompressGZIP(file_transcoder_proto_rawDescData)
+	})
+	return file_transcoder_proto_rawDescData
+}
+
+var file_transcoder_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_transcoder_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_transcoder_proto_goTypes = []interface{}{
+	(ScaleMode)(0),               // 0: api.ScaleMode
+	(TapDirection)(0),            // 1: api.TapDirection
+	(*SimulcastLayer)(nil),       // 2: api.SimulcastLayer
+	(*TranscodeRequest)(nil),     // 3: api.TranscodeRequest
+	(*SubscribeRequest)(nil),     // 4: api.SubscribeRequest
+	(*TapRequest)(nil),           // 5: api.TapRequest
+	(*TapPacket)(nil),            // 6: api.TapPacket
+	(*RecordRequest)(nil),        // 7: api.RecordRequest
+	(*RecordedFile)(nil),         // 8: api.RecordedFile
+	(*SRTOptions)(nil),           // 9: api.SRTOptions
+	(*PushSRTRequest)(nil),       // 10: api.PushSRTRequest
+	(*PushSRTResponse)(nil),      // 11: api.PushSRTResponse
+	(*PublishRTPRequest)(nil),    // 12: api.PublishRTPRequest
+	(*PublishRTPResponse)(nil),   // 13: api.PublishRTPResponse
+	(*SRTPKeys)(nil),             // 14: api.SRTPKeys
+	(*SubscribeRTPRequest)(nil),  // 15: api.SubscribeRTPRequest
+	(*SubscribeRTPResponse)(nil), // 16: api.SubscribeRTPResponse
+	(*anypb.Any)(nil),            // 17: google.protobuf.Any
+}
+var file_transcoder_proto_depIdxs = []int32{
+	0,  // 0: api.TranscodeRequest.scale_mode:type_name -> api.ScaleMode
+	2,  // 1: api.TranscodeRequest.layers:type_name -> api.SimulcastLayer
+	3,  // 2: api.SubscribeRequest.request:type_name -> api.TranscodeRequest
+	17, // 3: api.SubscribeRequest.signal:type_name -> google.protobuf.Any
+	1,  // 4: api.TapRequest.direction:type_name -> api.TapDirection
+	1,  // 5: api.TapPacket.direction:type_name -> api.TapDirection
+	3,  // 6: api.RecordRequest.track:type_name -> api.TranscodeRequest
+	3,  // 7: api.RecordRequest.tracks:type_name -> api.TranscodeRequest
+	3,  // 8: api.PushSRTRequest.tracks:type_name -> api.TranscodeRequest
+	9,  // 9: api.PushSRTRequest.options:type_name -> api.SRTOptions
+	3,  // 10: api.SubscribeRTPRequest.track:type_name -> api.TranscodeRequest
+	14, // 11: api.SubscribeRTPRequest.srtp:type_name -> api.SRTPKeys
+	17, // 12: api.Transcoder.Publish:input_type -> google.protobuf.Any
+	4,  // 13: api.Transcoder.Subscribe:input_type -> api.SubscribeRequest
+	5,  // 14: api.Transcoder.Tap:input_type -> api.TapRequest
+	7,  // 15: api.Transcoder.Record:input_type -> api.RecordRequest
+	10, // 16: api.Transcoder.PushSRT:input_type -> api.PushSRTRequest
+	12, // 17: api.Transcoder.PublishRTP:input_type -> api.PublishRTPRequest
+	15, // 18: api.Transcoder.SubscribeRTP:input_type -> api.SubscribeRTPRequest
+	17, // 19: api.Transcoder.Publish:output_type -> google.protobuf.Any
+	17, // 20: api.Transcoder.Subscribe:output_type -> google.protobuf.Any
+	6,  // 21: api.Transcoder.Tap:output_type -> api.TapPacket
+	8,  // 22: api.Transcoder.Record:output_type -> api.RecordedFile
+	11, // 23: api.Transcoder.PushSRT:output_type -> api.PushSRTResponse
+	13, // 24: api.Transcoder.PublishRTP:output_type -> api.PublishRTPResponse
+	16, // 25: api.Transcoder.SubscribeRTP:output_type -> api.SubscribeRTPResponse
+	19, // [19:26] is the sub-list for method output_type
+	12, // [12:19] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_transcoder_proto_init() }
+func file_transcoder_proto_init() {
+	if File_transcoder_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_transcoder_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SimulcastLayer); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_transcoder_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TranscodeRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_transcoder_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubscribeRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_transcoder_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TapRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_transcoder_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TapPacket); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_transcoder_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RecordRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -274,8 +1562,104 @@ func file_transcoder_proto_init() {
 				return nil
 			}
 		}
-		file_transcoder_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*SubscribeRequest); i {
+		file_transcoder_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RecordedFile); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_transcoder_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SRTOptions); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_transcoder_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PushSRTRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_transcoder_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PushSRTResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_transcoder_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PublishRTPRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_transcoder_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PublishRTPResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_transcoder_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SRTPKeys); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_transcoder_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubscribeRTPRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_transcoder_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubscribeRTPResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -287,22 +1671,27 @@ func file_transcoder_proto_init() {
 			}
 		}
 	}
-	file_transcoder_proto_msgTypes[1].OneofWrappers = []interface{}{
+	file_transcoder_proto_msgTypes[2].OneofWrappers = []interface{}{
 		(*SubscribeRequest_Request)(nil),
 		(*SubscribeRequest_Signal)(nil),
 	}
+	file_transcoder_proto_msgTypes[3].OneofWrappers = []interface{}{
+		(*TapRequest_UdpAddress)(nil),
+		(*TapRequest_PcapPath)(nil),
+	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_transcoder_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   2,
+			NumEnums:      2,
+			NumMessages:   15,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_transcoder_proto_goTypes,
 		DependencyIndexes: file_transcoder_proto_depIdxs,
+		EnumInfos:         file_transcoder_proto_enumTypes,
 		MessageInfos:      file_transcoder_proto_msgTypes,
 	}.Build()
 	File_transcoder_proto = out.File
@@ -325,6 +1714,22 @@ const _ = grpc.SupportPackageIsVersion6
 type TranscoderClient interface {
 	Publish(ctx context.Context, opts ...grpc.CallOption) (Transcoder_PublishClient, error)
 	Subscribe(ctx context.Context, opts ...grpc.CallOption) (Transcoder_SubscribeClient, error)
+	// mirrors the rtp packets of a track until the call ends. the server must enable this rpc.
+	Tap(ctx context.Context, in *TapRequest, opts ...grpc.CallOption) (Transcoder_TapClient, error)
+	// records a track to files on the server until the track ends or the call is cancelled, streaming
+	// each file once it's finished. the server must be configured with a recording directory.
+	Record(ctx context.Context, in *RecordRequest, opts ...grpc.CallOption) (Transcoder_RecordClient, error)
+	// pushes tracks as mpeg-ts to an srt listener until the tracks end or the call is cancelled. the
+	// server must enable this rpc.
+	PushSRT(ctx context.Context, in *PushSRTRequest, opts ...grpc.CallOption) (*PushSRTResponse, error)
+	// receives plain rtp streams described by an sdp, for example from ffmpeg or gstreamer, and publishes
+	// them until the call is cancelled or no packets are received for 10 seconds. a single response is
+	// sent once the ports are allocated. the server must enable this rpc.
+	PublishRTP(ctx context.Context, in *PublishRTPRequest, opts ...grpc.CallOption) (Transcoder_PublishRTPClient, error)
+	// sends a transcoded track as plain rtp to a udp address until the track ends or the call is
+	// cancelled. a single response describing the stream is sent once the track is found. the server
+	// must enable this rpc.
+	SubscribeRTP(ctx context.Context, in *SubscribeRTPRequest, opts ...grpc.CallOption) (Transcoder_SubscribeRTPClient, error)
 }
 
 type transcoderClient struct {
@@ -397,10 +1802,163 @@ func (x *transcoderSubscribeClient) Recv() (*anypb.Any, error) {
 	return m, nil
 }
 
+func (c *transcoderClient) Tap(ctx context.Context, in *TapRequest, opts ...grpc.CallOption) (Transcoder_TapClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Transcoder_serviceDesc.Streams[2], "/api.Transcoder/Tap", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &transcoderTapClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Transcoder_TapClient interface {
+	Recv() (*TapPacket, error)
+	grpc.ClientStream
+}
+
+type transcoderTapClient struct {
+	grpc.ClientStream
+}
+
+func (x *transcoderTapClient) Recv() (*TapPacket, error) {
+	m := new(TapPacket)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *transcoderClient) Record(ctx context.Context, in *RecordRequest, opts ...grpc.CallOption) (Transcoder_RecordClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Transcoder_serviceDesc.Streams[3], "/api.Transcoder/Record", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &transcoderRecordClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Transcoder_RecordClient interface {
+	Recv() (*RecordedFile, error)
+	grpc.ClientStream
+}
+
+type transcoderRecordClient struct {
+	grpc.ClientStream
+}
+
+func (x *transcoderRecordClient) Recv() (*RecordedFile, error) {
+	m := new(RecordedFile)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *transcoderClient) PushSRT(ctx context.Context, in *PushSRTRequest, opts ...grpc.CallOption) (*PushSRTResponse, error) {
+	out := new(PushSRTResponse)
+	err := c.cc.Invoke(ctx, "/api.Transcoder/PushSRT", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *transcoderClient) PublishRTP(ctx context.Context, in *PublishRTPRequest, opts ...grpc.CallOption) (Transcoder_PublishRTPClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Transcoder_serviceDesc.Streams[4], "/api.Transcoder/PublishRTP", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &transcoderPublishRTPClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Transcoder_PublishRTPClient interface {
+	Recv() (*PublishRTPResponse, error)
+	grpc.ClientStream
+}
+
+type transcoderPublishRTPClient struct {
+	grpc.ClientStream
+}
+
+func (x *transcoderPublishRTPClient) Recv() (*PublishRTPResponse, error) {
+	m := new(PublishRTPResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *transcoderClient) SubscribeRTP(ctx context.Context, in *SubscribeRTPRequest, opts ...grpc.CallOption) (Transcoder_SubscribeRTPClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Transcoder_serviceDesc.Streams[5], "/api.Transcoder/SubscribeRTP", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &transcoderSubscribeRTPClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Transcoder_SubscribeRTPClient interface {
+	Recv() (*SubscribeRTPResponse, error)
+	grpc.ClientStream
+}
+
+type transcoderSubscribeRTPClient struct {
+	grpc.ClientStream
+}
+
+func (x *transcoderSubscribeRTPClient) Recv() (*SubscribeRTPResponse, error) {
+	m := new(SubscribeRTPResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // TranscoderServer is the server API for Transcoder service.
 type TranscoderServer interface {
 	Publish(Transcoder_PublishServer) error
 	Subscribe(Transcoder_SubscribeServer) error
+	// mirrors the rtp packets of a track until the call ends. the server must enable this rpc.
+	Tap(*TapRequest, Transcoder_TapServer) error
+	// records a track to files on the server until the track ends or the call is cancelled, streaming
+	// each file once it's finished. the server must be configured with a recording directory.
+	Record(*RecordRequest, Transcoder_RecordServer) error
+	// pushes tracks as mpeg-ts to an srt listener until the tracks end or the call is cancelled. the
+	// server must enable this rpc.
+	PushSRT(context.Context, *PushSRTRequest) (*PushSRTResponse, error)
+	// receives plain rtp streams described by an sdp, for example from ffmpeg or gstreamer, and publishes
+	// them until the call is cancelled or no packets are received for 10 seconds. a single response is
+	// sent once the ports are allocated. the server must enable this rpc.
+	PublishRTP(*PublishRTPRequest, Transcoder_PublishRTPServer) error
+	// sends a transcoded track as plain rtp to a udp address until the track ends or the call is
+	// cancelled. a single response describing the stream is sent once the track is found. the server
+	// must enable this rpc.
+	SubscribeRTP(*SubscribeRTPRequest, Transcoder_SubscribeRTPServer) error
 }
 
 // UnimplementedTranscoderServer can be embedded to have forward compatible implementations.
@@ -413,6 +1971,21 @@ func (*UnimplementedTranscoderServer) Publish(Transcoder_PublishServer) error {
 func (*UnimplementedTranscoderServer) Subscribe(Transcoder_SubscribeServer) error {
 	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
 }
+func (*UnimplementedTranscoderServer) Tap(*TapRequest, Transcoder_TapServer) error {
+	return status.Errorf(codes.Unimplemented, "method Tap not implemented")
+}
+func (*UnimplementedTranscoderServer) Record(*RecordRequest, Transcoder_RecordServer) error {
+	return status.Errorf(codes.Unimplemented, "method Record not implemented")
+}
+func (*UnimplementedTranscoderServer) PushSRT(context.Context, *PushSRTRequest) (*PushSRTResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PushSRT not implemented")
+}
+func (*UnimplementedTranscoderServer) PublishRTP(*PublishRTPRequest, Transcoder_PublishRTPServer) error {
+	return status.Errorf(codes.Unimplemented, "method PublishRTP not implemented")
+}
+func (*UnimplementedTranscoderServer) SubscribeRTP(*SubscribeRTPRequest, Transcoder_SubscribeRTPServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeRTP not implemented")
+}
 
 func RegisterTranscoderServer(s *grpc.Server, srv TranscoderServer) {
 	s.RegisterService(&_Transcoder_serviceDesc, srv)
@@ -470,10 +2043,117 @@ func (x *transcoderSubscribeServer) Recv() (*SubscribeRequest, error) {
 	return m, nil
 }
 
+func _Transcoder_Tap_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TapRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TranscoderServer).Tap(m, &transcoderTapServer{stream})
+}
+
+type Transcoder_TapServer interface {
+	Send(*TapPacket) error
+	grpc.ServerStream
+}
+
+type transcoderTapServer struct {
+	grpc.ServerStream
+}
+
+func (x *transcoderTapServer) Send(m *TapPacket) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Transcoder_Record_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RecordRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TranscoderServer).Record(m, &transcoderRecordServer{stream})
+}
+
+type Transcoder_RecordServer interface {
+	Send(*RecordedFile) error
+	grpc.ServerStream
+}
+
+type transcoderRecordServer struct {
+	grpc.ServerStream
+}
+
+func (x *transcoderRecordServer) Send(m *RecordedFile) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Transcoder_PushSRT_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PushSRTRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TranscoderServer).PushSRT(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Transcoder/PushSRT",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TranscoderServer).PushSRT(ctx, req.(*PushSRTRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Transcoder_PublishRTP_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PublishRTPRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TranscoderServer).PublishRTP(m, &transcoderPublishRTPServer{stream})
+}
+
+type Transcoder_PublishRTPServer interface {
+	Send(*PublishRTPResponse) error
+	grpc.ServerStream
+}
+
+type transcoderPublishRTPServer struct {
+	grpc.ServerStream
+}
+
+func (x *transcoderPublishRTPServer) Send(m *PublishRTPResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Transcoder_SubscribeRTP_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRTPRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TranscoderServer).SubscribeRTP(m, &transcoderSubscribeRTPServer{stream})
+}
+
+type Transcoder_SubscribeRTPServer interface {
+	Send(*SubscribeRTPResponse) error
+	grpc.ServerStream
+}
+
+type transcoderSubscribeRTPServer struct {
+	grpc.ServerStream
+}
+
+func (x *transcoderSubscribeRTPServer) Send(m *SubscribeRTPResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _Transcoder_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "api.Transcoder",
 	HandlerType: (*TranscoderServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PushSRT",
+			Handler:    _Transcoder_PushSRT_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "Publish",
@@ -487,6 +2167,26 @@ var _Transcoder_serviceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "Tap",
+			Handler:       _Transcoder_Tap_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Record",
+			Handler:       _Transcoder_Record_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "PublishRTP",
+			Handler:       _Transcoder_PublishRTP_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SubscribeRTP",
+			Handler:       _Transcoder_SubscribeRTP_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "transcoder.proto",
 }
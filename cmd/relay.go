@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/muxable/transcoder/pkg/av"
+	"github.com/muxable/transcoder/pkg/codecs"
+	"github.com/muxable/transcoder/pkg/transcoder"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// readSDP returns the codec and port of the first media section of an sdp file, for example one
+// written by ffmpeg or by this command.
+func readSDP(path string) (webrtc.RTPCodecParameters, int, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return webrtc.RTPCodecParameters{}, 0, err
+	}
+	s := &sdp.SessionDescription{}
+	if err := s.Unmarshal(buf); err != nil {
+		return webrtc.RTPCodecParameters{}, 0, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, md := range s.MediaDescriptions {
+		if len(md.MediaName.Formats) == 0 {
+			continue
+		}
+		codec, err := codecs.MediaCodec(s, md)
+		if err != nil {
+			return webrtc.RTPCodecParameters{}, 0, err
+		}
+		return codec, md.MediaName.Port.Value, nil
+	}
+	return webrtc.RTPCodecParameters{}, 0, errors.New("no media description in sdp")
+}
+
+// writeSDP writes the sdp describing the relayed stream to path, or stdout if path is empty.
+func writeSDP(path string, s string) error {
+	if path == "" {
+		_, err := fmt.Fprint(os.Stdout, s)
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(s), 0644)
+}
+
+// relay transcodes an rtp stream received over udp and sends the result to another udp address.
+func relay(args []string) error {
+	fs := flag.NewFlagSet("relay", flag.ContinueOnError)
+	logLevel := fs.String("log-level", "info", "The log level: debug, info, warn or error")
+	sdpPath := fs.String("sdp", "", "An sdp file describing the input stream, replaces the input codec flags")
+	mimeType := fs.String("codec", webrtc.MimeTypeH265, "The mime type of the input stream")
+	payloadType := fs.Uint("payload-type", 96, "The payload type of the input stream")
+	clockRate := fs.Uint("clock-rate", 0, "The clock rate of the input stream, defaults to the codec's usual clock rate")
+	channels := fs.Uint("channels", 0, "The number of audio channels of the input stream")
+	fmtp := fs.String("fmtp", "", "The fmtp line of the input stream, for example sprop-parameter-sets")
+	listen := fs.String("listen", "", "The udp address to receive the input stream on, defaults to the sdp port or :5000")
+	to := fs.String("to", "", "The mime type to transcode to, defaults to video/H264 or audio/opus")
+	outputPayloadType := fs.Int("output-payload-type", -1, "The payload type of the output stream, defaults to the codec's usual payload type")
+	dest := fs.String("dest", "127.0.0.1:5001", "The udp address to send the output stream to")
+	outputSDP := fs.String("output-sdp", "", "The file to write the output sdp to, defaults to stdout")
+	srtpKey := fs.String("srtp-key", "", "Encrypt the output with SRTP using this base64 master key and salt, as in an SDES inline parameter")
+	srtpProfile := fs.String("srtp-profile", "", "The SRTP protection profile, defaults to AES_CM_128_HMAC_SHA1_80")
+	config := av.EncoderConfiguration{}
+	fs.Int64Var(&config.Bitrate, "bitrate", 0, "The target bitrate in bits per second")
+	fs.IntVar(&config.Width, "width", 0, "The output width")
+	fs.IntVar(&config.Height, "height", 0, "The output height")
+	fs.Float64Var(&config.Framerate, "framerate", 0, "The maximum output frame rate")
+	fs.IntVar(&config.KeyframeInterval, "keyframe-interval", 0, "The maximum number of frames between keyframes")
+	fs.StringVar(&config.Profile, "profile", "", "The codec profile, for example baseline")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logger, err := logger(*logLevel)
+	if err != nil {
+		return err
+	}
+	defer logger.Sync()
+	undo := zap.ReplaceGlobals(logger)
+	defer undo()
+
+	var from webrtc.RTPCodecParameters
+	port := 5000
+	if *sdpPath != "" {
+		if from, port, err = readSDP(*sdpPath); err != nil {
+			return err
+		}
+	} else {
+		from = webrtc.RTPCodecParameters{
+			PayloadType: webrtc.PayloadType(*payloadType),
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:    *mimeType,
+				ClockRate:   uint32(*clockRate),
+				Channels:    uint16(*channels),
+				SDPFmtpLine: *fmtp,
+			},
+		}
+		if defaults, ok := codecs.DefaultOutputCodecs[from.MimeType]; ok {
+			if from.ClockRate == 0 {
+				from.ClockRate = defaults.ClockRate
+			}
+			if from.Channels == 0 {
+				from.Channels = defaults.Channels
+			}
+		}
+		if from.ClockRate == 0 {
+			return fmt.Errorf("unknown clock rate for %s, set -clock-rate", from.MimeType)
+		}
+	}
+	if *listen == "" {
+		*listen = fmt.Sprintf(":%d", port)
+	}
+
+	if *to == "" {
+		if strings.HasPrefix(from.MimeType, "audio/") {
+			*to = webrtc.MimeTypeOpus
+		} else {
+			*to = webrtc.MimeTypeH264
+		}
+	}
+	output, ok := codecs.DefaultOutputCodecs[*to]
+	if !ok {
+		return fmt.Errorf("unsupported output codec %s", *to)
+	}
+	if *outputPayloadType >= 0 {
+		output.PayloadType = webrtc.PayloadType(*outputPayloadType)
+	}
+
+	laddr, err := net.ResolveUDPAddr("udp", *listen)
+	if err != nil {
+		return err
+	}
+	var keys *transcoder.SRTPKeys
+	if *srtpKey != "" {
+		if keys, err = transcoder.ParseSRTPKeys(*srtpProfile, *srtpKey); err != nil {
+			return err
+		}
+	}
+	sender, err := transcoder.NewRTPSender(*dest, output, keys)
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+
+	tc, err := av.NewTranscoder(from, output.RTPCodecCapability, config)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		tc.Close()
+		return err
+	}
+	defer conn.Close()
+
+	if err := writeSDP(*outputSDP, sender.SessionDescription()); err != nil {
+		tc.Close()
+		return err
+	}
+
+	zap.L().Info("starting transcoder relay",
+		zap.String("from", from.MimeType), zap.String("to", output.MimeType),
+		zap.String("listen", laddr.String()), zap.String("dest", *dest))
+
+	go func() {
+		buf := make([]byte, 1500)
+		defer tc.Close()
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			p := &rtp.Packet{}
+			if err := p.Unmarshal(buf[:n]); err != nil {
+				zap.L().Error("failed to unmarshal rtp packet", zap.Error(err))
+				continue
+			}
+			if err := tc.WriteRTP(p); err != nil {
+				zap.L().Error("failed to write rtp packet", zap.Error(err))
+				return
+			}
+		}
+	}()
+
+	for {
+		p, err := tc.ReadRTP()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// the sender rewrites the payload type the muxer picks to the one in the output sdp.
+		if err := sender.WriteRTP(p); err != nil {
+			return err
+		}
+	}
+}
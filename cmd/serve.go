@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/muxable/transcoder/api"
+	"github.com/muxable/transcoder/pkg/av"
+	"github.com/muxable/transcoder/pkg/transcoder"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// serveConfig is the configuration of the serve command. It can be loaded from a json file with the
+// same keys, flags override the file.
+type serveConfig struct {
+	Addr           string             `json:"addr"`
+	ICEServers     []webrtc.ICEServer `json:"iceServers"`
+	UDPPortMin     uint               `json:"udpPortMin"`
+	UDPPortMax     uint               `json:"udpPortMax"`
+	NAT1To1IPs     []string           `json:"nat1To1IPs"`
+	LogLevel       string             `json:"logLevel"`
+	MaxPublishers  int                `json:"maxPublishers"`
+	MaxSubscribers int                `json:"maxSubscribers"`
+	TapRPC         bool               `json:"tapRPC"`
+	TapDir         string             `json:"tapDir"`
+	RecordingDir   string             `json:"recordingDir"`
+	HTTPAddr       string             `json:"httpAddr"`
+	HLS            bool               `json:"hls"`
+	// the hls durations are in seconds.
+	HLSSegmentDuration  float64 `json:"hlsSegmentDuration"`
+	HLSPartDuration     float64 `json:"hlsPartDuration"`
+	HLSWindow           int     `json:"hlsWindow"`
+	DASHDir             string  `json:"dashDir"`
+	DASHSegmentDuration float64 `json:"dashSegmentDuration"`
+	DASHWindow          int     `json:"dashWindow"`
+	// DASHVideo are the renditions of video tracks, it can only be set in the config file.
+	DASHVideo []renditionConfig `json:"dashVideo"`
+	WHIP      bool              `json:"whip"`
+	WHIPToken string            `json:"whipToken"`
+	WHEP      bool              `json:"whep"`
+	WHEPToken string            `json:"whepToken"`
+	RTMPAddr  string            `json:"rtmpAddr"`
+	// the srt ingest receives mpeg-ts as the stream SRTStreamID, the latency is in milliseconds.
+	SRTAddr       string `json:"srtAddr"`
+	SRTCaller     bool   `json:"srtCaller"`
+	SRTStreamID   string `json:"srtStreamID"`
+	SRTLatency    int    `json:"srtLatency"`
+	SRTPassphrase string `json:"srtPassphrase"`
+	SRTPush       bool   `json:"srtPush"`
+	// RTSPSources are pulled from RTSP servers such as IP cameras, the flag sets them as stream=url
+	// pairs with RTSPTransport.
+	RTSPSources   []rtspSourceConfig `json:"rtspSources"`
+	RTSPTransport string             `json:"rtspTransport"`
+	// RTP enables the PublishRTP and SubscribeRTP rpcs, PublishRTP receives on the rtp port range and
+	// advertises RTPHost. The range must not overlap the udp port range of the peer connections, any
+	// free port is used if it's zero.
+	RTP        bool   `json:"rtp"`
+	RTPHost    string `json:"rtpHost"`
+	RTPPortMin uint   `json:"rtpPortMin"`
+	RTPPortMax uint   `json:"rtpPortMax"`
+}
+
+// rtspSourceConfig is an RTSP stream published as StreamID.
+type rtspSourceConfig struct {
+	StreamID  string `json:"streamID"`
+	URL       string `json:"url"`
+	Transport string `json:"transport"`
+}
+
+// renditionConfig is an encoded rendition of a track.
+type renditionConfig struct {
+	Bitrate   int64   `json:"bitrate"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	Framerate float64 `json:"framerate"`
+}
+
+// stringList is a comma separated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+// iceServerList is a comma separated list of ice server urls without credentials.
+type iceServerList []webrtc.ICEServer
+
+func (l *iceServerList) String() string {
+	var urls []string
+	for _, server := range *l {
+		urls = append(urls, server.URLs...)
+	}
+	return strings.Join(urls, ",")
+}
+
+func (l *iceServerList) Set(value string) error {
+	var urls stringList
+	if err := urls.Set(value); err != nil {
+		return err
+	}
+	*l = nil
+	for _, url := range urls {
+		*l = append(*l, webrtc.ICEServer{URLs: []string{url}})
+	}
+	return nil
+}
+
+// rtspSourceList is a flag of comma separated stream=url pairs.
+type rtspSourceList []rtspSourceConfig
+
+func (l *rtspSourceList) String() string {
+	var pairs []string
+	for _, source := range *l {
+		pairs = append(pairs, source.StreamID+"="+source.URL)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l *rtspSourceList) Set(value string) error {
+	var pairs stringList
+	if err := pairs.Set(value); err != nil {
+		return err
+	}
+	*l = nil
+	for _, pair := range pairs {
+		i := strings.IndexByte(pair, '=')
+		if i <= 0 {
+			return fmt.Errorf("invalid rtsp source %q, expected stream=url", pair)
+		}
+		*l = append(*l, rtspSourceConfig{StreamID: pair[:i], URL: pair[i+1:]})
+	}
+	return nil
+}
+
+func parseServeConfig(args []string) (*serveConfig, error) {
+	addr := ":50051"
+	if port := os.Getenv("PORT"); port != "" {
+		addr = ":" + port
+	}
+	config := &serveConfig{
+		Addr:       addr,
+		ICEServers: []webrtc.ICEServer{{URLs: []string{"stun:stun.l.google.com:19302"}}},
+		UDPPortMin: 5000,
+		UDPPortMax: 5200,
+		LogLevel:   "info",
+	}
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	path := fs.String("config", "", "A json file to load the configuration from, flags take precedence")
+	fs.StringVar(&config.Addr, "addr", config.Addr, "The address to listen on")
+	fs.Var((*iceServerList)(&config.ICEServers), "ice-servers", "Comma separated ICE server urls, use the config file for credentials")
+	fs.UintVar(&config.UDPPortMin, "udp-port-min", config.UDPPortMin, "The lowest UDP port used for media")
+	fs.UintVar(&config.UDPPortMax, "udp-port-max", config.UDPPortMax, "The highest UDP port used for media")
+	fs.Var((*stringList)(&config.NAT1To1IPs), "nat-1to1-ips", "Comma separated public IPs to advertise in host candidates when behind a 1:1 NAT")
+	fs.StringVar(&config.LogLevel, "log-level", config.LogLevel, "The log level: debug, info, warn or error")
+	fs.IntVar(&config.MaxPublishers, "max-publishers", config.MaxPublishers, "The maximum number of concurrent publishers, zero is unlimited")
+	fs.IntVar(&config.MaxSubscribers, "max-subscribers", config.MaxSubscribers, "The maximum number of concurrent subscribers, zero is unlimited")
+	fs.BoolVar(&config.TapRPC, "tap-rpc", config.TapRPC, "Enable the Tap rpc, only for trusted networks")
+	fs.StringVar(&config.TapDir, "tap-dir", config.TapDir, "Let the Tap rpc write pcap files to this directory")
+	fs.StringVar(&config.RecordingDir, "recording-dir", config.RecordingDir, "Enable the Record rpc, writing files to this directory")
+	fs.StringVar(&config.HTTPAddr, "http-addr", config.HTTPAddr, "The address to serve HTTP outputs such as HLS on")
+	fs.BoolVar(&config.HLS, "hls", config.HLS, "Serve the published tracks over HLS, requires -http-addr")
+	fs.Float64Var(&config.HLSSegmentDuration, "hls-segment-duration", config.HLSSegmentDuration, "The target duration of HLS segments in seconds, defaults to 2")
+	fs.Float64Var(&config.HLSPartDuration, "hls-part-duration", config.HLSPartDuration, "The duration of low latency HLS partial segments in seconds, zero disables low latency HLS")
+	fs.IntVar(&config.HLSWindow, "hls-window", config.HLSWindow, "The number of segments in HLS playlists, defaults to 6")
+	fs.StringVar(&config.DASHDir, "dash-dir", config.DASHDir, "Package the published streams as DASH into this directory, requires -http-addr to serve them")
+	fs.Float64Var(&config.DASHSegmentDuration, "dash-segment-duration", config.DASHSegmentDuration, "The target duration of DASH segments in seconds, defaults to 2")
+	fs.IntVar(&config.DASHWindow, "dash-window", config.DASHWindow, "The number of segments in live DASH manifests, defaults to 6")
+	fs.BoolVar(&config.WHIP, "whip", config.WHIP, "Accept publishers over WHIP, requires -http-addr")
+	fs.StringVar(&config.WHIPToken, "whip-token", config.WHIPToken, "The bearer token WHIP publishers must send, publishing is open if it's empty")
+	fs.BoolVar(&config.WHEP, "whep", config.WHEP, "Serve subscribers over WHEP, requires -http-addr")
+	fs.StringVar(&config.WHEPToken, "whep-token", config.WHEPToken, "The bearer token WHEP subscribers must send, subscribing is open if it's empty")
+	fs.StringVar(&config.RTMPAddr, "rtmp-addr", config.RTMPAddr, "The address to accept RTMP publishers on, for example :1935")
+	fs.StringVar(&config.SRTAddr, "srt-addr", config.SRTAddr, "The address to receive an MPEG-TS stream over SRT on, for example :9000")
+	fs.BoolVar(&config.SRTCaller, "srt-caller", config.SRTCaller, "Connect to -srt-addr instead of listening on it")
+	fs.StringVar(&config.SRTStreamID, "srt-stream-id", config.SRTStreamID, "The stream id of the SRT stream, it's also sent to the SRT peer")
+	fs.IntVar(&config.SRTLatency, "srt-latency", config.SRTLatency, "The SRT latency in milliseconds, zero uses the SRT default")
+	fs.StringVar(&config.SRTPassphrase, "srt-passphrase", config.SRTPassphrase, "The passphrase encrypting SRT streams, unencrypted if it's empty")
+	fs.BoolVar(&config.SRTPush, "srt-push", config.SRTPush, "Enable the PushSRT rpc, only for trusted networks")
+	fs.Var((*rtspSourceList)(&config.RTSPSources), "rtsp-sources", "Comma separated stream=url pairs of RTSP streams to publish, for example cam1=rtsp://192.0.2.1/stream")
+	fs.StringVar(&config.RTSPTransport, "rtsp-transport", config.RTSPTransport, "How RTSP media is received if a source doesn't set it: tcp or udp, defaults to tcp")
+	fs.BoolVar(&config.RTP, "rtp", config.RTP, "Enable the PublishRTP and SubscribeRTP rpcs, which receive plain RTP on the RTP port range and send it anywhere, only for trusted networks")
+	fs.StringVar(&config.RTPHost, "rtp-host", config.RTPHost, "The address senders send plain RTP to, defaults to the first NAT 1:1 IP or 127.0.0.1")
+	fs.UintVar(&config.RTPPortMin, "rtp-port-min", config.RTPPortMin, "The lowest UDP port plain RTP is received on, separate from the WebRTC ports")
+	fs.UintVar(&config.RTPPortMax, "rtp-port-max", config.RTPPortMax, "The highest UDP port plain RTP is received on")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *path != "" {
+		f, err := os.Open(*path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if err := json.NewDecoder(f).Decode(config); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", *path, err)
+		}
+		// parse the flags again so they override the file.
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.UDPPortMin > config.UDPPortMax || config.UDPPortMax > 65535 {
+		return nil, fmt.Errorf("invalid udp port range %d-%d", config.UDPPortMin, config.UDPPortMax)
+	}
+	if config.RTPPortMin > config.RTPPortMax || config.RTPPortMax > 65535 {
+		return nil, fmt.Errorf("invalid rtp port range %d-%d", config.RTPPortMin, config.RTPPortMax)
+	}
+	// the ranges are allocated independently, so a port could be taken by both.
+	if config.RTPPortMax > 0 && config.UDPPortMax > 0 && config.RTPPortMin <= config.UDPPortMax && config.UDPPortMin <= config.RTPPortMax {
+		return nil, fmt.Errorf("rtp port range %d-%d overlaps the udp port range %d-%d", config.RTPPortMin, config.RTPPortMax, config.UDPPortMin, config.UDPPortMax)
+	}
+	if config.HLS && config.HTTPAddr == "" {
+		return nil, errors.New("-hls requires -http-addr")
+	}
+	if config.WHIP && config.HTTPAddr == "" {
+		return nil, errors.New("-whip requires -http-addr")
+	}
+	if config.WHEP && config.HTTPAddr == "" {
+		return nil, errors.New("-whep requires -http-addr")
+	}
+	for _, source := range config.RTSPSources {
+		if source.StreamID == "" || source.URL == "" {
+			return nil, errors.New("rtsp sources require a stream id and url")
+		}
+	}
+	if config.SRTAddr != "" && config.SRTStreamID == "" {
+		return nil, errors.New("-srt-addr requires -srt-stream-id")
+	}
+	return config, nil
+}
+
+// seconds converts a duration in seconds from the config.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func serve(args []string) error {
+	config, err := parseServeConfig(args)
+	if err != nil {
+		return err
+	}
+
+	logger, err := logger(config.LogLevel)
+	if err != nil {
+		return err
+	}
+	defer logger.Sync()
+	undo := zap.ReplaceGlobals(logger)
+	defer undo()
+
+	settingEngine := webrtc.SettingEngine{}
+	if config.UDPPortMin > 0 || config.UDPPortMax > 0 {
+		if err := settingEngine.SetEphemeralUDPPortRange(uint16(config.UDPPortMin), uint16(config.UDPPortMax)); err != nil {
+			return err
+		}
+	}
+	if len(config.NAT1To1IPs) > 0 {
+		settingEngine.SetNAT1To1IPs(config.NAT1To1IPs, webrtc.ICECandidateTypeHost)
+	}
+
+	options := []transcoder.ServerOption{
+		transcoder.WithSettingEngine(settingEngine),
+		transcoder.WithMaxPublishers(config.MaxPublishers),
+		transcoder.WithMaxSubscribers(config.MaxSubscribers),
+	}
+	if config.TapRPC {
+		options = append(options, transcoder.WithTapRPC())
+	}
+	if config.TapDir != "" {
+		options = append(options, transcoder.WithTapDirectory(config.TapDir))
+	}
+	if config.RecordingDir != "" {
+		options = append(options, transcoder.WithRecordingDirectory(config.RecordingDir))
+	}
+	if config.HLS {
+		options = append(options, transcoder.WithHLS(transcoder.HLSConfiguration{
+			SegmentDuration: seconds(config.HLSSegmentDuration),
+			PartDuration:    seconds(config.HLSPartDuration),
+			Window:          config.HLSWindow,
+		}))
+	}
+	if config.DASHDir != "" {
+		dash := transcoder.DASHConfiguration{
+			Directory:       config.DASHDir,
+			SegmentDuration: seconds(config.DASHSegmentDuration),
+			Window:          config.DASHWindow,
+		}
+		for _, r := range config.DASHVideo {
+			dash.Video = append(dash.Video, av.EncoderConfiguration{
+				Bitrate:   r.Bitrate,
+				Width:     r.Width,
+				Height:    r.Height,
+				Framerate: r.Framerate,
+			})
+		}
+		options = append(options, transcoder.WithDASH(dash))
+	}
+	if config.WHIP {
+		options = append(options, transcoder.WithWHIP(transcoder.WHIPConfiguration{Token: config.WHIPToken}))
+	}
+	if config.WHEP {
+		options = append(options, transcoder.WithWHEP(transcoder.WHEPConfiguration{Token: config.WHEPToken}))
+	}
+	if config.RTP {
+		host := config.RTPHost
+		if host == "" && len(config.NAT1To1IPs) > 0 {
+			host = config.NAT1To1IPs[0]
+		}
+		options = append(options, transcoder.WithRTP(transcoder.RTPConfiguration{
+			PortMin: uint16(config.RTPPortMin),
+			PortMax: uint16(config.RTPPortMax),
+			Host:    host,
+		}))
+	}
+	if config.SRTPush {
+		options = append(options, transcoder.WithSRTPush())
+	}
+
+	lis, err := net.Listen("tcp", config.Addr)
+	if err != nil {
+		return err
+	}
+
+	s := grpc.NewServer()
+
+	server := transcoder.NewTranscoderServer(webrtc.Configuration{
+		ICEServers: config.ICEServers,
+	}, options...)
+	api.RegisterTranscoderServer(s, server)
+	healthServer := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(s, healthServer)
+
+	var httpServer *http.Server
+	if config.HTTPAddr != "" {
+		httpServer = &http.Server{Addr: config.HTTPAddr, Handler: server.Handler()}
+		go func() {
+			zap.L().Info("starting http server", zap.String("addr", config.HTTPAddr))
+			if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+				zap.L().Error("http server failed", zap.Error(err))
+			}
+		}()
+	}
+
+	var rtmpListener net.Listener
+	if config.RTMPAddr != "" {
+		rtmpListener, err = net.Listen("tcp", config.RTMPAddr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			zap.L().Info("starting rtmp server", zap.String("addr", config.RTMPAddr))
+			if err := server.ServeRTMP(rtmpListener); !errors.Is(err, net.ErrClosed) {
+				zap.L().Error("rtmp server failed", zap.Error(err))
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if config.SRTAddr != "" {
+		ingest := transcoder.SRTIngest{
+			Address: config.SRTAddr,
+			Listen:  !config.SRTCaller,
+			SRTOptions: transcoder.SRTOptions{
+				Latency:    time.Duration(config.SRTLatency) * time.Millisecond,
+				Passphrase: config.SRTPassphrase,
+				StreamID:   config.SRTStreamID,
+			},
+		}
+		go func() {
+			zap.L().Info("starting srt ingest", zap.String("addr", config.SRTAddr), zap.Bool("caller", config.SRTCaller))
+			if err := server.IngestSRT(ctx, ingest); !errors.Is(err, context.Canceled) {
+				zap.L().Error("srt ingest failed", zap.Error(err))
+			}
+		}()
+	}
+
+	for _, source := range config.RTSPSources {
+		source := transcoder.RTSPSource{StreamID: source.StreamID, URL: source.URL, Transport: source.Transport}
+		if source.Transport == "" {
+			source.Transport = config.RTSPTransport
+		}
+		go func() {
+			zap.L().Info("starting rtsp ingest", zap.String("stream", source.StreamID))
+			if err := server.IngestRTSP(ctx, source); !errors.Is(err, context.Canceled) {
+				zap.L().Error("rtsp ingest failed", zap.String("stream", source.StreamID), zap.Error(err))
+			}
+		}()
+	}
+
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		<-sigs
+		zap.L().Info("shutting down transcoder server")
+		healthServer.Shutdown()
+		if httpServer != nil {
+			httpServer.Close()
+		}
+		if rtmpListener != nil {
+			rtmpListener.Close()
+		}
+		cancel()
+		s.GracefulStop()
+	}()
+
+	zap.L().Info("starting transcoder server", zap.String("addr", config.Addr), zap.Uint("udpPortMin", config.UDPPortMin), zap.Uint("udpPortMax", config.UDPPortMax))
+
+	return s.Serve(lis)
+}
@@ -0,0 +1,378 @@
+package av
+
+/*
+#cgo pkg-config: libavcodec libavformat libavutil
+#include <libavcodec/avcodec.h>
+#include <libavformat/avformat.h>
+#include <libavutil/dict.h>
+#include "mux.h"
+*/
+import "C"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+	"unsafe"
+
+	"github.com/mattn/go-pointer"
+	"github.com/pion/rtp"
+	"github.com/pion/rtpio/pkg/rtpio"
+	"github.com/pion/webrtc/v3"
+)
+
+var (
+	cmp4      = C.CString("mp4")
+	cmovflags = C.CString("movflags")
+	// the caller cuts the fragments, and the moov in the init segment has no samples.
+	cfragmentflags = C.CString("cmaf+frag_custom+empty_moov+default_base_moof")
+)
+
+// CMAFConfiguration sets how a CMAFMuxer splits its output. Segments start at keyframes, a keyframe is
+// requested once a segment reaches SegmentDuration. Each segment is written as fragments of up to
+// FragmentDuration, which can be served as low latency partial segments, or as a single fragment if
+// FragmentDuration is zero.
+type CMAFConfiguration struct {
+	SegmentDuration  time.Duration
+	FragmentDuration time.Duration
+	// Offset is added to the timestamps to place the track on a timeline shared with other tracks.
+	Offset time.Duration
+}
+
+// Fragment is a moof and mdat pair. The fragments of a segment are concatenated to form the segment.
+type Fragment struct {
+	Data            []byte
+	Start, Duration time.Duration
+	// Independent is set if the fragment starts with a keyframe.
+	Independent bool
+	// SegmentStart is set if the fragment is the first of a segment.
+	SegmentStart bool
+}
+
+// CMAFMuxer packages encoded packets as fragmented mp4 in memory, an init segment followed by fragments
+// that can be served as HLS or DASH segments.
+type CMAFMuxer struct {
+	config      CMAFConfiguration
+	source      encodedPacketReader
+	avformatctx *C.AVFormatContext
+	avioctx     *C.AVIOContext
+	opaque      unsafe.Pointer
+	stream      *C.AVStream
+	packet      *AVPacket
+	header      bool
+	codecs      string
+
+	// buf collects the output of the muxer until a fragment is cut.
+	buf bytes.Buffer
+
+	// the state of the current fragment and segment, times are in microseconds.
+	started       bool
+	pending       bool
+	fragment      Fragment
+	fragmentStart int64
+	segmentStart  int64
+	end           int64
+	requested     bool
+
+	onInit     func([]byte)
+	onFragment func(Fragment)
+}
+
+// NewCMAFMuxer creates a muxer reading from source, which is an *EncodeContext or a *Passthrough.
+func NewCMAFMuxer(config CMAFConfiguration, source encodedPacketReader) *CMAFMuxer {
+	return &CMAFMuxer{
+		config: config,
+		source: source,
+		packet: NewAVPacket(),
+	}
+}
+
+// OnInit sets a callback that is called with the init segment. It must be set before Run.
+func (c *CMAFMuxer) OnInit(f func([]byte)) {
+	c.onInit = f
+}
+
+// OnFragment sets a callback that is called with each fragment. It must be set before Run.
+func (c *CMAFMuxer) OnFragment(f func(Fragment)) {
+	c.onFragment = f
+}
+
+// Codecs returns the RFC 6381 codecs string of the track, for example avc1.42c01f, as used in HLS and
+// DASH manifests. It's valid once the init segment has been written, and empty if it's unknown.
+func (c *CMAFMuxer) Codecs() string {
+	return c.codecs
+}
+
+// Run packages the source until it ends. The muxer and the pipeline before it are freed when Run
+// returns.
+func (c *CMAFMuxer) Run() error {
+	defer c.close()
+
+	// the codec parameters are stored in the init segment.
+	c.source.useGlobalHeader()
+	if err := c.source.init(); err != nil {
+		return err
+	}
+	if err := c.open(); err != nil {
+		return err
+	}
+	if c.onInit != nil {
+		c.onInit(c.take())
+	}
+
+	for {
+		if err := c.source.ReadAVPacket(c.packet); err != nil {
+			if err != io.EOF {
+				return err
+			}
+			return c.flush(c.end)
+		}
+		if err := c.write(c.packet.packet); err != nil {
+			return err
+		}
+	}
+}
+
+//export goWriteFragmentFunc
+func goWriteFragmentFunc(opaque unsafe.Pointer, buf *C.uint8_t, bufsize C.int) C.int {
+	m := pointer.Restore(opaque).(*CMAFMuxer)
+	m.buf.Write(C.GoBytes(unsafe.Pointer(buf), bufsize))
+	return bufsize
+}
+
+func (c *CMAFMuxer) open() error {
+	outputformat := C.av_guess_format(cmp4, nil, nil)
+	if outputformat == nil {
+		return errors.New("failed to find mp4 output format")
+	}
+
+	buf := C.av_malloc(4096)
+	if buf == nil {
+		return errors.New("failed to allocate buffer")
+	}
+
+	c.opaque = pointer.Save(c)
+	c.avioctx = C.avio_alloc_context((*C.uchar)(buf), 4096, 1, c.opaque, nil, (*[0]byte)(C.cgoWriteFragmentFunc), nil)
+	if c.avioctx == nil {
+		C.av_free(buf)
+		return errors.New("failed to create avio context")
+	}
+
+	if averr := C.avformat_alloc_output_context2(&c.avformatctx, outputformat, nil, nil); averr < 0 {
+		return av_err("avformat_alloc_output_context2", averr)
+	}
+	c.avformatctx.pb = c.avioctx
+	c.avformatctx.flags |= C.AVFMT_FLAG_CUSTOM_IO
+
+	stream := C.avformat_new_stream(c.avformatctx, nil)
+	if stream == nil {
+		return errors.New("failed to create mp4 stream")
+	}
+	if err := c.source.parameters(stream.codecpar); err != nil {
+		return err
+	}
+	// a hint, the muxer may choose another time base when the header is written.
+	stream.time_base = c.source.timeBase()
+	c.stream = stream
+
+	var opts *C.AVDictionary
+	defer C.av_dict_free(&opts)
+	if averr := C.av_dict_set(&opts, cmovflags, cfragmentflags, 0); averr < 0 {
+		return av_err("av_dict_set", averr)
+	}
+
+	if averr := C.avformat_write_header(c.avformatctx, &opts); averr < 0 {
+		return av_err("avformat_write_header", averr)
+	}
+	c.header = true
+	C.avio_flush(c.avformatctx.pb)
+	c.codecs = codecsString(stream.codecpar)
+
+	return nil
+}
+
+// time converts a timestamp of the source to microseconds.
+func (c *CMAFMuxer) time(ts C.int64_t) int64 {
+	return int64(C.av_rescale_q(ts, c.source.timeBase(), C.av_make_q(1, 1000000)))
+}
+
+// write adds a packet to the current fragment, cutting the fragment first if it's full or if the packet
+// starts a segment.
+func (c *CMAFMuxer) write(pkt *C.AVPacket) error {
+	defer C.av_packet_unref(pkt)
+
+	ts := pkt.dts
+	if ts == C.AV_NOPTS_VALUE {
+		ts = pkt.pts
+	}
+	if ts == C.AV_NOPTS_VALUE {
+		// the muxer can't place the packet on the timeline.
+		return nil
+	}
+	t := c.time(ts)
+	key := pkt.flags&C.AV_PKT_FLAG_KEY != 0
+
+	if !c.started && !key {
+		// segments must start with a keyframe to be playable on their own.
+		c.source.requestKeyframe()
+		return nil
+	}
+
+	full := c.started && t-c.segmentStart >= c.config.SegmentDuration.Microseconds()
+	if full && !key && !c.requested {
+		c.source.requestKeyframe()
+		c.requested = true
+	}
+	segmentStart := !c.started || (full && key)
+	end := t + c.time(pkt.duration)
+	// fragments are cut before they'd exceed their duration, players rely on it for partial segments.
+	overflow := c.config.FragmentDuration > 0 && end-c.fragmentStart > c.config.FragmentDuration.Microseconds()
+	if c.pending && (segmentStart || overflow) {
+		if err := c.flush(t); err != nil {
+			return err
+		}
+	}
+	if !c.pending {
+		c.pending = true
+		c.fragmentStart = t
+		c.fragment = Fragment{
+			Start:        time.Duration(t)*time.Microsecond + c.config.Offset,
+			Independent:  key,
+			SegmentStart: segmentStart,
+		}
+	}
+	if segmentStart {
+		c.started = true
+		c.segmentStart = t
+		c.requested = false
+	}
+	if end > c.end {
+		c.end = end
+	}
+
+	C.av_packet_rescale_ts(pkt, c.source.timeBase(), c.stream.time_base)
+	if c.config.Offset != 0 {
+		offset := C.av_rescale_q(C.int64_t(c.config.Offset.Microseconds()), C.av_make_q(1, 1000000), c.stream.time_base)
+		if pkt.pts != C.AV_NOPTS_VALUE {
+			pkt.pts += offset
+		}
+		if pkt.dts != C.AV_NOPTS_VALUE {
+			pkt.dts += offset
+		}
+	}
+	pkt.stream_index = c.stream.index
+	if averr := C.av_write_frame(c.avformatctx, pkt); averr < 0 {
+		return av_err("av_write_frame", averr)
+	}
+	return nil
+}
+
+// flush cuts the current fragment, which ends at end.
+func (c *CMAFMuxer) flush(end int64) error {
+	if !c.pending {
+		return nil
+	}
+	c.pending = false
+	// with frag_custom, writing a nil packet writes the packets so far as a fragment.
+	if averr := C.av_write_frame(c.avformatctx, nil); averr < 0 {
+		return av_err("av_write_frame", averr)
+	}
+	C.avio_flush(c.avformatctx.pb)
+	c.fragment.Data = c.take()
+	c.fragment.Duration = time.Duration(end-c.fragmentStart) * time.Microsecond
+	if c.onFragment != nil {
+		c.onFragment(c.fragment)
+	}
+	return nil
+}
+
+// codecsString returns the RFC 6381 codecs string of a stream, or an empty string if it's unknown.
+func codecsString(codecpar *C.AVCodecParameters) string {
+	switch codecpar.codec_id {
+	case C.AV_CODEC_ID_H264:
+		extradata := C.GoBytes(unsafe.Pointer(codecpar.extradata), codecpar.extradata_size)
+		// the profile, constraints and level follow the nal header of the sps, or the version byte of
+		// an avcC box.
+		if len(extradata) >= 4 && extradata[0] == 1 {
+			return fmt.Sprintf("avc1.%02x%02x%02x", extradata[1], extradata[2], extradata[3])
+		}
+		for i := 0; i+6 < len(extradata); i++ {
+			if extradata[i] == 0 && extradata[i+1] == 0 && extradata[i+2] == 1 && extradata[i+3]&0x1f == 7 {
+				return fmt.Sprintf("avc1.%02x%02x%02x", extradata[i+4], extradata[i+5], extradata[i+6])
+			}
+		}
+	case C.AV_CODEC_ID_AAC:
+		// the audio object type is one more than the profile, AAC-LC by default.
+		if codecpar.profile >= 0 {
+			return fmt.Sprintf("mp4a.40.%d", codecpar.profile+1)
+		}
+		return "mp4a.40.2"
+	case C.AV_CODEC_ID_OPUS:
+		return "opus"
+	}
+	return ""
+}
+
+// take returns the output of the muxer since the last call.
+func (c *CMAFMuxer) take() []byte {
+	b := make([]byte, c.buf.Len())
+	copy(b, c.buf.Bytes())
+	c.buf.Reset()
+	return b
+}
+
+// close frees the muxer and the pipeline before it.
+func (c *CMAFMuxer) close() {
+	if c.avformatctx != nil {
+		if c.header {
+			// the trailer frees the muxer's state, its output isn't needed.
+			C.av_write_trailer(c.avformatctx)
+		}
+		C.avformat_free_context(c.avformatctx)
+		c.avformatctx = nil
+	}
+	if c.avioctx != nil {
+		C.av_freep(unsafe.Pointer(&c.avioctx.buffer))
+		C.avio_context_free(&c.avioctx)
+	}
+	if c.opaque != nil {
+		pointer.Unref(c.opaque)
+		c.opaque = nil
+	}
+	c.packet.Close()
+	c.source.close()
+}
+
+// CMAFTranscoder transcodes an rtp track and packages it as fragmented mp4, for example to serve it
+// over HLS. Closing the transcoder ends the track, Run returns once the last fragment is written.
+type CMAFTranscoder struct {
+	*CMAFMuxer
+	w       rtpio.RTPWriteCloser
+	decoder *DecodeContext
+}
+
+func NewCMAFTranscoder(from webrtc.RTPCodecParameters, to webrtc.RTPCodecCapability, config EncoderConfiguration, cmaf CMAFConfiguration) *CMAFTranscoder {
+	pr, pw := rtpio.RTPPipe()
+	decoder := NewDecoder(NewDemuxer(from, pr))
+	return &CMAFTranscoder{
+		CMAFMuxer: NewCMAFMuxer(cmaf, newEncoder(to, config, decoder)),
+		w:         pw,
+		decoder:   decoder,
+	}
+}
+
+func (t *CMAFTranscoder) WriteRTP(p *rtp.Packet) error {
+	return t.w.WriteRTP(p)
+}
+
+// Close ends the track.
+func (t *CMAFTranscoder) Close() error {
+	return t.w.Close()
+}
+
+// OnKeyframeRequest sets a callback that is called when the decoder needs a keyframe from the sender to
+// recover from loss. It must be set before the transcoder is run.
+func (t *CMAFTranscoder) OnKeyframeRequest(f func()) {
+	t.decoder.OnKeyframeRequest(f)
+}
@@ -9,22 +9,38 @@ import "C"
 import (
 	"errors"
 	"io"
-	"strings"
-	"unsafe"
-
-	"github.com/pion/webrtc/v3"
 )
 
+// decodedFrameReader produces frames as they are output by a decoder, either a *DecodeContext or
+// a *SplitOutput.
+type decodedFrameReader interface {
+	init() error
+	decoderContext() *C.AVCodecContext
+	ReadAVFrame(f *AVFrame) error
+	close()
+}
+
+// packetReader produces the packets of a single stream for the decoder, either a *DemuxContext or a
+// *FileSource.
+type packetReader interface {
+	init() error
+	// stream returns the stream that's read, it's valid after init.
+	stream() *C.AVStream
+	ReadAVPacket(p *AVPacket) error
+	close()
+}
+
 type DecodeContext struct {
-	codec      webrtc.RTPCodecParameters
 	decoderctx *C.AVCodecContext
 	pkt        *AVPacket
-	demuxer    *DemuxContext
+	demuxer    packetReader
+
+	onKeyframeRequest func()
 }
 
-func NewDecoder(codec webrtc.RTPCodecParameters, demuxer *DemuxContext) *DecodeContext {
+// NewDecoder creates a decoder reading from demuxer, which is a *DemuxContext or a *FileSource.
+func NewDecoder(demuxer packetReader) *DecodeContext {
 	return &DecodeContext{
-		codec:   codec,
 		pkt:     NewAVPacket(),
 		demuxer: demuxer,
 	}
@@ -32,62 +48,110 @@ func NewDecoder(codec webrtc.RTPCodecParameters, demuxer *DemuxContext) *DecodeC
 
 func (c *DecodeContext) init() error {
 	if err := c.demuxer.init(); err != nil {
+		c.pkt.Close()
 		return err
 	}
-
-	var decodercodec *C.AVCodec
-	var kind int32
-	if strings.HasPrefix(c.codec.MimeType, "video") {
-		kind = C.AVMEDIA_TYPE_VIDEO
-	} else if strings.HasPrefix(c.codec.MimeType, "audio") {
-		kind = C.AVMEDIA_TYPE_AUDIO
-	} else {
-		kind = C.AVMEDIA_TYPE_UNKNOWN
+	if err := c.open(); err != nil {
+		c.close()
+		return err
 	}
+	return nil
+}
 
-	ret := C.av_find_best_stream(c.demuxer.avformatctx, kind, -1, -1, &decodercodec, 0)
-	if ret < 0 {
-		return av_err("av_find_best_stream", ret)
+func (c *DecodeContext) open() error {
+	stream := c.demuxer.stream()
+
+	decodercodec := C.avcodec_find_decoder(stream.codecpar.codec_id)
+	if decodercodec == nil {
+		return errors.New("failed to find decoder")
 	}
 
-	decoderctx := C.avcodec_alloc_context3(decodercodec)
-	if decoderctx == nil {
+	c.decoderctx = C.avcodec_alloc_context3(decodercodec)
+	if c.decoderctx == nil {
 		return errors.New("failed to create decoder context")
 	}
 
-	if averr := C.avcodec_parameters_to_context(decoderctx, ((*[1 << 30]*C.AVStream)(unsafe.Pointer(c.demuxer.avformatctx.streams)))[ret].codecpar); averr < 0 {
+	if averr := C.avcodec_parameters_to_context(c.decoderctx, stream.codecpar); averr < 0 {
 		return av_err("avcodec_parameters_to_context", averr)
 	}
 
-	if averr := C.avcodec_open2(decoderctx, decodercodec, nil); averr < 0 {
+	c.decoderctx.pkt_timebase = stream.time_base
+
+	if averr := C.avcodec_open2(c.decoderctx, decodercodec, nil); averr < 0 {
 		return av_err("avcodec_open2", averr)
 	}
 
-	c.decoderctx = decoderctx
-
 	return nil
 }
 
+// OnKeyframeRequest sets a callback that is called when the decoder is missing reference frames, for
+// example due to packet loss, and needs a keyframe from the sender to recover. It must be set before
+// the decoder is read.
+func (c *DecodeContext) OnKeyframeRequest(f func()) {
+	c.onKeyframeRequest = f
+	if demuxer, ok := c.demuxer.(*DemuxContext); ok {
+		demuxer.onKeyframeRequest = f
+	}
+}
+
+func (c *DecodeContext) requestKeyframe() {
+	if c.onKeyframeRequest != nil {
+		c.onKeyframeRequest()
+	}
+}
+
+func (c *DecodeContext) decoderContext() *C.AVCodecContext {
+	return c.decoderctx
+}
+
+func (c *DecodeContext) configure(encoderctx *C.AVCodecContext) {
+	encoderctx.channels = c.decoderctx.channels
+	encoderctx.channel_layout = c.decoderctx.channel_layout
+	encoderctx.sample_fmt = c.decoderctx.sample_fmt
+	encoderctx.width = c.decoderctx.width
+	encoderctx.height = c.decoderctx.height
+	encoderctx.pix_fmt = c.decoderctx.pix_fmt
+}
+
 func (c *DecodeContext) ReadAVFrame(f *AVFrame) error {
 	if res := C.avcodec_receive_frame(c.decoderctx, f.frame); res < 0 {
 		if res == AVERROR(C.EAGAIN) {
-			err := c.demuxer.ReadAVPacket(c.pkt)
-			if err != nil && err != io.EOF {
+			pkt := c.pkt.packet
+			if err := c.demuxer.ReadAVPacket(c.pkt); err == io.EOF {
+				// a null packet drains the decoder.
+				pkt = nil
+			} else if err != nil {
+				c.close()
 				return err
 			}
 
-			if averr := C.avcodec_send_packet(c.decoderctx, c.pkt.packet); averr < 0 {
+			averr := C.avcodec_send_packet(c.decoderctx, pkt)
+			C.av_packet_unref(c.pkt.packet)
+			if averr == C.AVERROR_INVALIDDATA {
+				// the packet can't be decoded without its references, skip it until the next keyframe.
+				c.requestKeyframe()
+			} else if averr < 0 {
+				c.close()
 				return av_err("avcodec_send_packet", averr)
 			}
 
 			// try again.
 			return c.ReadAVFrame(f)
 		}
-		C.avcodec_free_context(&c.decoderctx)
-		if err := c.pkt.Close(); err != nil {
-			return err
-		}
+		c.close()
 		return av_err("failed to receive frame", res)
 	}
+	if f.frame.decode_error_flags != 0 || f.frame.flags&C.AV_FRAME_FLAG_CORRUPT != 0 {
+		c.requestKeyframe()
+	}
 	return nil
 }
+
+// close frees the decoder and the demuxer.
+func (c *DecodeContext) close() {
+	if c.decoderctx != nil {
+		C.avcodec_free_context(&c.decoderctx)
+	}
+	c.pkt.Close()
+	c.demuxer.close()
+}
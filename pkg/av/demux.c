@@ -2,6 +2,11 @@
 
 #include <stdint.h>
 
+int cgoReadSDPFunc(void *opaque, uint8_t *buf, int buf_size)
+{
+    return goReadSDPFunc(opaque, buf, buf_size);
+}
+
 int cgoReadPacketFunc(void *opaque, uint8_t *buf, int buf_size)
 {
     return goReadPacketFunc(opaque, buf, buf_size);
@@ -9,10 +9,11 @@ import "C"
 import (
 	"errors"
 	"io"
-	"os"
+	"net"
 	"unsafe"
 
 	"github.com/mattn/go-pointer"
+	"github.com/pion/rtcp"
 	"github.com/pion/rtpio/pkg/rtpio"
 	"github.com/pion/webrtc/v3"
 	"go.uber.org/zap"
@@ -21,16 +22,28 @@ import (
 type DemuxContext struct {
 	codec       webrtc.RTPCodecParameters
 	avformatctx *C.AVFormatContext
-	in          rtpio.RTPReader
-	sdpfile     *os.File
+	// sdpioctx is the io context the sdp was read from, replaced by avioctx once the input is open.
+	sdpioctx *C.AVIOContext
+	avioctx  *C.AVIOContext
+	opaque   unsafe.Pointer
+	in       rtpio.RTPReader
+	// sdp is the part of the sdp that hasn't been read yet.
+	sdp []byte
+
+	// onKeyframeRequest is called when the rtp demuxer asks the sender for a keyframe.
+	onKeyframeRequest func()
 }
 
 var (
+	csdp              = C.CString("sdp")
 	csdpflags         = C.CString("sdp_flags")
 	ccustomio         = C.CString("custom_io")
 	creorderqueuesize = C.CString("reorder_queue_size")
 )
 
+// sdpBufferSize is the size of the buffer the sdp is read through.
+const sdpBufferSize = 4096
+
 func NewDemuxer(codec webrtc.RTPCodecParameters, in rtpio.RTPReader) *DemuxContext {
 	return &DemuxContext{
 		codec: codec,
@@ -38,17 +51,26 @@ func NewDemuxer(codec webrtc.RTPCodecParameters, in rtpio.RTPReader) *DemuxConte
 	}
 }
 
+//export goReadSDPFunc
+func goReadSDPFunc(opaque unsafe.Pointer, buf *C.uint8_t, bufsize C.int) C.int {
+	d := pointer.Restore(opaque).(*DemuxContext)
+	if len(d.sdp) == 0 {
+		return C.AVERROR_EOF
+	}
+	n := copy((*[1 << 30]byte)(unsafe.Pointer(buf))[:bufsize:bufsize], d.sdp)
+	d.sdp = d.sdp[n:]
+	return C.int(n)
+}
+
 //export goReadPacketFunc
 func goReadPacketFunc(opaque unsafe.Pointer, buf *C.uint8_t, bufsize C.int) C.int {
 	d := pointer.Restore(opaque).(*DemuxContext)
 	p, err := d.in.ReadRTP()
 	if err != nil {
-		if err == io.EOF {
-			d.sdpfile.Close()
-			os.Remove(d.sdpfile.Name())
-		} else {
-			zap.L().Error("failed to read RTP packet", zap.Error(err))
+		if err == io.EOF || err == io.ErrClosedPipe {
+			return C.AVERROR_EOF
 		}
+		zap.L().Error("failed to read RTP packet", zap.Error(err))
 		return C.int(-1)
 	}
 
@@ -68,16 +90,38 @@ func goReadPacketFunc(opaque unsafe.Pointer, buf *C.uint8_t, bufsize C.int) C.in
 	return C.int(len(b))
 }
 
-
 //export goWriteRTCPPacketFunc
 func goWriteRTCPPacketFunc(opaque unsafe.Pointer, buf *C.uint8_t, bufsize C.int) C.int {
 	// this function is necessary: https://trac.ffmpeg.org/ticket/9670
+	d := pointer.Restore(opaque).(*DemuxContext)
+	if d.onKeyframeRequest == nil {
+		return bufsize
+	}
+	pkts, err := rtcp.Unmarshal(C.GoBytes(unsafe.Pointer(buf), bufsize))
+	if err != nil {
+		// ffmpeg also writes punch packets which aren't valid rtcp.
+		return bufsize
+	}
+	for _, pkt := range pkts {
+		switch pkt.(type) {
+		case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+			d.onKeyframeRequest()
+		}
+	}
 	return bufsize
 }
 
 func (c *DemuxContext) init() error {
-	avformatctx := C.avformat_alloc_context()
-	if avformatctx == nil {
+	if err := c.open(); err != nil {
+		c.close()
+		return err
+	}
+	return nil
+}
+
+func (c *DemuxContext) open() error {
+	c.avformatctx = C.avformat_alloc_context()
+	if c.avformatctx == nil {
 		return errors.New("failed to create format context")
 	}
 
@@ -90,15 +134,30 @@ func (c *DemuxContext) init() error {
 		return av_err("av_dict_set", averr)
 	}
 
-	sdpfile, err := NewTempSDP(c.codec)
-	if err != nil {
-		return err
-	}
+	// the sdp is read from memory so the filesystem isn't needed. the port doesn't matter, the packets are
+	// read from a custom io context.
+	c.sdp = []byte(NewSessionDescription(c.codec, net.IPv4(127, 0, 0, 1), 6000).Marshal())
+	c.opaque = pointer.Save(c)
 
-	cfilename := C.CString(sdpfile.Name())
-	defer C.free(unsafe.Pointer(cfilename))
+	sdpbuf := C.av_malloc(sdpBufferSize)
+	if sdpbuf == nil {
+		return errors.New("failed to allocate buffer")
+	}
+	c.sdpioctx = C.avio_alloc_context((*C.uchar)(sdpbuf), sdpBufferSize, 0, c.opaque, (*[0]byte)(C.cgoReadSDPFunc), nil, nil)
+	if c.sdpioctx == nil {
+		C.av_free(sdpbuf)
+		return errors.New("failed to allocate avio context")
+	}
+	c.avformatctx.pb = c.sdpioctx
+	// the io contexts are freed by close, not by libavformat.
+	c.avformatctx.flags |= C.AVFMT_FLAG_CUSTOM_IO
 
-	if averr := C.avformat_open_input(&avformatctx, cfilename, nil, &opts); averr < C.int(0) {
+	format := C.av_find_input_format(csdp)
+	if format == nil {
+		return errors.New("the sdp demuxer isn't available")
+	}
+	if averr := C.avformat_open_input(&c.avformatctx, nil, format, &opts); averr < C.int(0) {
+		// avformat_open_input frees the context on failure.
 		return av_err("avformat_open_input", averr)
 	}
 
@@ -107,36 +166,62 @@ func (c *DemuxContext) init() error {
 		return errors.New("failed to allocate buffer")
 	}
 
-	avioctx := C.avio_alloc_context((*C.uchar)(buf), 1500, 1, pointer.Save(c), (*[0]byte)(C.cgoReadPacketFunc), (*[0]byte)(C.cgoWriteRTCPPacketFunc), nil)
-	if avioctx == nil {
+	c.avioctx = C.avio_alloc_context((*C.uchar)(buf), 1500, 1, c.opaque, (*[0]byte)(C.cgoReadPacketFunc), (*[0]byte)(C.cgoWriteRTCPPacketFunc), nil)
+	if c.avioctx == nil {
+		C.av_free(buf)
 		return errors.New("failed to allocate avio context")
 	}
 
-	avformatctx.pb = avioctx
+	c.avformatctx.pb = c.avioctx
 
-	if averr := C.avformat_find_stream_info(avformatctx, nil); averr < C.int(0) {
+	if averr := C.avformat_find_stream_info(c.avformatctx, nil); averr < C.int(0) {
 		return av_err("avformat_find_stream_info", averr)
 	}
 
-	c.avformatctx = avformatctx
-	c.sdpfile = sdpfile
-
 	return nil
 }
 
+// streamAt returns the i-th stream of a format context.
+func streamAt(avformatctx *C.AVFormatContext, i int) *C.AVStream {
+	return ((*[1 << 30]*C.AVStream)(unsafe.Pointer(avformatctx.streams)))[i]
+}
+
+// stream returns the only stream of the sdp.
+func (c *DemuxContext) stream() *C.AVStream {
+	return streamAt(c.avformatctx, 0)
+}
+
 func (c *DemuxContext) ReadAVPacket(p *AVPacket) error {
+	if c.avformatctx == nil {
+		return io.EOF
+	}
 	averr := C.av_read_frame(c.avformatctx, p.packet)
 	if averr < 0 {
-		err := av_err("av_read_frame", averr)
-		if err == io.EOF {
-			// TODO: is this necessary? does ffmpeg do it automatically?
-			p.packet = nil
-		}
-		C.avformat_free_context(c.avformatctx)
-		if err := c.sdpfile.Close(); err != nil {
-			return err
-		}
-		return err
+		c.close()
+		return av_err("av_read_frame", averr)
 	}
 	return nil
 }
+
+// close frees the format context and closes the input so writers don't block. It's safe to call more
+// than once.
+func (c *DemuxContext) close() {
+	if c.avformatctx != nil {
+		C.avformat_close_input(&c.avformatctx)
+	}
+	if c.sdpioctx != nil {
+		C.av_freep(unsafe.Pointer(&c.sdpioctx.buffer))
+		C.avio_context_free(&c.sdpioctx)
+	}
+	if c.avioctx != nil {
+		C.av_freep(unsafe.Pointer(&c.avioctx.buffer))
+		C.avio_context_free(&c.avioctx)
+	}
+	if c.opaque != nil {
+		pointer.Unref(c.opaque)
+		c.opaque = nil
+	}
+	if closer, ok := c.in.(io.Closer); ok {
+		closer.Close()
+	}
+}
@@ -3,9 +3,11 @@
 
 #include <stdint.h>
 
+extern int goReadSDPFunc(void *, uint8_t *, int);
 extern int goReadPacketFunc(void *, uint8_t *, int);
 extern int goWriteRTCPPacketFunc(void *, uint8_t *, int);
 
+int cgoReadSDPFunc(void *, uint8_t *, int);
 int cgoReadPacketFunc(void *, uint8_t *, int);
 int cgoWriteRTCPPacketFunc(void *, uint8_t *, int);
 
@@ -8,33 +8,146 @@ package av
 import "C"
 import (
 	"errors"
+	"fmt"
 	"io"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+	"unsafe"
 
 	"github.com/pion/webrtc/v3"
 )
 
+// EncoderConfiguration controls the output of the encoder. Zero values use the encoder defaults.
+type EncoderConfiguration struct {
+	// Bitrate is the target bitrate in bits per second.
+	Bitrate int64
+	// MaxBitrate caps the bitrate in bits per second.
+	MaxBitrate int64
+	// Width and Height are the output resolution. If only one is set, the other is derived from the
+	// input aspect ratio.
+	Width, Height int
+	// ScaleMode determines how the input is fit to the output resolution.
+	ScaleMode ScaleMode
+	// Framerate is the maximum output frame rate, frames above this rate are dropped.
+	Framerate float64
+	// KeyframeInterval is the maximum number of frames between keyframes.
+	KeyframeInterval int
+	// Profile is the codec profile, for example "baseline" or "high" for H.264.
+	Profile string
+}
+
+// frameReader is a pipeline stage that produces raw frames for the encoder.
+type frameReader interface {
+	init() error
+	// configure copies the output format of the stage to the encoder.
+	configure(encoderctx *C.AVCodecContext)
+	ReadAVFrame(f *AVFrame) error
+	// close frees the stage and the stages before it.
+	close()
+}
+
 type EncodeContext struct {
-	codec        webrtc.RTPCodecCapability
-	encoderctx   *C.AVCodecContext
-	frame        *AVFrame
-	decoder      *DecodeContext
+	codec      webrtc.RTPCodecCapability
+	config     EncoderConfiguration
+	encoderctx *C.AVCodecContext
+	frame      *AVFrame
+	source     frameReader
+	nextpts    int64
+
+	// target is the bitrate requested by SetBitrate, applied on the encoding goroutine.
+	target int64
+	// adaptive is set by AdaptBitrate, the encoder is opened at initialBitrate so SetBitrate applies.
+	adaptive       bool
+	initialBitrate int64
+	// keyframe is set to one by ForceKeyframe.
+	keyframe   int32
+	reconfigAt time.Time
+	// pending holds the packets drained from the encoder when it's reopened.
+	pending []*C.AVPacket
+
+	// globalHeader is set by muxers that store the codec parameters in the container header.
+	globalHeader bool
 }
 
-func NewEncoder(codec webrtc.RTPCodecCapability, decoder *DecodeContext) *EncodeContext {
+const (
+	// minBitrate is the lowest bitrate SetBitrate will configure.
+	minBitrate = 50 * 1000
+	// reconfigThreshold is the relative change in bitrate needed to reconfigure the encoder.
+	reconfigThreshold = 0.1
+	// reconfigInterval limits how often the bitrate is changed in place.
+	reconfigInterval = time.Second
+	// reopenInterval limits how often an encoder that can't change bitrate in place is reopened,
+	// which forces a keyframe.
+	reopenInterval = 5 * time.Second
+)
+
+var (
+	cpreset      = C.CString("preset")
+	cultrafast   = C.CString("ultrafast")
+	ctune        = C.CString("tune")
+	czerolatency = C.CString("zerolatency")
+	cprofile     = C.CString("profile")
+	cforcedidr   = C.CString("forced-idr")
+	cone         = C.CString("1")
+)
+
+// NewEncoder creates an encoder reading from source, which is a *DecodeContext, *ScaleContext or *ResampleContext.
+func NewEncoder(codec webrtc.RTPCodecCapability, config EncoderConfiguration, source frameReader) *EncodeContext {
 	return &EncodeContext{
-		codec:   codec,
-		frame:   NewAVFrame(),
-		decoder: decoder,
+		codec:  codec,
+		config: config,
+		frame:  NewAVFrame(),
+		source: source,
 	}
 }
 
 func (c *EncodeContext) init() error {
-	if err := c.decoder.init(); err != nil {
+	if err := c.source.init(); err != nil {
+		c.close()
 		return err
 	}
+	bitrate := c.config.Bitrate
+	if c.adaptive && bitrate == 0 {
+		bitrate = c.initialBitrate
+	}
+	if err := c.open(bitrate); err != nil {
+		c.close()
+		return err
+	}
+	return nil
+}
 
-	decoderctx := c.decoder.decoderctx
+// AdaptBitrate opens the encoder in a rate control mode that follows SetBitrate, starting at initial if
+// the configuration has no bitrate. Without it, encoders such as libx264 default to a constant quality
+// that ignores bitrate changes. It must be called before the first packet is read.
+func (c *EncodeContext) AdaptBitrate(initial int64) {
+	c.adaptive = true
+	c.initialBitrate = initial
+}
+
+// isLibx264 returns true if the encoder is libx264, which changes bitrate in place.
+func (c *EncodeContext) isLibx264() bool {
+	return C.GoString(c.encoderctx.codec.name) == "libx264"
+}
 
+// setRateControl sets the bitrate of the encoder. Adaptive libx264 encoders also cap the rate at the
+// bitrate with a one second buffer, so changes take effect within a second instead of being averaged
+// over the whole stream.
+func (c *EncodeContext) setRateControl(bitrate int64) {
+	if bitrate <= 0 {
+		return
+	}
+	c.encoderctx.bit_rate = C.int64_t(bitrate)
+	if c.adaptive && c.isLibx264() {
+		c.encoderctx.rc_max_rate = C.int64_t(bitrate)
+		c.encoderctx.rc_buffer_size = C.int(bitrate)
+	}
+}
+
+// open creates the encoder context with the given bitrate.
+func (c *EncodeContext) open(bitrate int64) error {
 	encodercodec := C.avcodec_find_encoder(AvCodec[c.codec.MimeType])
 	if encodercodec == nil {
 		return errors.New("failed to start encoder")
@@ -44,54 +157,226 @@ func (c *EncodeContext) init() error {
 	if encoderctx == nil {
 		return errors.New("failed to create encoder context")
 	}
+	c.encoderctx = encoderctx
 
-	encoderctx.channels = decoderctx.channels
-	encoderctx.channel_layout = decoderctx.channel_layout
 	encoderctx.sample_rate = C.int(c.codec.ClockRate)
-	encoderctx.sample_fmt = decoderctx.sample_fmt
-	encoderctx.width = decoderctx.width
-	encoderctx.height = decoderctx.height
-	encoderctx.pix_fmt = C.AV_PIX_FMT_YUV420P
 	encoderctx.time_base = C.av_make_q(C.int(1), C.int(c.codec.ClockRate))
+	c.source.configure(encoderctx)
+
+	if c.config.MaxBitrate > 0 {
+		// rate control needs a buffer to enforce the max rate, use one second's worth.
+		encoderctx.rc_max_rate = C.int64_t(c.config.MaxBitrate)
+		encoderctx.rc_buffer_size = C.int(c.config.MaxBitrate)
+	}
+	// libx264 uses average bitrate rate control if the bitrate is set when it's opened, which is the
+	// only mode it can change the bitrate of.
+	c.setRateControl(bitrate)
+	if c.config.Framerate > 0 {
+		encoderctx.framerate = C.av_make_q(C.int(math.Round(c.config.Framerate*1000)), C.int(1000))
+	}
+	if c.config.KeyframeInterval > 0 {
+		encoderctx.gop_size = C.int(c.config.KeyframeInterval)
+	}
+	if c.globalHeader {
+		encoderctx.flags |= C.AV_CODEC_FLAG_GLOBAL_HEADER
+	}
 
 	var opts *C.AVDictionary
 	defer C.av_dict_free(&opts)
 
-	if c.codec.MimeType == webrtc.MimeTypeH264 {
-		if averr := C.av_dict_set(&opts, C.CString("preset"), C.CString("ultrafast"), 0); averr < 0 {
+	switch c.codec.MimeType {
+	case webrtc.MimeTypeH264:
+		if averr := C.av_dict_set(&opts, cpreset, cultrafast, 0); averr < 0 {
 			return av_err("av_dict_set", averr)
 		}
-		if averr := C.av_dict_set(&opts, C.CString("tune"), C.CString("zerolatency"), 0); averr < 0 {
+		if averr := C.av_dict_set(&opts, ctune, czerolatency, 0); averr < 0 {
 			return av_err("av_dict_set", averr)
 		}
-		if averr := C.av_dict_set(&opts, C.CString("profile"), C.CString("baseline"), 0); averr < 0 {
+		// forced keyframes must be idr frames so receivers can start decoding from them.
+		if averr := C.av_dict_set(&opts, cforcedidr, cone, 0); averr < 0 {
 			return av_err("av_dict_set", averr)
 		}
+		profile := c.config.Profile
+		if profile == "" {
+			// baseline is the only profile every WebRTC client is guaranteed to decode.
+			profile = "baseline"
+		}
+		if err := setStringOption(&opts, cprofile, profile); err != nil {
+			return err
+		}
+	case webrtc.MimeTypeH265:
+		if c.config.Profile != "" {
+			if err := setStringOption(&opts, cprofile, c.config.Profile); err != nil {
+				return err
+			}
+		}
+	case webrtc.MimeTypeVP8, webrtc.MimeTypeVP9:
+		if c.config.Profile != "" {
+			// libvpx profiles are numeric.
+			profile, err := strconv.Atoi(c.config.Profile)
+			if err != nil {
+				return fmt.Errorf("invalid profile %q for %s", c.config.Profile, c.codec.MimeType)
+			}
+			encoderctx.profile = C.int(profile)
+		}
 	}
 
 	if averr := C.avcodec_open2(encoderctx, encodercodec, &opts); averr < 0 {
 		return av_err("avcodec_open2", averr)
 	}
 
-	encoderctx.rc_buffer_size = 4 * 1000 * 1000
-	encoderctx.rc_max_rate = 20 * 1000 * 1000
-	encoderctx.rc_min_rate = 1 * 1000 * 1000
+	return nil
+}
 
-	c.encoderctx = encoderctx
+func setStringOption(opts **C.AVDictionary, key *C.char, value string) error {
+	cvalue := C.CString(value)
+	defer C.free(unsafe.Pointer(cvalue))
+	if averr := C.av_dict_set(opts, key, cvalue, 0); averr < 0 {
+		return av_err("av_dict_set", averr)
+	}
+	return nil
+}
+
+// SetBitrate requests a new target bitrate in bits per second, for example from a bandwidth estimate.
+// The bitrate is clamped to the configured bitrate and applied before the next frame is encoded.
+func (c *EncodeContext) SetBitrate(bitrate int64) {
+	if c.config.Bitrate > 0 && bitrate > c.config.Bitrate {
+		bitrate = c.config.Bitrate
+	}
+	if c.config.MaxBitrate > 0 && bitrate > c.config.MaxBitrate {
+		bitrate = c.config.MaxBitrate
+	}
+	if bitrate < minBitrate {
+		bitrate = minBitrate
+	}
+	atomic.StoreInt64(&c.target, bitrate)
+}
+
+// reconfigure applies the target bitrate if it has changed enough. libx264 picks up bitrate changes on
+// the fly if it was opened with a bitrate, other encoders are drained and reopened.
+func (c *EncodeContext) reconfigure() error {
+	target := atomic.LoadInt64(&c.target)
+	current := int64(c.encoderctx.bit_rate)
+	if target == 0 || math.Abs(float64(target-current)) <= reconfigThreshold*float64(current) {
+		return nil
+	}
+
+	inplace := c.isLibx264()
+	interval := reopenInterval
+	if inplace {
+		interval = reconfigInterval
+	}
+	if time.Since(c.reconfigAt) < interval {
+		return nil
+	}
+	c.reconfigAt = time.Now()
+
+	if inplace {
+		c.setRateControl(target)
+		return nil
+	}
 
+	if res := C.avcodec_send_frame(c.encoderctx, nil); res < 0 {
+		return av_err("avcodec_send_frame", res)
+	}
+	for {
+		p := C.av_packet_alloc()
+		if p == nil {
+			return errors.New("failed to allocate packet")
+		}
+		if res := C.avcodec_receive_packet(c.encoderctx, p); res < 0 {
+			C.av_packet_free(&p)
+			if res == C.AVERROR_EOF {
+				break
+			}
+			return av_err("avcodec_receive_packet", res)
+		}
+		c.pending = append(c.pending, p)
+	}
+	C.avcodec_free_context(&c.encoderctx)
+	return c.open(target)
+}
+
+func (c *EncodeContext) useGlobalHeader() {
+	c.globalHeader = true
+}
+
+func (c *EncodeContext) parameters(codecpar *C.AVCodecParameters) error {
+	if averr := C.avcodec_parameters_from_context(codecpar, c.encoderctx); averr < 0 {
+		return av_err("avcodec_parameters_from_context", averr)
+	}
 	return nil
 }
 
+func (c *EncodeContext) timeBase() C.AVRational {
+	return c.encoderctx.time_base
+}
+
+func (c *EncodeContext) codecType() int32 {
+	return c.encoderctx.codec_type
+}
+
+func (c *EncodeContext) requestKeyframe() {
+	c.ForceKeyframe()
+}
+
+// ForceKeyframe makes the next encoded frame a keyframe, for example when a receiver sends a PLI or FIR.
+func (c *EncodeContext) ForceKeyframe() {
+	atomic.StoreInt32(&c.keyframe, 1)
+}
+
+// dropFrame returns true if the frame would exceed the configured frame rate.
+func (c *EncodeContext) dropFrame(pts int64) bool {
+	if c.config.Framerate <= 0 || c.encoderctx.codec_type != C.AVMEDIA_TYPE_VIDEO {
+		return false
+	}
+	if pts < c.nextpts {
+		return true
+	}
+	interval := int64(float64(c.codec.ClockRate) / c.config.Framerate)
+	c.nextpts += interval
+	if c.nextpts <= pts {
+		c.nextpts = pts + interval
+	}
+	return false
+}
+
 func (c *EncodeContext) ReadAVPacket(p *AVPacket) error {
+	if len(c.pending) > 0 {
+		// the encoder was reopened, return the packets drained from the previous one first.
+		C.av_packet_unref(p.packet)
+		C.av_packet_move_ref(p.packet, c.pending[0])
+		C.av_packet_free(&c.pending[0])
+		c.pending = c.pending[1:]
+		return nil
+	}
 	if res := C.avcodec_receive_packet(c.encoderctx, p.packet); res < 0 {
 		if res == AVERROR(C.EAGAIN) {
-			err := c.decoder.ReadAVFrame(c.frame)
-			if err != nil && err != io.EOF {
+			err := c.source.ReadAVFrame(c.frame)
+			if err == io.EOF {
+				// drain the encoder.
+				if res := C.avcodec_send_frame(c.encoderctx, nil); res < 0 {
+					c.close()
+					return av_err("avcodec_send_frame", res)
+				}
+				return c.ReadAVPacket(p)
+			} else if err != nil {
+				c.close()
 				return err
 			}
 
-			if c.frame.frame.pts != C.AV_NOPTS_VALUE {
+			if c.frame.frame.pts != C.AV_NOPTS_VALUE && !c.dropFrame(int64(c.frame.frame.pts)) {
+				if err := c.reconfigure(); err != nil {
+					c.close()
+					return err
+				}
+				if atomic.CompareAndSwapInt32(&c.keyframe, 1, 0) {
+					c.frame.frame.pict_type = C.AV_PICTURE_TYPE_I
+				} else {
+					c.frame.frame.pict_type = C.AV_PICTURE_TYPE_NONE
+				}
 				if res := C.avcodec_send_frame(c.encoderctx, c.frame.frame); res < 0 {
+					c.close()
 					return av_err("avcodec_send_frame", res)
 				}
 			}
@@ -99,11 +384,21 @@ func (c *EncodeContext) ReadAVPacket(p *AVPacket) error {
 			// try again.
 			return c.ReadAVPacket(p)
 		}
-		C.avcodec_free_context(&c.encoderctx)
-		if err := c.frame.Close(); err != nil {
-			return err
-		}
+		c.close()
 		return av_err("avcodec_receive_packet", res)
 	}
 	return nil
 }
+
+// close frees the encoder and the stages before it. It's safe to call more than once.
+func (c *EncodeContext) close() {
+	if c.encoderctx != nil {
+		C.avcodec_free_context(&c.encoderctx)
+	}
+	for i := range c.pending {
+		C.av_packet_free(&c.pending[i])
+	}
+	c.pending = nil
+	c.frame.Close()
+	c.source.close()
+}
@@ -24,4 +24,4 @@ func av_err(prefix string, averr C.int) error {
 	b := make([]byte, errlen)
 	C.av_strerror(averr, (*C.char)(unsafe.Pointer(&b[0])), C.size_t(errlen))
 	return fmt.Errorf("%s: %s (%d)", prefix, string(b[:bytes.Index(b, []byte{0})]), averr)
-}
\ No newline at end of file
+}
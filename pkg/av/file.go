@@ -0,0 +1,174 @@
+package av
+
+/*
+#cgo pkg-config: libavcodec libavformat
+#include <libavcodec/avcodec.h>
+#include <libavformat/avformat.h>
+*/
+import "C"
+import (
+	"io"
+	"unsafe"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// FileSource demuxes one stream of a container file, for example ivf, ogg, mp4, webm or mpeg-ts, so it
+// can be decoded like an rtp input. The format is probed from the file contents.
+type FileSource struct {
+	path        string
+	kind        int32
+	avformatctx *C.AVFormatContext
+	index       C.int
+}
+
+// NewFileSource creates a source that reads the best stream of the given kind from the file at path.
+func NewFileSource(path string, kind webrtc.RTPCodecType) *FileSource {
+	mediatype := int32(C.AVMEDIA_TYPE_UNKNOWN)
+	switch kind {
+	case webrtc.RTPCodecTypeVideo:
+		mediatype = C.AVMEDIA_TYPE_VIDEO
+	case webrtc.RTPCodecTypeAudio:
+		mediatype = C.AVMEDIA_TYPE_AUDIO
+	}
+	return &FileSource{
+		path: path,
+		kind: mediatype,
+	}
+}
+
+func (c *FileSource) init() error {
+	if err := c.open(); err != nil {
+		c.close()
+		return err
+	}
+	return nil
+}
+
+func (c *FileSource) open() error {
+	cpath := C.CString(c.path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	if averr := C.avformat_open_input(&c.avformatctx, cpath, nil, nil); averr < 0 {
+		// avformat_open_input frees the context on failure.
+		return av_err("avformat_open_input", averr)
+	}
+
+	if averr := C.avformat_find_stream_info(c.avformatctx, nil); averr < 0 {
+		return av_err("avformat_find_stream_info", averr)
+	}
+
+	index := C.av_find_best_stream(c.avformatctx, c.kind, -1, -1, nil, 0)
+	if index < 0 {
+		return av_err("av_find_best_stream", index)
+	}
+	c.index = index
+
+	return nil
+}
+
+func (c *FileSource) stream() *C.AVStream {
+	return streamAt(c.avformatctx, int(c.index))
+}
+
+// ReadAVPacket reads the next packet of the selected stream, packets of other streams are skipped.
+func (c *FileSource) ReadAVPacket(p *AVPacket) error {
+	if c.avformatctx == nil {
+		return io.EOF
+	}
+	for {
+		if averr := C.av_read_frame(c.avformatctx, p.packet); averr < 0 {
+			c.close()
+			return av_err("av_read_frame", averr)
+		}
+		if p.packet.stream_index == c.index {
+			return nil
+		}
+		C.av_packet_unref(p.packet)
+	}
+}
+
+// close closes the file. It's safe to call more than once.
+func (c *FileSource) close() {
+	if c.avformatctx != nil {
+		C.avformat_close_input(&c.avformatctx)
+	}
+}
+
+// encodedPacketReader produces the packets that are written to a file, either an *EncodeContext or a
+// *Passthrough.
+type encodedPacketReader interface {
+	// useGlobalHeader is called before init if the container stores the codec parameters in its header.
+	useGlobalHeader()
+	init() error
+	// parameters copies the codec parameters of the packets, it's valid after init.
+	parameters(codecpar *C.AVCodecParameters) error
+	timeBase() C.AVRational
+	// codecType is the AVMediaType of the packets, it's valid after init.
+	codecType() int32
+	// requestKeyframe asks for a keyframe so a new file can be started.
+	requestKeyframe()
+	ReadAVPacket(p *AVPacket) error
+	close()
+}
+
+// Passthrough reads the packets of a demuxed stream without transcoding them, for example to record a
+// track as it was published.
+type Passthrough struct {
+	demuxer packetReader
+
+	onKeyframeRequest func()
+}
+
+// NewPassthrough creates a stage reading from demuxer, which is a *DemuxContext or a *FileSource.
+func NewPassthrough(demuxer packetReader) *Passthrough {
+	return &Passthrough{demuxer: demuxer}
+}
+
+// OnKeyframeRequest sets a callback that is called when a keyframe is needed from the sender, either
+// to start a file or because the rtp demuxer lost packets. It must be set before the stage is read.
+func (c *Passthrough) OnKeyframeRequest(f func()) {
+	c.onKeyframeRequest = f
+	if demuxer, ok := c.demuxer.(*DemuxContext); ok {
+		demuxer.onKeyframeRequest = f
+	}
+}
+
+func (c *Passthrough) useGlobalHeader() {
+	// the codec parameters are copied from the input as they are.
+}
+
+func (c *Passthrough) init() error {
+	return c.demuxer.init()
+}
+
+func (c *Passthrough) parameters(codecpar *C.AVCodecParameters) error {
+	if averr := C.avcodec_parameters_copy(codecpar, c.demuxer.stream().codecpar); averr < 0 {
+		return av_err("avcodec_parameters_copy", averr)
+	}
+	// the tag of the input container may not be valid in the output container.
+	codecpar.codec_tag = 0
+	return nil
+}
+
+func (c *Passthrough) timeBase() C.AVRational {
+	return c.demuxer.stream().time_base
+}
+
+func (c *Passthrough) codecType() int32 {
+	return c.demuxer.stream().codecpar.codec_type
+}
+
+func (c *Passthrough) requestKeyframe() {
+	if c.onKeyframeRequest != nil {
+		c.onKeyframeRequest()
+	}
+}
+
+func (c *Passthrough) ReadAVPacket(p *AVPacket) error {
+	return c.demuxer.ReadAVPacket(p)
+}
+
+func (c *Passthrough) close() {
+	c.demuxer.close()
+}
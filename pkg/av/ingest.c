@@ -0,0 +1,13 @@
+#include "ingest.h"
+
+#include <stdint.h>
+
+int cgoInterruptFunc(void *opaque)
+{
+    return goInterruptFunc(opaque);
+}
+
+int cgoWriteIngestPacketFunc(void *opaque, uint8_t *buf, int buf_size)
+{
+    return goWriteIngestPacketFunc(opaque, buf, buf_size);
+}
\ No newline at end of file
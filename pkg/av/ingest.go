@@ -0,0 +1,577 @@
+package av
+
+/*
+#cgo pkg-config: libavcodec libavformat libavutil
+#include <libavcodec/avcodec.h>
+#include <libavformat/avformat.h>
+#include <libavutil/mem.h>
+#include <string.h>
+#include "ingest.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/mattn/go-pointer"
+	"github.com/pion/rtp"
+	"github.com/pion/rtpio/pkg/rtpio"
+	"github.com/pion/sdp"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+var (
+	crtpflags     = C.CString("rtpflags")
+	cskiprtcp     = C.CString("skip_rtcp")
+	caacadtstoasc = C.CString("aac_adtstoasc")
+)
+
+const (
+	// ingestReportInterval is how often a sender report is generated for each stream, in media time.
+	ingestReportInterval = time.Second
+	ingestPacketMTU      = 1200
+	ingestSDPSize        = 16 << 10
+)
+
+// staticPayloadTypes are the codecs of the static payload types the rtp muxer uses, their sdp has no
+// rtpmap.
+var staticPayloadTypes = map[uint8]webrtc.RTPCodecCapability{
+	0:  {MimeType: webrtc.MimeTypePCMU, ClockRate: 8000, Channels: 1},
+	8:  {MimeType: webrtc.MimeTypePCMA, ClockRate: 8000, Channels: 1},
+	9:  {MimeType: webrtc.MimeTypeG722, ClockRate: 8000, Channels: 1},
+	14: {MimeType: "audio/MPA", ClockRate: 90000},
+}
+
+// Ingest demuxes the audio and video streams of a live input, for example mpeg-ts over srt, and
+// packetizes each one to rtp as it is so they can be published like WebRTC tracks. The streams are
+// synchronized by generated sender reports.
+type Ingest struct {
+	url, format string
+	options     map[string]string
+	avformatctx *C.AVFormatContext
+	opaque      unsafe.Pointer
+	packet      *AVPacket
+	closed      int32
+
+	// streams are the streams of the input by index, nil if the stream is skipped.
+	streams  []*IngestStream
+	onStream func(*IngestStream)
+
+	// start is the wall clock time of the first packet, base is its time on the input timeline in
+	// microseconds.
+	start time.Time
+	base  int64
+}
+
+// IngestStream is a stream of an Ingest, packetized to rtp.
+type IngestStream struct {
+	ingest *Ingest
+	kind   webrtc.RTPCodecType
+	codec  webrtc.RTPCodecParameters
+
+	// bsf converts the packets to a format the rtp muxer supports, it's nil if they're supported as they are.
+	bsf *C.AVBSFContext
+	// the rtp muxer, it's created with the first packet since some codec parameters are only known then.
+	avformatctx *C.AVFormatContext
+	avioctx     *C.AVIOContext
+	opaque      unsafe.Pointer
+	timeBase    C.AVRational
+
+	r rtpio.RTPReadCloser
+	w rtpio.RTPWriteCloser
+
+	// at is the time of the packet being muxed on the input timeline since the start, in microseconds.
+	at             int64
+	reportedAt     int64
+	reported       bool
+	onSenderReport func(ntp time.Time, rtpTime uint32)
+}
+
+// NewIngest creates an ingest reading from url. The format is probed if it's empty, live inputs should
+// set it, for example to mpegts.
+func NewIngest(url, format string) *Ingest {
+	return &Ingest{
+		url:    url,
+		format: format,
+		packet: NewAVPacket(),
+	}
+}
+
+//export goInterruptFunc
+func goInterruptFunc(opaque unsafe.Pointer) C.int {
+	c := pointer.Restore(opaque).(*Ingest)
+	return C.int(atomic.LoadInt32(&c.closed))
+}
+
+// RTSPTimeoutOption is the name of the RTSP socket timeout option, in microseconds. FFmpeg 5 renamed it
+// from stimeout to timeout, which was the timeout of listen mode before.
+func RTSPTimeoutOption() string {
+	return rtspTimeoutOption(C.LIBAVFORMAT_VERSION_MAJOR)
+}
+
+// rtspTimeoutOption returns the name of the RTSP socket timeout option of a libavformat major version.
+func rtspTimeoutOption(major int) string {
+	if major >= 59 {
+		return "timeout"
+	}
+	return "stimeout"
+}
+
+// FormatSupported returns true if FFmpeg was built with the input format, for example rtsp.
+func FormatSupported(format string) bool {
+	cformat := C.CString(format)
+	defer C.free(unsafe.Pointer(cformat))
+	return C.av_find_input_format(cformat) != nil
+}
+
+// ProtocolSupported returns true if FFmpeg was built with the input protocol, for example srt, which
+// needs libsrt.
+func ProtocolSupported(protocol string) bool {
+	var opaque unsafe.Pointer
+	for {
+		name := C.avio_enum_protocols(&opaque, 0)
+		if name == nil {
+			return false
+		}
+		if C.GoString(name) == protocol {
+			return true
+		}
+	}
+}
+
+// SetOption sets an option of the input format or protocol, for example rtsp_transport. It must be set
+// before Open.
+func (c *Ingest) SetOption(key, value string) {
+	if c.options == nil {
+		c.options = make(map[string]string)
+	}
+	c.options[key] = value
+}
+
+// OnStream sets a callback that is called when a stream starts, before its first packet is written. It
+// must be set before Run.
+func (c *Ingest) OnStream(f func(*IngestStream)) {
+	c.onStream = f
+}
+
+// Open opens the input, which waits for a connection if it's a listener. The ingest is freed if it
+// fails.
+func (c *Ingest) Open() error {
+	if err := c.open(); err != nil {
+		c.close()
+		return err
+	}
+	return nil
+}
+
+func (c *Ingest) open() error {
+	c.avformatctx = C.avformat_alloc_context()
+	if c.avformatctx == nil {
+		return errors.New("failed to allocate format context")
+	}
+	// the callback interrupts blocking reads when the ingest is closed.
+	c.opaque = pointer.Save(c)
+	c.avformatctx.interrupt_callback.callback = (*[0]byte)(C.cgoInterruptFunc)
+	c.avformatctx.interrupt_callback.opaque = c.opaque
+
+	var format *C.AVInputFormat
+	if c.format != "" {
+		cformat := C.CString(c.format)
+		format = C.av_find_input_format(cformat)
+		C.free(unsafe.Pointer(cformat))
+		if format == nil {
+			return fmt.Errorf("unknown input format %s", c.format)
+		}
+	}
+
+	var opts *C.AVDictionary
+	defer C.av_dict_free(&opts)
+	for key, value := range c.options {
+		ckey, cvalue := C.CString(key), C.CString(value)
+		averr := C.av_dict_set(&opts, ckey, cvalue, 0)
+		C.free(unsafe.Pointer(ckey))
+		C.free(unsafe.Pointer(cvalue))
+		if averr < 0 {
+			return av_err("av_dict_set", averr)
+		}
+	}
+
+	curl := C.CString(c.url)
+	defer C.free(unsafe.Pointer(curl))
+	if averr := C.avformat_open_input(&c.avformatctx, curl, format, &opts); averr < 0 {
+		// avformat_open_input frees the context on failure.
+		return av_err("avformat_open_input", averr)
+	}
+	// the options that weren't recognized are left in the dictionary, for example if they were renamed.
+	if C.av_dict_count(opts) > 0 {
+		var unused []string
+		empty := C.CString("")
+		for e := C.av_dict_get(opts, empty, nil, C.AV_DICT_IGNORE_SUFFIX); e != nil; e = C.av_dict_get(opts, empty, e, C.AV_DICT_IGNORE_SUFFIX) {
+			unused = append(unused, C.GoString(e.key))
+		}
+		C.free(unsafe.Pointer(empty))
+		zap.L().Warn("unused input options", zap.String("format", c.format), zap.Strings("options", unused))
+	}
+
+	if averr := C.avformat_find_stream_info(c.avformatctx, nil); averr < 0 {
+		return av_err("avformat_find_stream_info", averr)
+	}
+
+	c.streams = make([]*IngestStream, c.avformatctx.nb_streams)
+	for i := range c.streams {
+		stream := streamAt(c.avformatctx, i)
+		var kind webrtc.RTPCodecType
+		switch stream.codecpar.codec_type {
+		case C.AVMEDIA_TYPE_VIDEO:
+			kind = webrtc.RTPCodecTypeVideo
+		case C.AVMEDIA_TYPE_AUDIO:
+			kind = webrtc.RTPCodecTypeAudio
+		default:
+			stream.discard = C.AVDISCARD_ALL
+			continue
+		}
+		s := &IngestStream{ingest: c, kind: kind, timeBase: stream.time_base}
+		s.r, s.w = rtpio.RTPPipe()
+		c.streams[i] = s
+		if stream.codecpar.codec_id == C.AV_CODEC_ID_AAC {
+			// the rtp muxer needs raw frames and the AudioSpecificConfig, mpeg-ts has ADTS headers instead.
+			// the filter passes raw frames through.
+			if err := s.initBSF(caacadtstoasc, stream); err != nil {
+				return err
+			}
+		}
+	}
+	if len(c.Streams()) == 0 {
+		return errors.New("the input has no audio or video streams")
+	}
+	return nil
+}
+
+func (s *IngestStream) initBSF(name *C.char, stream *C.AVStream) error {
+	filter := C.av_bsf_get_by_name(name)
+	if filter == nil {
+		return fmt.Errorf("failed to find bitstream filter %s", C.GoString(name))
+	}
+	if averr := C.av_bsf_alloc(filter, &s.bsf); averr < 0 {
+		return av_err("av_bsf_alloc", averr)
+	}
+	if averr := C.avcodec_parameters_copy(s.bsf.par_in, stream.codecpar); averr < 0 {
+		return av_err("avcodec_parameters_copy", averr)
+	}
+	s.bsf.time_base_in = stream.time_base
+	if averr := C.av_bsf_init(s.bsf); averr < 0 {
+		return av_err("av_bsf_init", averr)
+	}
+	return nil
+}
+
+// Streams returns the audio and video streams of the input, they're valid after Open.
+func (c *Ingest) Streams() []*IngestStream {
+	var streams []*IngestStream
+	for _, s := range c.streams {
+		if s != nil {
+			streams = append(streams, s)
+		}
+	}
+	return streams
+}
+
+// Run writes the packets of the input to the streams until it ends or the ingest is closed, then ends
+// the streams and frees the ingest.
+func (c *Ingest) Run() error {
+	defer c.close()
+	for {
+		if averr := C.av_read_frame(c.avformatctx, c.packet.packet); averr < 0 {
+			if atomic.LoadInt32(&c.closed) == 1 {
+				return nil
+			}
+			if err := av_err("av_read_frame", averr); err != io.EOF {
+				return err
+			}
+			return nil
+		}
+		err := c.write(c.packet.packet)
+		C.av_packet_unref(c.packet.packet)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close interrupts the ingest, Run returns once it's stopped.
+func (c *Ingest) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+func (c *Ingest) write(pkt *C.AVPacket) error {
+	if int(pkt.stream_index) >= len(c.streams) || c.streams[pkt.stream_index] == nil {
+		return nil
+	}
+	s := c.streams[pkt.stream_index]
+
+	ts := pkt.pts
+	if ts == C.AV_NOPTS_VALUE {
+		ts = pkt.dts
+	}
+	if ts == C.AV_NOPTS_VALUE {
+		// the packet can't be placed on the timeline.
+		return nil
+	}
+	at := int64(C.av_rescale_q(ts, s.timeBase, C.av_make_q(1, 1000000)))
+	if c.start.IsZero() {
+		c.start, c.base = time.Now(), at
+	}
+	s.at = at - c.base
+
+	if s.bsf == nil {
+		return c.mux(s, pkt, streamAt(c.avformatctx, int(pkt.stream_index)).codecpar)
+	}
+	if averr := C.av_bsf_send_packet(s.bsf, pkt); averr < 0 {
+		return av_err("av_bsf_send_packet", averr)
+	}
+	for {
+		averr := C.av_bsf_receive_packet(s.bsf, pkt)
+		if averr == AVERROR(C.EAGAIN) {
+			return nil
+		}
+		if averr < 0 {
+			return av_err("av_bsf_receive_packet", averr)
+		}
+		err := c.mux(s, pkt, s.bsf.par_out)
+		C.av_packet_unref(pkt)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// mux writes a packet to the rtp muxer of a stream, creating the muxer if it's the first packet.
+// Streams the rtp muxer doesn't support are skipped.
+func (c *Ingest) mux(s *IngestStream, pkt *C.AVPacket, codecpar *C.AVCodecParameters) error {
+	if s.avformatctx == nil {
+		if err := s.open(pkt, codecpar); err != nil {
+			zap.L().Warn("skipping unsupported stream", zap.String("kind", s.kind.String()), zap.Error(err))
+			c.streams[pkt.stream_index] = nil
+			s.close()
+			return nil
+		}
+		if c.onStream != nil {
+			c.onStream(s)
+		}
+	}
+	C.av_packet_rescale_ts(pkt, s.timeBase, streamAt(s.avformatctx, 0).time_base)
+	pkt.stream_index = 0
+	if averr := C.av_write_frame(s.avformatctx, pkt); averr < 0 {
+		return av_err("av_write_frame", averr)
+	}
+	return nil
+}
+
+//export goWriteIngestPacketFunc
+func goWriteIngestPacketFunc(opaque unsafe.Pointer, buf *C.uint8_t, bufsize C.int) C.int {
+	s := pointer.Restore(opaque).(*IngestStream)
+	p := &rtp.Packet{}
+	if err := p.Unmarshal(C.GoBytes(unsafe.Pointer(buf), bufsize)); err != nil {
+		zap.L().Error("failed to unmarshal rtp packet", zap.Error(err))
+		return C.int(-1)
+	}
+	if s.onSenderReport != nil && (!s.reported || s.at-s.reportedAt >= ingestReportInterval.Microseconds()) {
+		s.reported, s.reportedAt = true, s.at
+		s.onSenderReport(s.ingest.start.Add(time.Duration(s.at)*time.Microsecond), p.Timestamp)
+	}
+	if err := s.w.WriteRTP(p); err != nil {
+		return C.int(-1)
+	}
+	return bufsize
+}
+
+// open creates the rtp muxer of the stream and reads its codec from the muxer's sdp.
+func (s *IngestStream) open(pkt *C.AVPacket, codecpar *C.AVCodecParameters) error {
+	outputformat := C.av_guess_format(crtp, nil, nil)
+	if outputformat == nil {
+		return errors.New("failed to find rtp output format")
+	}
+
+	buf := C.av_malloc(C.size_t(ingestPacketMTU))
+	if buf == nil {
+		return errors.New("failed to allocate buffer")
+	}
+	s.opaque = pointer.Save(s)
+	s.avioctx = C.avio_alloc_context((*C.uchar)(buf), C.int(ingestPacketMTU), 1, s.opaque, nil, (*[0]byte)(C.cgoWriteIngestPacketFunc), nil)
+	if s.avioctx == nil {
+		C.av_free(buf)
+		return errors.New("failed to create avio context")
+	}
+	s.avioctx.max_packet_size = C.int(ingestPacketMTU)
+
+	if averr := C.avformat_alloc_output_context2(&s.avformatctx, outputformat, nil, nil); averr < 0 {
+		return av_err("avformat_alloc_output_context2", averr)
+	}
+	s.avformatctx.pb = s.avioctx
+	s.avformatctx.flags |= C.AVFMT_FLAG_CUSTOM_IO
+
+	stream := C.avformat_new_stream(s.avformatctx, nil)
+	if stream == nil {
+		return errors.New("failed to create rtp stream")
+	}
+	if averr := C.avcodec_parameters_copy(stream.codecpar, codecpar); averr < 0 {
+		return av_err("avcodec_parameters_copy", averr)
+	}
+	stream.codecpar.codec_tag = 0
+	// the AudioSpecificConfig of ADTS streams is sent with the first filtered packet.
+	var size C.int
+	if extradata := C.av_packet_get_side_data(pkt, C.AV_PKT_DATA_NEW_EXTRADATA, &size); extradata != nil && size > 0 {
+		C.av_freep(unsafe.Pointer(&stream.codecpar.extradata))
+		stream.codecpar.extradata = (*C.uint8_t)(C.av_mallocz(C.size_t(size + C.AV_INPUT_BUFFER_PADDING_SIZE)))
+		if stream.codecpar.extradata == nil {
+			return errors.New("failed to allocate extradata")
+		}
+		C.memcpy(unsafe.Pointer(stream.codecpar.extradata), unsafe.Pointer(extradata), C.size_t(size))
+		stream.codecpar.extradata_size = size
+	}
+	stream.time_base = s.timeBase
+
+	// the sender reports are generated from the input timeline instead, the muxer's are based on the
+	// time the packets are written.
+	var opts *C.AVDictionary
+	C.av_dict_set(&opts, crtpflags, cskiprtcp, 0)
+	averr := C.avformat_write_header(s.avformatctx, &opts)
+	C.av_dict_free(&opts)
+	if averr < 0 {
+		return av_err("avformat_write_header", averr)
+	}
+
+	desc := make([]byte, ingestSDPSize)
+	if averr := C.av_sdp_create(&s.avformatctx, 1, (*C.char)(unsafe.Pointer(&desc[0])), C.int(len(desc))); averr < 0 {
+		return av_err("av_sdp_create", averr)
+	}
+	codec, err := sessionDescriptionCodec(string(desc[:strings.IndexByte(string(desc), 0)]))
+	if err != nil {
+		return err
+	}
+	s.codec = codec
+	return nil
+}
+
+// sessionDescriptionCodec reads the codec of the only media of an sdp.
+func sessionDescriptionCodec(desc string) (webrtc.RTPCodecParameters, error) {
+	s := &sdp.SessionDescription{}
+	if err := s.Unmarshal(desc); err != nil {
+		return webrtc.RTPCodecParameters{}, err
+	}
+	if len(s.MediaDescriptions) != 1 || len(s.MediaDescriptions[0].MediaName.Formats) != 1 {
+		return webrtc.RTPCodecParameters{}, errors.New("expected a single rtp stream")
+	}
+	md := s.MediaDescriptions[0]
+	pt, err := strconv.ParseUint(md.MediaName.Formats[0], 10, 8)
+	if err != nil {
+		return webrtc.RTPCodecParameters{}, err
+	}
+	codec := webrtc.RTPCodecParameters{PayloadType: webrtc.PayloadType(pt)}
+	for _, attr := range md.Attributes {
+		fields := strings.SplitN(attr.Value, " ", 2)
+		if len(fields) != 2 || fields[0] != md.MediaName.Formats[0] {
+			continue
+		}
+		switch attr.Key {
+		case "rtpmap":
+			// the encoding is name/clock rate[/channels].
+			encoding := strings.Split(fields[1], "/")
+			codec.MimeType = md.MediaName.Media + "/" + encoding[0]
+			if len(encoding) > 1 {
+				rate, err := strconv.ParseUint(encoding[1], 10, 32)
+				if err != nil {
+					return webrtc.RTPCodecParameters{}, err
+				}
+				codec.ClockRate = uint32(rate)
+			}
+			if len(encoding) > 2 {
+				channels, err := strconv.ParseUint(encoding[2], 10, 16)
+				if err != nil {
+					return webrtc.RTPCodecParameters{}, err
+				}
+				codec.Channels = uint16(channels)
+			}
+		case "fmtp":
+			codec.SDPFmtpLine = fields[1]
+		}
+	}
+	if codec.MimeType == "" {
+		static, ok := staticPayloadTypes[uint8(pt)]
+		if !ok {
+			return webrtc.RTPCodecParameters{}, fmt.Errorf("unknown payload type %d", pt)
+		}
+		codec.RTPCodecCapability = static
+	}
+	return codec, nil
+}
+
+// Kind returns whether the stream is audio or video.
+func (s *IngestStream) Kind() webrtc.RTPCodecType {
+	return s.kind
+}
+
+// Codec returns the codec of the rtp packets, it's valid once the stream has started.
+func (s *IngestStream) Codec() webrtc.RTPCodecParameters {
+	return s.codec
+}
+
+// OnSenderReport sets a callback that is called with the sender reports of the stream, which map its
+// rtp timestamps to the wall clock time of the input. It must be set before the stream starts.
+func (s *IngestStream) OnSenderReport(f func(ntp time.Time, rtpTime uint32)) {
+	s.onSenderReport = f
+}
+
+// ReadRTP reads the next packet of the stream, it returns io.EOF when the ingest ends.
+func (s *IngestStream) ReadRTP() (*rtp.Packet, error) {
+	return s.r.ReadRTP()
+}
+
+// close frees the rtp muxer and ends the stream.
+func (s *IngestStream) close() {
+	if s.avformatctx != nil {
+		C.avformat_free_context(s.avformatctx)
+		s.avformatctx = nil
+	}
+	if s.avioctx != nil {
+		C.av_freep(unsafe.Pointer(&s.avioctx.buffer))
+		C.avio_context_free(&s.avioctx)
+	}
+	if s.opaque != nil {
+		pointer.Unref(s.opaque)
+		s.opaque = nil
+	}
+	if s.bsf != nil {
+		C.av_bsf_free(&s.bsf)
+	}
+	s.w.Close()
+}
+
+// close frees the input and ends every stream. It's safe to call more than once.
+func (c *Ingest) close() {
+	for i, s := range c.streams {
+		if s != nil {
+			s.close()
+			c.streams[i] = nil
+		}
+	}
+	if c.avformatctx != nil {
+		C.avformat_close_input(&c.avformatctx)
+	}
+	if c.opaque != nil {
+		pointer.Unref(c.opaque)
+		c.opaque = nil
+	}
+	if c.packet != nil {
+		c.packet.Close()
+		c.packet = nil
+	}
+}
@@ -0,0 +1,12 @@
+#ifndef INGEST_H
+#define INGEST_H
+
+#include <stdint.h>
+
+extern int goInterruptFunc(void *);
+extern int goWriteIngestPacketFunc(void *, uint8_t *, int);
+
+int cgoInterruptFunc(void *);
+int cgoWriteIngestPacketFunc(void *, uint8_t *, int);
+
+#endif
\ No newline at end of file
@@ -0,0 +1,20 @@
+package av
+
+import "testing"
+
+func TestRTSPTimeoutOption(t *testing.T) {
+	tests := []struct {
+		major int
+		want  string
+	}{
+		{major: 58, want: "stimeout"},
+		// FFmpeg 5 renamed the option.
+		{major: 59, want: "timeout"},
+		{major: 60, want: "timeout"},
+	}
+	for _, tt := range tests {
+		if got := rtspTimeoutOption(tt.major); got != tt.want {
+			t.Errorf("libavformat %d: got %s, want %s", tt.major, got, tt.want)
+		}
+	}
+}
@@ -5,4 +5,9 @@
 int cgoWritePacketFunc(void *opaque, uint8_t *buf, int buf_size)
 {
     return goWritePacketFunc(opaque, buf, buf_size);
+}
+
+int cgoWriteFragmentFunc(void *opaque, uint8_t *buf, int buf_size)
+{
+    return goWriteFragmentFunc(opaque, buf, buf_size);
 }
\ No newline at end of file
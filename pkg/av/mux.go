@@ -30,6 +30,9 @@ type result struct {
 type MuxContext struct {
 	codec       webrtc.RTPCodecCapability
 	avformatctx *C.AVFormatContext
+	avioctx     *C.AVIOContext
+	opaque      unsafe.Pointer
+	stream      *C.AVStream
 	packet      *AVPacket
 	encoder     *EncodeContext
 	pch         chan *result
@@ -44,17 +47,22 @@ func NewMuxer(codec webrtc.RTPCodecCapability, encoder *EncodeContext) *MuxConte
 	}
 	go func() {
 		defer close(c.pch)
-		defer C.av_write_trailer(c.avformatctx)
+		defer c.close()
 		if err := c.init(); err != nil {
 			c.pch <- &result{e: err}
 			return
 		}
+		defer C.av_write_trailer(c.avformatctx)
 		for {
 			if err := c.encoder.ReadAVPacket(c.packet); err != nil {
-				c.pch <- &result{e: err}
-				close(c.pch)
+				if err != io.EOF {
+					c.pch <- &result{e: err}
+				}
 				return
 			}
+			// the muxer may pick a different time base than the encoder, eg for G.722.
+			C.av_packet_rescale_ts(c.packet.packet, c.encoder.encoderctx.time_base, c.stream.time_base)
+			c.packet.packet.stream_index = c.stream.index
 			if averr := C.av_write_frame(c.avformatctx, c.packet.packet); averr < 0 {
 				c.pch <- &result{e: av_err("av_write_frame", averr)}
 				return
@@ -81,7 +89,14 @@ func (c *MuxContext) init() error {
 	if err := c.encoder.init(); err != nil {
 		return err
 	}
+	if err := c.open(); err != nil {
+		c.encoder.close()
+		return err
+	}
+	return nil
+}
 
+func (c *MuxContext) open() error {
 	outputformat := C.av_guess_format(crtp, nil, nil)
 	if outputformat == nil {
 		return errors.New("failed to find rtp output format")
@@ -92,20 +107,24 @@ func (c *MuxContext) init() error {
 		return errors.New("failed to allocate buffer")
 	}
 
+	c.opaque = pointer.Save(c)
+	c.avioctx = C.avio_alloc_context((*C.uchar)(buf), 1200, 1, c.opaque, nil, (*[0]byte)(C.cgoWritePacketFunc), nil)
+	if c.avioctx == nil {
+		C.av_free(buf)
+		return errors.New("failed to create avio context")
+	}
+
+	c.avioctx.max_packet_size = 1200
+
 	var avformatctx *C.AVFormatContext
 
 	if averr := C.avformat_alloc_output_context2(&avformatctx, outputformat, nil, nil); averr < 0 {
 		return av_err("avformat_alloc_output_context2", averr)
 	}
 
-	avioctx := C.avio_alloc_context((*C.uchar)(buf), 1200, 1, pointer.Save(c), nil, (*[0]byte)(C.cgoWritePacketFunc), nil)
-	if avioctx == nil {
-		return errors.New("failed to create avio context")
-	}
-
-	avioctx.max_packet_size = 1200
-
-	avformatctx.pb = avioctx
+	c.avformatctx = avformatctx
+	avformatctx.pb = c.avioctx
+	avformatctx.flags |= C.AVFMT_FLAG_CUSTOM_IO
 
 	avformatstream := C.avformat_new_stream(avformatctx, c.encoder.encoderctx.codec)
 	if avformatstream == nil {
@@ -120,11 +139,29 @@ func (c *MuxContext) init() error {
 		return av_err("avformat_write_header", averr)
 	}
 
-	c.avformatctx = avformatctx
+	c.stream = avformatstream
 
 	return nil
 }
 
+// close frees the muxer and the pipeline before it.
+func (c *MuxContext) close() {
+	if c.avformatctx != nil {
+		C.avformat_free_context(c.avformatctx)
+		c.avformatctx = nil
+	}
+	if c.avioctx != nil {
+		C.av_freep(unsafe.Pointer(&c.avioctx.buffer))
+		C.avio_context_free(&c.avioctx)
+	}
+	if c.opaque != nil {
+		pointer.Unref(c.opaque)
+		c.opaque = nil
+	}
+	c.packet.Close()
+	c.encoder.close()
+}
+
 func (c *MuxContext) ReadRTP() (*rtp.Packet, error) {
 	r, ok := <-c.pch
 	if !ok {
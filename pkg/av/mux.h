@@ -4,7 +4,9 @@
 #include <stdint.h>
 
 extern int goWritePacketFunc(void *, uint8_t *, int);
+extern int goWriteFragmentFunc(void *, uint8_t *, int);
 
 int cgoWritePacketFunc(void *, uint8_t *, int);
+int cgoWriteFragmentFunc(void *, uint8_t *, int);
 
 #endif
\ No newline at end of file
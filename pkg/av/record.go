@@ -0,0 +1,158 @@
+package av
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtpio/pkg/rtpio"
+	"github.com/pion/webrtc/v3"
+)
+
+// rtpClock maps the timestamps of an rtp input to wall clock time.
+type rtpClock struct {
+	mu        sync.Mutex
+	clockRate uint32
+
+	// base is the timestamp of the first packet, which the demuxer maps to zero.
+	started bool
+	base    uint32
+	arrival time.Time
+
+	// the latest sender report.
+	reported bool
+	ntp      time.Time
+	rtpTime  uint32
+}
+
+func (c *rtpClock) packet(timestamp uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.started {
+		c.started = true
+		c.base = timestamp
+		c.arrival = time.Now()
+	}
+}
+
+func (c *rtpClock) senderReport(ntp time.Time, rtpTime uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reported = true
+	c.ntp = ntp
+	c.rtpTime = rtpTime
+}
+
+// synchronized returns true if the input has started and there's a sender report.
+func (c *rtpClock) synchronized() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.started && c.reported
+}
+
+// start returns the time of the first packet's timestamp, from the sender report if reports is set or
+// from the arrival time otherwise.
+func (c *rtpClock) start(reports bool) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !reports || !c.reported {
+		return c.arrival
+	}
+	// the difference is signed to handle timestamps on either side of a wraparound.
+	delta := int64(int32(c.base - c.rtpTime))
+	return c.ntp.Add(time.Duration(delta * int64(time.Second) / int64(c.clockRate)))
+}
+
+// RecorderTrack is a track of a recording.
+type RecorderTrack struct {
+	// Codec is the codec of the rtp packets written to the track.
+	Codec webrtc.RTPCodecParameters
+	// To is the codec the track is transcoded to, the track is recorded as it is if the mime type is
+	// empty. The container must support the codec.
+	To     webrtc.RTPCodecCapability
+	Config EncoderConfiguration
+}
+
+// Recorder writes rtp tracks into files, with a stream per track. The tracks are synchronized with the
+// sender reports of their publisher. Closing every input ends the recording, Run returns once the last
+// file is finished.
+type Recorder struct {
+	*FileSink
+	Inputs []*RecorderInput
+}
+
+// RecorderInput receives the rtp packets of a track of a Recorder.
+type RecorderInput struct {
+	w           rtpio.RTPWriteCloser
+	clock       *rtpClock
+	decoder     *DecodeContext
+	passthrough *Passthrough
+}
+
+func NewRecorder(path string, segment SegmentConfiguration, tracks ...RecorderTrack) *Recorder {
+	r := &Recorder{}
+	inputs := make([]*sinkInput, len(tracks))
+	for i, track := range tracks {
+		pr, pw := rtpio.RTPPipe()
+		input := &RecorderInput{
+			w:     pw,
+			clock: &rtpClock{clockRate: track.Codec.ClockRate},
+		}
+		demux := NewDemuxer(track.Codec, pr)
+		var source encodedPacketReader
+		if track.To.MimeType == "" {
+			input.passthrough = NewPassthrough(demux)
+			source = input.passthrough
+		} else {
+			input.decoder = NewDecoder(demux)
+			source = newEncoder(track.To, track.Config, input.decoder)
+		}
+		r.Inputs = append(r.Inputs, input)
+		inputs[i] = &sinkInput{source: source, clock: input.clock, stop: func() { pw.Close() }}
+	}
+	r.FileSink = newFileSink(path, segment, inputs)
+	return r
+}
+
+// NewStreamOutput writes rtp tracks to a url in a live container instead of files, for example mpeg-ts
+// to srt://host:port. The tracks are synchronized like a Recorder's, Run returns when they end or the
+// connection fails.
+func NewStreamOutput(url, format string, tracks ...RecorderTrack) *Recorder {
+	r := NewRecorder(url, SegmentConfiguration{}, tracks...)
+	r.FileSink.formatName = format
+	return r
+}
+
+// Close ends every input.
+func (r *Recorder) Close() error {
+	for _, input := range r.Inputs {
+		input.Close()
+	}
+	return nil
+}
+
+func (i *RecorderInput) WriteRTP(p *rtp.Packet) error {
+	i.clock.packet(p.Timestamp)
+	return i.w.WriteRTP(p)
+}
+
+// Close ends the input.
+func (i *RecorderInput) Close() error {
+	return i.w.Close()
+}
+
+// WriteSenderReport maps an rtp timestamp of the track to the sender's wall clock, as sent in RTCP
+// sender reports. Tracks are aligned by these so they play in sync.
+func (i *RecorderInput) WriteSenderReport(ntp time.Time, rtpTime uint32) {
+	i.clock.senderReport(ntp, rtpTime)
+}
+
+// OnKeyframeRequest sets a callback that is called when the track needs a keyframe, to recover from loss
+// or to start a file. It must be set before the recorder is run.
+func (i *RecorderInput) OnKeyframeRequest(f func()) {
+	if i.decoder != nil {
+		i.decoder.OnKeyframeRequest(f)
+	} else {
+		i.passthrough.OnKeyframeRequest(f)
+	}
+}
@@ -0,0 +1,266 @@
+package av
+
+/*
+#cgo pkg-config: libavcodec libavutil libswresample
+#include <libavcodec/avcodec.h>
+#include <libavutil/audio_fifo.h>
+#include <libavutil/channel_layout.h>
+#include <libswresample/swresample.h>
+*/
+import "C"
+import (
+	"errors"
+	"io"
+	"unsafe"
+
+	"github.com/pion/webrtc/v3"
+)
+
+type ResampleContext struct {
+	codec      webrtc.RTPCodecCapability
+	swrctx     *C.SwrContext
+	fifo       *C.AVAudioFifo
+	frame      *AVFrame
+	resampled  *AVFrame
+	decoder    decodedFrameReader
+	encoderctx *C.AVCodecContext
+
+	// the output format, chosen from the formats the encoder supports.
+	rate    int
+	format  int32
+	layout  C.uint64_t
+	nextpts int64
+
+	// the current input format, used to detect mid-stream changes.
+	inrate   int
+	informat int32
+	inlayout C.uint64_t
+
+	eof bool
+}
+
+// NewResampler creates a stage that converts decoded audio to the sample rate, sample format and channel
+// layout expected by the encoder, and re-chunks the samples to the encoder's frame size.
+func NewResampler(codec webrtc.RTPCodecCapability, decoder decodedFrameReader) *ResampleContext {
+	return &ResampleContext{
+		codec:     codec,
+		frame:     NewAVFrame(),
+		resampled: NewAVFrame(),
+		decoder:   decoder,
+		nextpts:   C.AV_NOPTS_VALUE,
+	}
+}
+
+// SampleRate returns the sample rate of a codec, which is not always the RTP clock rate.
+func SampleRate(codec webrtc.RTPCodecCapability) int {
+	if codec.MimeType == webrtc.MimeTypeG722 {
+		// G.722 uses an 8 kHz clock rate for historical reasons, see RFC 3551.
+		return 16000
+	}
+	return int(codec.ClockRate)
+}
+
+func (c *ResampleContext) init() error {
+	return c.decoder.init()
+}
+
+func (c *ResampleContext) configure(encoderctx *C.AVCodecContext) {
+	decoderctx := c.decoder.decoderContext()
+
+	channels := int(c.codec.Channels)
+	if channels == 0 {
+		channels = int(decoderctx.channels)
+	}
+
+	c.rate = SampleRate(c.codec)
+	c.layout = C.uint64_t(C.av_get_default_channel_layout(C.int(channels)))
+	c.format = decoderctx.sample_fmt
+	if formats := encoderctx.codec.sample_fmts; formats != nil {
+		// prefer the decoded format if the encoder supports it to avoid a conversion.
+		supported := false
+		for p := formats; *p != C.AV_SAMPLE_FMT_NONE; p = (*int32)(unsafe.Pointer(uintptr(unsafe.Pointer(p)) + unsafe.Sizeof(*p))) {
+			if *p == c.format {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			c.format = *formats
+		}
+	}
+
+	encoderctx.sample_rate = C.int(c.rate)
+	encoderctx.sample_fmt = c.format
+	encoderctx.channels = C.int(channels)
+	encoderctx.channel_layout = c.layout
+	encoderctx.time_base = C.av_make_q(1, C.int(c.rate))
+
+	c.encoderctx = encoderctx
+}
+
+// frameSize returns the number of samples the encoder expects per frame, or zero if any size is accepted.
+func (c *ResampleContext) frameSize() int {
+	if c.encoderctx.codec.capabilities&C.AV_CODEC_CAP_VARIABLE_FRAME_SIZE != 0 {
+		return 0
+	}
+	return int(c.encoderctx.frame_size)
+}
+
+// resample converts the decoded frame and appends the samples to the fifo.
+func (c *ResampleContext) resample(in *C.AVFrame) error {
+	if in.channel_layout == 0 {
+		in.channel_layout = C.uint64_t(C.av_get_default_channel_layout(in.channels))
+	}
+
+	if c.swrctx == nil || int(in.sample_rate) != c.inrate || in.format != C.int(c.informat) || in.channel_layout != c.inlayout {
+		c.inrate, c.informat, c.inlayout = int(in.sample_rate), int32(in.format), in.channel_layout
+
+		// if the input format changes mid-stream, buffered samples are dropped.
+		C.swr_free(&c.swrctx)
+		swrctx := C.swr_alloc_set_opts(nil,
+			C.int64_t(c.layout), c.format, C.int(c.rate),
+			C.int64_t(c.inlayout), c.informat, C.int(c.inrate),
+			0, nil)
+		if swrctx == nil {
+			return errors.New("failed to allocate resampler")
+		}
+		if averr := C.swr_init(swrctx); averr < 0 {
+			C.swr_free(&swrctx)
+			return av_err("swr_init", averr)
+		}
+		c.swrctx = swrctx
+	}
+
+	if in.pts != C.AV_NOPTS_VALUE {
+		// the pts of the first sample that this frame will produce.
+		pts := int64(C.av_rescale_q(in.pts, c.decoder.decoderContext().pkt_timebase, C.av_make_q(1, C.int(c.rate))))
+		expected := c.nextpts + int64(C.av_audio_fifo_size(c.fifo))
+		if c.nextpts == C.AV_NOPTS_VALUE || abs(pts-expected) > int64(c.rate)/10 {
+			// resynchronize if there's a gap of more than 100ms, eg from packet loss.
+			c.nextpts = pts - int64(C.av_audio_fifo_size(c.fifo))
+		}
+	}
+
+	out := c.resampled.frame
+	C.av_frame_unref(out)
+	out.sample_rate = C.int(c.rate)
+	out.format = C.int(c.format)
+	out.channel_layout = c.layout
+
+	if averr := C.swr_convert_frame(c.swrctx, out, in); averr < 0 {
+		return av_err("swr_convert_frame", averr)
+	}
+
+	return c.buffer(out)
+}
+
+// flush drains the samples buffered in the resampler into the fifo.
+func (c *ResampleContext) flush() error {
+	if c.swrctx == nil {
+		return nil
+	}
+	out := c.resampled.frame
+	C.av_frame_unref(out)
+	out.sample_rate = C.int(c.rate)
+	out.format = C.int(c.format)
+	out.channel_layout = c.layout
+
+	if averr := C.swr_convert_frame(c.swrctx, out, nil); averr < 0 {
+		return av_err("swr_convert_frame", averr)
+	}
+
+	return c.buffer(out)
+}
+
+func (c *ResampleContext) buffer(out *C.AVFrame) error {
+	if out.nb_samples == 0 {
+		return nil
+	}
+	if n := C.av_audio_fifo_write(c.fifo, (*unsafe.Pointer)(unsafe.Pointer(out.extended_data)), out.nb_samples); n < out.nb_samples {
+		return av_err("av_audio_fifo_write", n)
+	}
+	return nil
+}
+
+func (c *ResampleContext) ReadAVFrame(f *AVFrame) error {
+	if c.fifo == nil {
+		c.fifo = C.av_audio_fifo_alloc(c.format, c.encoderctx.channels, 1)
+		if c.fifo == nil {
+			return errors.New("failed to allocate audio fifo")
+		}
+	}
+
+	size := c.frameSize()
+	for !c.eof && (int(C.av_audio_fifo_size(c.fifo)) < size || C.av_audio_fifo_size(c.fifo) == 0) {
+		if err := c.decoder.ReadAVFrame(c.frame); err != nil {
+			if err != io.EOF {
+				C.av_frame_unref(f.frame)
+				c.close()
+				return err
+			}
+			c.eof = true
+			if err := c.flush(); err != nil {
+				C.av_frame_unref(f.frame)
+				c.close()
+				return err
+			}
+			break
+		}
+		if err := c.resample(c.frame.frame); err != nil {
+			C.av_frame_unref(f.frame)
+			c.close()
+			return err
+		}
+	}
+
+	n := int(C.av_audio_fifo_size(c.fifo))
+	if size > 0 && n > size {
+		n = size
+	}
+	if n == 0 || (n < size && c.encoderctx.codec.capabilities&C.AV_CODEC_CAP_SMALL_LAST_FRAME == 0) {
+		// the remaining samples can't be encoded.
+		C.av_frame_unref(f.frame)
+		c.close()
+		return io.EOF
+	}
+
+	out := f.frame
+	C.av_frame_unref(out)
+	out.nb_samples = C.int(n)
+	out.format = C.int(c.format)
+	out.sample_rate = C.int(c.rate)
+	out.channel_layout = c.layout
+	out.channels = c.encoderctx.channels
+	if averr := C.av_frame_get_buffer(out, 0); averr < 0 {
+		return av_err("av_frame_get_buffer", averr)
+	}
+	if read := C.av_audio_fifo_read(c.fifo, (*unsafe.Pointer)(unsafe.Pointer(out.extended_data)), C.int(n)); read < C.int(n) {
+		return av_err("av_audio_fifo_read", read)
+	}
+	out.pts = C.int64_t(c.nextpts)
+	if c.nextpts != C.AV_NOPTS_VALUE {
+		c.nextpts += int64(n)
+	}
+
+	return nil
+}
+
+func abs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func (c *ResampleContext) close() {
+	if c.swrctx != nil {
+		C.swr_free(&c.swrctx)
+	}
+	if c.fifo != nil {
+		C.av_audio_fifo_free(c.fifo)
+		c.fifo = nil
+	}
+	c.frame.Close()
+	c.resampled.Close()
+	c.decoder.close()
+}
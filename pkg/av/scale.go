@@ -0,0 +1,263 @@
+package av
+
+/*
+#cgo pkg-config: libavcodec libavutil libswscale
+#include <libavcodec/avcodec.h>
+#include <libavutil/imgutils.h>
+#include <libavutil/pixdesc.h>
+#include <libswscale/swscale.h>
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"unsafe"
+)
+
+// ScaleMode determines how the input is mapped onto the output resolution when the aspect ratios differ.
+type ScaleMode int
+
+const (
+	// ScaleModeFit scales the input to fit inside the output resolution, padding with black bars.
+	ScaleModeFit ScaleMode = iota
+	// ScaleModeFill scales the input to cover the output resolution, cropping the edges.
+	ScaleModeFill
+	// ScaleModeStretch scales the input to the output resolution, ignoring the aspect ratio.
+	ScaleModeStretch
+)
+
+type rect struct {
+	x, y, w, h int
+}
+
+type ScaleContext struct {
+	width, height int
+	mode          ScaleMode
+	pixfmt        int32
+	swsctx        *C.struct_SwsContext
+	frame         *AVFrame
+	decoder       decodedFrameReader
+	// timebase is the encoder's time base, which the frame timestamps are converted to.
+	timebase C.AVRational
+
+	// the current input geometry, used to detect mid-stream changes.
+	inw, inh, infmt int
+	sar             C.AVRational
+	src, dst        rect
+}
+
+// NewScaler creates a stage that converts decoded frames to yuv420p at the given resolution. If only
+// one of width or height is nonzero, the other is derived from the input aspect ratio. If both are
+// zero the input resolution is preserved.
+func NewScaler(width, height int, mode ScaleMode, decoder decodedFrameReader) *ScaleContext {
+	return &ScaleContext{
+		width:   width,
+		height:  height,
+		mode:    mode,
+		pixfmt:  C.AV_PIX_FMT_YUV420P,
+		frame:   NewAVFrame(),
+		decoder: decoder,
+	}
+}
+
+// even rounds down to an even number, most pixel formats subsample chroma by two.
+func even(x int) int {
+	return x &^ 1
+}
+
+// aspect returns the display aspect ratio of a w x h image with the given sample aspect ratio.
+func aspect(w, h int, sar C.AVRational) float64 {
+	if sar.num <= 0 || sar.den <= 0 {
+		return float64(w) / float64(h)
+	}
+	return float64(w) * float64(sar.num) / (float64(h) * float64(sar.den))
+}
+
+func (c *ScaleContext) init() error {
+	if err := c.decoder.init(); err != nil {
+		return err
+	}
+
+	decoderctx := c.decoder.decoderContext()
+	inw, inh := int(decoderctx.width), int(decoderctx.height)
+	if inw <= 0 || inh <= 0 {
+		return fmt.Errorf("invalid input resolution %dx%d", inw, inh)
+	}
+	dar := aspect(inw, inh, decoderctx.sample_aspect_ratio)
+
+	switch {
+	case c.width > 0 && c.height > 0:
+	case c.width > 0:
+		c.height = int(math.Round(float64(c.width) / dar))
+	case c.height > 0:
+		c.width = int(math.Round(float64(c.height) * dar))
+	default:
+		c.width, c.height = inw, inh
+	}
+	c.width, c.height = even(c.width), even(c.height)
+	if c.width <= 0 || c.height <= 0 {
+		return fmt.Errorf("invalid output resolution %dx%d", c.width, c.height)
+	}
+
+	return nil
+}
+
+func (c *ScaleContext) configure(encoderctx *C.AVCodecContext) {
+	encoderctx.width = C.int(c.width)
+	encoderctx.height = C.int(c.height)
+	encoderctx.pix_fmt = c.pixfmt
+	encoderctx.sample_aspect_ratio = C.av_make_q(1, 1)
+	c.timebase = encoderctx.time_base
+}
+
+// layout computes the source and destination rectangles for the current input geometry.
+func (c *ScaleContext) layout() {
+	c.src = rect{w: c.inw, h: c.inh}
+	c.dst = rect{w: c.width, h: c.height}
+
+	in := aspect(c.inw, c.inh, c.sar)
+	out := float64(c.width) / float64(c.height)
+
+	switch c.mode {
+	case ScaleModeFit:
+		if in > out {
+			c.dst.h = even(int(math.Round(float64(c.width) / in)))
+		} else {
+			c.dst.w = even(int(math.Round(float64(c.height) * in)))
+		}
+		c.dst.x = even((c.width - c.dst.w) / 2)
+		c.dst.y = even((c.height - c.dst.h) / 2)
+	case ScaleModeFill:
+		// the ratio of display width to stored width.
+		sar := in * float64(c.inh) / float64(c.inw)
+		if in > out {
+			c.src.w = even(int(math.Round(float64(c.inh) * out / sar)))
+		} else {
+			c.src.h = even(int(math.Round(float64(c.inw) * sar / out)))
+		}
+		c.src.x = even((c.inw - c.src.w) / 2)
+		c.src.y = even((c.inh - c.src.h) / 2)
+	}
+}
+
+// planes returns pointers to the pixel at (x, y) in each plane of an image.
+func planes(pixfmt int32, data [8]*C.uint8_t, linesize [8]C.int, x, y int) ([8]*C.uint8_t, error) {
+	desc := C.av_pix_fmt_desc_get(pixfmt)
+	if desc == nil {
+		return data, fmt.Errorf("unknown pixel format %d", pixfmt)
+	}
+	if x == 0 && y == 0 {
+		return data, nil
+	}
+	var offsets [8]int
+	for i := 0; i < int(desc.nb_components); i++ {
+		comp := desc.comp[i]
+		cx, cy := x, y
+		if i == 1 || i == 2 {
+			// chroma components are subsampled.
+			cx >>= desc.log2_chroma_w
+			cy >>= desc.log2_chroma_h
+		}
+		offsets[comp.plane] = cy*int(linesize[comp.plane]) + cx*int(comp.step)
+	}
+	for i := range data {
+		if data[i] != nil {
+			data[i] = (*C.uint8_t)(unsafe.Pointer(uintptr(unsafe.Pointer(data[i])) + uintptr(offsets[i])))
+		}
+	}
+	return data, nil
+}
+
+func (c *ScaleContext) ReadAVFrame(f *AVFrame) error {
+	if err := c.decoder.ReadAVFrame(c.frame); err != nil {
+		C.av_frame_unref(f.frame)
+		c.close()
+		return err
+	}
+
+	in := c.frame.frame
+	if in.pts == C.AV_NOPTS_VALUE {
+		// raw streams such as annex b files don't carry timestamps.
+		in.pts = in.best_effort_timestamp
+	}
+	if in.pts != C.AV_NOPTS_VALUE {
+		// files use all sorts of time bases, rtp inputs already match the encoder.
+		in.pts = C.av_rescale_q(in.pts, c.decoder.decoderContext().pkt_timebase, c.timebase)
+	}
+
+	if in.width != C.int(c.inw) || in.height != C.int(c.inh) || in.format != C.int(c.infmt) || in.sample_aspect_ratio != c.sar {
+		c.inw, c.inh, c.infmt = int(in.width), int(in.height), int(in.format)
+		c.sar = in.sample_aspect_ratio
+		c.layout()
+
+		swsctx := C.sws_getCachedContext(c.swsctx,
+			C.int(c.src.w), C.int(c.src.h), int32(c.infmt),
+			C.int(c.dst.w), C.int(c.dst.h), c.pixfmt,
+			C.SWS_BICUBIC, nil, nil, nil)
+		if swsctx == nil {
+			c.close()
+			return fmt.Errorf("failed to create scaler from %dx%d to %dx%d", c.src.w, c.src.h, c.dst.w, c.dst.h)
+		}
+		c.swsctx = swsctx
+	}
+
+	C.av_frame_unref(f.frame)
+
+	if c.src == (rect{w: c.width, h: c.height}) && c.dst == c.src && int32(c.infmt) == c.pixfmt {
+		// nothing to do, pass the frame through.
+		C.av_frame_move_ref(f.frame, in)
+		return nil
+	}
+
+	out := f.frame
+	out.width = C.int(c.width)
+	out.height = C.int(c.height)
+	out.format = C.int(c.pixfmt)
+	if averr := C.av_frame_get_buffer(out, 0); averr < 0 {
+		return av_err("av_frame_get_buffer", averr)
+	}
+	if averr := C.av_frame_copy_props(out, in); averr < 0 {
+		return av_err("av_frame_copy_props", averr)
+	}
+	out.sample_aspect_ratio = C.av_make_q(1, 1)
+
+	if c.dst.w != c.width || c.dst.h != c.height {
+		// letterboxed, clear the bars.
+		var linesize [4]C.ptrdiff_t
+		for i := range linesize {
+			linesize[i] = C.ptrdiff_t(out.linesize[i])
+		}
+		if averr := C.av_image_fill_black((**C.uint8_t)(unsafe.Pointer(&out.data[0])), &linesize[0], c.pixfmt, C.AVCOL_RANGE_MPEG, out.width, out.height); averr < 0 {
+			return av_err("av_image_fill_black", averr)
+		}
+	}
+
+	src, err := planes(int32(c.infmt), in.data, in.linesize, c.src.x, c.src.y)
+	if err != nil {
+		return err
+	}
+	dst, err := planes(c.pixfmt, out.data, out.linesize, c.dst.x, c.dst.y)
+	if err != nil {
+		return err
+	}
+
+	if res := C.sws_scale(c.swsctx, (**C.uint8_t)(unsafe.Pointer(&src[0])), &in.linesize[0], 0, C.int(c.src.h), (**C.uint8_t)(unsafe.Pointer(&dst[0])), &out.linesize[0]); res < 0 {
+		return av_err("sws_scale", res)
+	} else if res == 0 {
+		return errors.New("sws_scale produced no output")
+	}
+
+	C.av_frame_unref(in)
+
+	return nil
+}
+
+func (c *ScaleContext) close() {
+	if c.swsctx != nil {
+		C.sws_freeContext(c.swsctx)
+		c.swsctx = nil
+	}
+	c.frame.Close()
+	c.decoder.close()
+}
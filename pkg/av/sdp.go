@@ -0,0 +1,71 @@
+package av
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pion/sdp"
+	"github.com/pion/webrtc/v3"
+)
+
+func kind(codec webrtc.RTPCodecParameters) string {
+	if strings.HasPrefix(codec.MimeType, "video") {
+		return "video"
+	} else if strings.HasPrefix(codec.MimeType, "audio") {
+		return "audio"
+	}
+	return ""
+}
+
+// NewSessionDescription describes a single rtp stream of codec sent to host:port.
+func NewSessionDescription(codec webrtc.RTPCodecParameters, host net.IP, port int) *sdp.SessionDescription {
+	addressType := "IP4"
+	if host.To4() == nil {
+		addressType = "IP6"
+	}
+	s := &sdp.SessionDescription{
+		Version: 0,
+		Origin: sdp.Origin{
+			Username:       "-",
+			NetworkType:    "IN",
+			AddressType:    addressType,
+			UnicastAddress: host.String(),
+		},
+		SessionName:      "Pion WebRTC",
+		TimeDescriptions: []sdp.TimeDescription{{Timing: sdp.Timing{StartTime: 0, StopTime: 0}}},
+	}
+
+	pt := strconv.FormatUint(uint64(codec.PayloadType), 10)
+	rtpmap := fmt.Sprintf("%s/%d", strings.Split(codec.MimeType, "/")[1], codec.ClockRate)
+	if codec.Channels > 0 {
+		rtpmap += fmt.Sprintf("/%d", codec.Channels)
+	}
+	attributes := []sdp.Attribute{
+		{
+			Key:   "rtpmap",
+			Value: fmt.Sprintf("%s %s", pt, rtpmap),
+		},
+	}
+	if codec.SDPFmtpLine != "" {
+		attributes = append(attributes, sdp.Attribute{
+			Key:   "fmtp",
+			Value: fmt.Sprintf("%s %s", pt, codec.SDPFmtpLine),
+		})
+	}
+	return s.WithMedia(&sdp.MediaDescription{
+		ConnectionInformation: &sdp.ConnectionInformation{
+			NetworkType: "IN",
+			AddressType: addressType,
+			Address:     &sdp.Address{IP: host},
+		},
+		MediaName: sdp.MediaName{
+			Media:   kind(codec),
+			Port:    sdp.RangedPort{Value: port},
+			Protos:  []string{"RTP", "AVP"},
+			Formats: []string{pt},
+		},
+		Attributes: attributes,
+	})
+}
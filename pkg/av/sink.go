@@ -0,0 +1,490 @@
+package av
+
+/*
+#cgo pkg-config: libavcodec libavformat
+#include <libavcodec/avcodec.h>
+#include <libavformat/avformat.h>
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"go.uber.org/zap"
+)
+
+// SegmentConfiguration splits the output of a FileSink into several files. A new file is started at
+// the first keyframe after either limit is reached, zero values disable the limit.
+type SegmentConfiguration struct {
+	Duration time.Duration
+	Size     int64
+}
+
+// File describes a file written by a FileSink.
+type File struct {
+	Path     string
+	Duration time.Duration
+	Size     int64
+}
+
+// syncTimeout is how long a FileSink buffers the start of its inputs to wait for every input to
+// synchronize. Browsers send sender reports for audio only every few seconds.
+const syncTimeout = 6 * time.Second
+
+// sinkInput is a stream of a FileSink.
+type sinkInput struct {
+	source encodedPacketReader
+	// clock maps the timestamps of the input to wall clock time, it's nil if the inputs already share a
+	// timeline, for example the streams of a file.
+	clock *rtpClock
+	// stop ends the input early, it's nil if the input ends on its own.
+	stop func()
+
+	// queue holds the packets read before the inputs are synchronized.
+	queue []*AVPacket
+	// offset is the time of the input's zero timestamp on the common timeline, in microseconds.
+	offset int64
+	ended  bool
+	// dropped is set if the input didn't start in time to be part of the files.
+	dropped bool
+	stream  *C.AVStream
+}
+
+// sinkPacket is a packet read from an input, or the error that ended it.
+type sinkPacket struct {
+	input  *sinkInput
+	packet *AVPacket
+	err    error
+}
+
+func (in *sinkInput) run(ch chan<- sinkPacket) {
+	if err := in.source.init(); err != nil {
+		ch <- sinkPacket{input: in, err: err}
+		return
+	}
+	for {
+		p := NewAVPacket()
+		if err := in.source.ReadAVPacket(p); err != nil {
+			p.Close()
+			ch <- sinkPacket{input: in, err: err}
+			return
+		}
+		ch <- sinkPacket{input: in, packet: p}
+	}
+}
+
+// FileSink muxes encoded packets into a container file. The format is guessed from the file name, for
+// example .ivf, .ogg, .mp4, .webm, .mkv or .ts.
+type FileSink struct {
+	path    string
+	segment SegmentConfiguration
+	// formatName overrides the container guessed from the file name, for urls without an extension.
+	formatName  string
+	format      *C.AVOutputFormat
+	avformatctx *C.AVFormatContext
+	inputs      []*sinkInput
+	// primary is the input that files are split on, the first video input if there is one.
+	primary *sinkInput
+	synced  bool
+
+	// the state of the current file, times are in microseconds on the common timeline.
+	index       int
+	filename    string
+	start, last int64
+
+	onFile func(File)
+}
+
+// NewFileSink creates a sink reading from sources, which are *EncodeContexts or *Passthroughs. Each
+// source is written to its own stream, the sources must share a timeline, for example the streams of
+// a file. If the output is segmented, the files are named by SegmentName.
+func NewFileSink(path string, segment SegmentConfiguration, sources ...encodedPacketReader) *FileSink {
+	inputs := make([]*sinkInput, len(sources))
+	for i, source := range sources {
+		inputs[i] = &sinkInput{source: source}
+	}
+	return newFileSink(path, segment, inputs)
+}
+
+func newFileSink(path string, segment SegmentConfiguration, inputs []*sinkInput) *FileSink {
+	return &FileSink{
+		path:    path,
+		segment: segment,
+		inputs:  inputs,
+	}
+}
+
+// OnFile sets a callback that is called after each file is finished. It must be set before Run.
+func (c *FileSink) OnFile(f func(File)) {
+	c.onFile = f
+}
+
+// Run writes the inputs to files until they all end. The trailer is written even if the pipeline fails
+// so the files stay playable. The sink and the pipelines before it are freed when Run returns.
+func (c *FileSink) Run() (err error) {
+	defer c.close()
+
+	cpath := C.CString(c.path)
+	var cformat *C.char
+	if c.formatName != "" {
+		cformat = C.CString(c.formatName)
+	}
+	c.format = C.av_guess_format(cformat, cpath, nil)
+	C.free(unsafe.Pointer(cpath))
+	C.free(unsafe.Pointer(cformat))
+	if c.format == nil {
+		return fmt.Errorf("unknown container format for %s", c.path)
+	}
+	if c.format.flags&C.AVFMT_GLOBALHEADER != 0 {
+		// containers like mp4 and webm store the codec parameters in the header instead of in-band.
+		for _, in := range c.inputs {
+			in.source.useGlobalHeader()
+		}
+	}
+
+	ch := make(chan sinkPacket)
+	for _, in := range c.inputs {
+		go in.run(ch)
+	}
+	running := len(c.inputs)
+	defer func() {
+		// stop the remaining inputs and wait for them so they can be freed.
+		for _, in := range c.inputs {
+			if !in.ended && in.stop != nil {
+				in.stop()
+			}
+		}
+		for running > 0 {
+			if p := <-ch; p.packet != nil {
+				p.packet.Close()
+			} else {
+				running--
+			}
+		}
+	}()
+	defer func() {
+		if ferr := c.finish(); ferr != nil && err == nil {
+			err = ferr
+		}
+	}()
+
+	var timeout <-chan time.Time
+	for running > 0 {
+		select {
+		case p := <-ch:
+			if p.packet == nil {
+				running--
+				p.input.ended = true
+				if p.err != io.EOF {
+					return p.err
+				}
+			} else if p.input.dropped {
+				p.packet.Close()
+			} else if !c.synced {
+				p.input.queue = append(p.input.queue, p.packet)
+				if timeout == nil {
+					timeout = time.After(syncTimeout)
+				}
+			} else if err := c.write(p.input, p.packet); err != nil {
+				return err
+			}
+		case <-timeout:
+			timeout = nil
+			if err := c.sync(); err != nil {
+				return err
+			}
+			continue
+		}
+		if !c.synced && c.ready() {
+			if err := c.sync(); err != nil {
+				return err
+			}
+		}
+	}
+	if !c.synced {
+		// every input ended before they were synchronized.
+		return c.sync()
+	}
+	return nil
+}
+
+// ready returns true if every input has started and can be mapped to the common timeline.
+func (c *FileSink) ready() bool {
+	for _, in := range c.inputs {
+		if in.ended {
+			continue
+		}
+		if len(in.queue) == 0 || (in.clock != nil && !in.clock.synchronized()) {
+			return false
+		}
+	}
+	return true
+}
+
+// sync maps the inputs to the common timeline and writes the packets that were queued. Inputs that
+// haven't started are dropped. If an input has no sender report, the inputs are aligned by the arrival
+// time of their first packet instead since the sender's clock can't be compared to ours.
+func (c *FileSink) sync() error {
+	c.synced = true
+
+	reports := true
+	for _, in := range c.inputs {
+		if len(in.queue) == 0 {
+			in.dropped = true
+			if !in.ended {
+				zap.L().Warn("dropping input that didn't start in time")
+			}
+			continue
+		}
+		if in.clock != nil && !in.clock.synchronized() {
+			reports = false
+		}
+	}
+	if !reports {
+		zap.L().Warn("missing sender reports, aligning inputs by arrival time")
+	}
+
+	var t0 time.Time
+	for _, in := range c.inputs {
+		if in.clock == nil || in.dropped {
+			continue
+		}
+		if start := in.clock.start(reports); t0.IsZero() || start.Before(t0) {
+			t0 = start
+		}
+	}
+	for _, in := range c.inputs {
+		if in.dropped {
+			continue
+		}
+		if in.clock != nil {
+			in.offset = in.clock.start(reports).Sub(t0).Microseconds()
+		}
+		if c.primary == nil && in.source.codecType() == C.AVMEDIA_TYPE_VIDEO {
+			c.primary = in
+		}
+	}
+	if c.primary == nil {
+		for _, in := range c.inputs {
+			if !in.dropped {
+				c.primary = in
+				break
+			}
+		}
+	}
+
+	// the first file is started by the primary input, so write its packets first.
+	inputs := []*sinkInput{c.primary}
+	for _, in := range c.inputs {
+		if in != c.primary {
+			inputs = append(inputs, in)
+		}
+	}
+	for _, in := range inputs {
+		if in == nil {
+			continue
+		}
+		queue := in.queue
+		in.queue = nil
+		for i, p := range queue {
+			if err := c.write(in, p); err != nil {
+				for _, p := range queue[i+1:] {
+					p.Close()
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// segmentName returns the name of the next file.
+func (c *FileSink) segmentName() string {
+	if c.segment == (SegmentConfiguration{}) {
+		return c.path
+	}
+	return SegmentName(c.path, c.index)
+}
+
+// SegmentName returns the name of a segment of a file. The index replaces each %d in path, or is
+// appended to the file name if there's none. path isn't a format string, other % are kept as is.
+func SegmentName(path string, index int) string {
+	if strings.Contains(path, "%d") {
+		return strings.ReplaceAll(path, "%d", strconv.Itoa(index))
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, ext), index, ext)
+}
+
+// duration returns the duration of the current file.
+func (c *FileSink) duration() time.Duration {
+	return time.Duration(c.last-c.start) * time.Microsecond
+}
+
+// full returns true if the current file has reached a segment limit.
+func (c *FileSink) full() bool {
+	if c.segment.Duration > 0 && c.duration() >= c.segment.Duration {
+		return true
+	}
+	return c.segment.Size > 0 && c.avformatctx.pb != nil && int64(C.avio_tell(c.avformatctx.pb)) >= c.segment.Size
+}
+
+// time converts a timestamp of an input to microseconds on the common timeline.
+func (c *FileSink) time(in *sinkInput, ts C.int64_t) int64 {
+	return int64(C.av_rescale_q(ts, in.source.timeBase(), C.av_make_q(1, 1000000))) + in.offset
+}
+
+// write writes a packet to the current file. Files are started at keyframes of the primary input,
+// packets of other inputs are dropped until there's a file.
+func (c *FileSink) write(in *sinkInput, p *AVPacket) error {
+	defer p.Close()
+
+	pkt := p.packet
+	ts := pkt.dts
+	if ts == C.AV_NOPTS_VALUE {
+		ts = pkt.pts
+	}
+	if ts == C.AV_NOPTS_VALUE {
+		// the muxer can't place the packet on the timeline.
+		return nil
+	}
+	t := c.time(in, ts)
+
+	if in == c.primary {
+		if c.avformatctx == nil || c.full() {
+			if pkt.flags&C.AV_PKT_FLAG_KEY == 0 {
+				// files must start with a keyframe to be playable on their own.
+				in.source.requestKeyframe()
+				if c.avformatctx == nil {
+					return nil
+				}
+			} else {
+				if err := c.finish(); err != nil {
+					return err
+				}
+				if err := c.open(); err != nil {
+					return err
+				}
+				c.start = t
+			}
+		}
+		c.last = t
+	} else if c.avformatctx == nil || t < c.start {
+		// the packet is before the start of the file.
+		return nil
+	}
+
+	// every file starts at zero.
+	if pkt.pts != C.AV_NOPTS_VALUE {
+		pkt.pts = C.av_rescale_q(C.int64_t(c.time(in, pkt.pts)-c.start), C.av_make_q(1, 1000000), in.stream.time_base)
+	}
+	if pkt.dts != C.AV_NOPTS_VALUE {
+		pkt.dts = C.av_rescale_q(C.int64_t(c.time(in, pkt.dts)-c.start), C.av_make_q(1, 1000000), in.stream.time_base)
+	}
+	pkt.duration = C.av_rescale_q(pkt.duration, in.source.timeBase(), in.stream.time_base)
+	pkt.stream_index = in.stream.index
+	// av_interleaved_write_frame orders the packets of the streams by timestamp.
+	if averr := C.av_interleaved_write_frame(c.avformatctx, pkt); averr < 0 {
+		return av_err("av_interleaved_write_frame", averr)
+	}
+	return nil
+}
+
+// open starts the next file with a stream for every input.
+func (c *FileSink) open() (err error) {
+	c.filename = c.segmentName()
+	c.index++
+
+	cfilename := C.CString(c.filename)
+	defer C.free(unsafe.Pointer(cfilename))
+
+	if averr := C.avformat_alloc_output_context2(&c.avformatctx, c.format, nil, cfilename); averr < 0 {
+		return av_err("avformat_alloc_output_context2", averr)
+	}
+	defer func() {
+		if err != nil {
+			c.closeFile()
+		}
+	}()
+
+	for _, in := range c.inputs {
+		if in.dropped {
+			continue
+		}
+		stream := C.avformat_new_stream(c.avformatctx, nil)
+		if stream == nil {
+			return errors.New("failed to create stream")
+		}
+		if err := in.source.parameters(stream.codecpar); err != nil {
+			return err
+		}
+		// a hint, the muxer may choose another time base when the header is written.
+		stream.time_base = in.source.timeBase()
+		in.stream = stream
+	}
+
+	if c.format.flags&C.AVFMT_NOFILE == 0 {
+		if averr := C.avio_open(&c.avformatctx.pb, cfilename, C.AVIO_FLAG_WRITE); averr < 0 {
+			return av_err("avio_open", averr)
+		}
+	}
+
+	if averr := C.avformat_write_header(c.avformatctx, nil); averr < 0 {
+		return av_err("avformat_write_header", averr)
+	}
+
+	return nil
+}
+
+// finish writes the trailer of the current file and closes it.
+func (c *FileSink) finish() error {
+	if c.avformatctx == nil {
+		return nil
+	}
+	averr := C.av_write_trailer(c.avformatctx)
+	file := File{Path: c.filename, Duration: c.duration()}
+	c.closeFile()
+	if averr < 0 {
+		return av_err("av_write_trailer", averr)
+	}
+	if info, err := os.Stat(file.Path); err == nil {
+		file.Size = info.Size()
+	}
+	if c.onFile != nil {
+		c.onFile(file)
+	}
+	return nil
+}
+
+func (c *FileSink) closeFile() {
+	if c.avformatctx == nil {
+		return
+	}
+	if c.format.flags&C.AVFMT_NOFILE == 0 {
+		C.avio_closep(&c.avformatctx.pb)
+	}
+	C.avformat_free_context(c.avformatctx)
+	c.avformatctx = nil
+	for _, in := range c.inputs {
+		in.stream = nil
+	}
+}
+
+// close closes the current file and frees the sink and the pipelines before it.
+func (c *FileSink) close() {
+	c.closeFile()
+	for _, in := range c.inputs {
+		for _, p := range in.queue {
+			p.Close()
+		}
+		in.queue = nil
+		in.source.close()
+	}
+}
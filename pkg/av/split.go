@@ -0,0 +1,185 @@
+package av
+
+/*
+#cgo pkg-config: libavcodec libavutil
+#include <libavcodec/avcodec.h>
+#include <libavutil/frame.h>
+*/
+import "C"
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// SplitContext fans the frames of a single decoder out to several stages so the input is only demuxed
+// and decoded once.
+type SplitContext struct {
+	decoder *DecodeContext
+
+	mu      sync.Mutex
+	outputs []*SplitOutput
+	err     error
+
+	initOnce, runOnce sync.Once
+	initErr           error
+}
+
+type SplitOutput struct {
+	split *SplitContext
+	ch    chan *splitResult
+	done  chan struct{}
+	once  sync.Once
+}
+
+type splitResult struct {
+	f *AVFrame
+	e error
+}
+
+func NewSplitter(decoder *DecodeContext) *SplitContext {
+	return &SplitContext{decoder: decoder}
+}
+
+// NewOutput creates an output that receives every decoded frame from now on. Outputs can be added while
+// the splitter is running, and every output must be read or closed, as the slowest output paces the
+// decoder.
+func (c *SplitContext) NewOutput() *SplitOutput {
+	o := &SplitOutput{
+		split: c,
+		ch:    make(chan *splitResult, 1),
+		done:  make(chan struct{}),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		// the decoder has already finished.
+		o.ch <- &splitResult{e: c.err}
+		close(o.ch)
+		return o
+	}
+	c.outputs = append(c.outputs, o)
+	return o
+}
+
+func (c *SplitContext) run() {
+	frame := NewAVFrame()
+	defer frame.Close()
+	for {
+		if err := c.decoder.ReadAVFrame(frame); err != nil {
+			c.fail(err)
+			return
+		}
+		c.mu.Lock()
+		outputs := append([]*SplitOutput(nil), c.outputs...)
+		c.mu.Unlock()
+		for _, o := range outputs {
+			clone := C.av_frame_clone(frame.frame)
+			if clone == nil {
+				c.fail(errors.New("failed to clone frame"))
+				return
+			}
+			f := &AVFrame{frame: clone}
+			select {
+			case o.ch <- &splitResult{f: f}:
+			case <-o.done:
+				f.Close()
+			}
+		}
+	}
+}
+
+func (c *SplitContext) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	for _, o := range c.outputs {
+		select {
+		case o.ch <- &splitResult{e: err}:
+		case <-o.done:
+		}
+		close(o.ch)
+	}
+	c.outputs = nil
+}
+
+// remove detaches an output so the splitter no longer waits for it.
+func (c *SplitContext) remove(o *SplitOutput) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, output := range c.outputs {
+		if output == o {
+			c.outputs = append(c.outputs[:i], c.outputs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (o *SplitOutput) init() error {
+	o.split.initOnce.Do(func() {
+		o.split.initErr = o.split.decoder.init()
+	})
+	if o.split.initErr != nil {
+		return o.split.initErr
+	}
+	// decode even if no output is being read so closing the input always frees the decoder.
+	o.split.runOnce.Do(func() {
+		go o.split.run()
+	})
+	return nil
+}
+
+// Close frees the decoder if it was never started. Otherwise the decoder is freed when its input ends.
+func (c *SplitContext) Close() error {
+	c.initOnce.Do(func() {
+		c.initErr = io.ErrClosedPipe
+		c.decoder.close()
+	})
+	return nil
+}
+
+func (o *SplitOutput) decoderContext() *C.AVCodecContext {
+	return o.split.decoder.decoderctx
+}
+
+func (o *SplitOutput) configure(encoderctx *C.AVCodecContext) {
+	o.split.decoder.configure(encoderctx)
+}
+
+func (o *SplitOutput) ReadAVFrame(f *AVFrame) error {
+	C.av_frame_unref(f.frame)
+	var r *splitResult
+	var ok bool
+	select {
+	case r, ok = <-o.ch:
+	case <-o.done:
+	}
+	if !ok {
+		return io.EOF
+	}
+	if r.e != nil {
+		return r.e
+	}
+	C.av_frame_move_ref(f.frame, r.f.frame)
+	return r.f.Close()
+}
+
+// Close detaches the output from the splitter. Frames that were already buffered are dropped.
+func (o *SplitOutput) Close() error {
+	o.once.Do(func() {
+		o.split.remove(o)
+		close(o.done)
+		select {
+		case r, ok := <-o.ch:
+			if ok && r.f != nil {
+				r.f.Close()
+			}
+		default:
+		}
+	})
+	return nil
+}
+
+func (o *SplitOutput) close() {
+	o.Close()
+}
@@ -6,6 +6,11 @@ package av
 */
 import "C"
 import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pion/rtp"
 	"github.com/pion/rtpio/pkg/rtpio"
 	"github.com/pion/webrtc/v3"
 )
@@ -14,20 +19,206 @@ func init() {
 	C.av_log_set_level(48)
 }
 
+// Transcoder decodes the rtp packets written to it and encodes them to another codec. Closing it ends the
+// input, the output is drained and the pipeline is freed once the last packet is read.
 type Transcoder struct {
 	rtpio.RTPWriteCloser
 	rtpio.RTPReader
+	decoder *DecodeContext
+	encoder *EncodeContext
 }
 
-func NewTranscoder(from webrtc.RTPCodecParameters, to webrtc.RTPCodecCapability) (*Transcoder, error) {
+func NewTranscoder(from webrtc.RTPCodecParameters, to webrtc.RTPCodecCapability, config EncoderConfiguration) (*Transcoder, error) {
 	r, w := rtpio.RTPPipe()
-	demux := NewDemuxer(from, r)
-	decode := NewDecoder(from, demux)
-	encode := NewEncoder(to, decode)
+	decode := NewDecoder(NewDemuxer(from, r))
+	encode := newEncoder(to, config, decode)
 	mux := NewMuxer(to, encode)
 
 	return &Transcoder{
 		RTPWriteCloser: w,
-		RTPReader: mux,
+		RTPReader:      mux,
+		decoder:        decode,
+		encoder:        encode,
+	}, nil
+}
+
+// newEncoder creates an encoder for the decoded frames, with a scaler for video and a resampler for audio
+// in between.
+func newEncoder(to webrtc.RTPCodecCapability, config EncoderConfiguration, decoder decodedFrameReader) *EncodeContext {
+	if strings.HasPrefix(to.MimeType, "video") {
+		return NewEncoder(to, config, NewScaler(config.Width, config.Height, config.ScaleMode, decoder))
+	}
+	return NewEncoder(to, config, NewResampler(to, decoder))
+}
+
+// NewFileTranscoder creates a transcoder that reads a stream of the given kind from the file at path,
+// for example to send a recording as rtp. Packets are produced as fast as the file can be transcoded.
+func NewFileTranscoder(path string, kind webrtc.RTPCodecType, to webrtc.RTPCodecCapability, config EncoderConfiguration) (*Transcoder, error) {
+	decode := NewDecoder(NewFileSource(path, kind))
+	encode := newEncoder(to, config, decode)
+	mux := NewMuxer(to, encode)
+
+	return &Transcoder{
+		RTPWriteCloser: fileInput{},
+		RTPReader:      mux,
+		decoder:        decode,
+		encoder:        encode,
+	}, nil
+}
+
+// fileInput is the write side of a transcoder that reads from a file.
+type fileInput struct{}
+
+func (fileInput) WriteRTP(*rtp.Packet) error {
+	return errors.New("transcoder reads from a file")
+}
+
+func (fileInput) Close() error {
+	return nil
+}
+
+// TranscodeFile transcodes a stream of the given kind from one file to another, the output container is
+// guessed from the file name.
+func TranscodeFile(in, out string, kind webrtc.RTPCodecType, to webrtc.RTPCodecCapability, config EncoderConfiguration) error {
+	return NewFileSink(out, SegmentConfiguration{}, newEncoder(to, config, NewDecoder(NewFileSource(in, kind)))).Run()
+}
+
+// SetBitrate updates the target bitrate of the encoder, see (*EncodeContext).SetBitrate.
+func (t *Transcoder) SetBitrate(bitrate int64) {
+	t.encoder.SetBitrate(bitrate)
+}
+
+// AdaptBitrate makes the encoder follow SetBitrate, see (*EncodeContext).AdaptBitrate.
+func (t *Transcoder) AdaptBitrate(initial int64) {
+	t.encoder.AdaptBitrate(initial)
+}
+
+// ForceKeyframe makes the next output frame a keyframe.
+func (t *Transcoder) ForceKeyframe() {
+	t.encoder.ForceKeyframe()
+}
+
+// OnKeyframeRequest sets a callback that is called when the input needs a keyframe to recover from loss.
+func (t *Transcoder) OnKeyframeRequest(f func()) {
+	t.decoder.OnKeyframeRequest(f)
+}
+
+// SimulcastTranscoder decodes a single input once and encodes it to several renditions.
+type SimulcastTranscoder struct {
+	rtpio.RTPWriteCloser
+	Layers   []rtpio.RTPReader
+	decoder  *DecodeContext
+	encoders []*EncodeContext
+}
+
+func NewSimulcastTranscoder(from webrtc.RTPCodecParameters, to webrtc.RTPCodecCapability, configs []EncoderConfiguration) (*SimulcastTranscoder, error) {
+	d := NewSharedDecoder(from)
+	t, err := d.NewSimulcastTranscoder(to, configs)
+	if err != nil {
+		return nil, err
+	}
+	t.RTPWriteCloser = d
+	return t, nil
+}
+
+// ForceKeyframe makes the next frame of the given layer a keyframe.
+func (t *SimulcastTranscoder) ForceKeyframe(layer int) {
+	t.encoders[layer].ForceKeyframe()
+}
+
+// OnKeyframeRequest sets a callback that is called when the input needs a keyframe to recover from loss.
+func (t *SimulcastTranscoder) OnKeyframeRequest(f func()) {
+	t.decoder.OnKeyframeRequest(f)
+}
+
+// SharedDecoder decodes a single input once for any number of transcoders, which can be added while
+// it's running. The transcoders it creates read from the decoder and can't be written to, closing them
+// detaches them from the decoder.
+type SharedDecoder struct {
+	rtpio.RTPWriteCloser
+	decoder *DecodeContext
+	split   *SplitContext
+}
+
+// sharedInput is the write side of a transcoder created by a SharedDecoder.
+type sharedInput []*SplitOutput
+
+func (s sharedInput) WriteRTP(*rtp.Packet) error {
+	return errors.New("transcoder reads from a shared decoder")
+}
+
+func (s sharedInput) Close() error {
+	for _, o := range s {
+		o.Close()
+	}
+	return nil
+}
+
+func NewSharedDecoder(from webrtc.RTPCodecParameters) *SharedDecoder {
+	r, w := rtpio.RTPPipe()
+	decode := NewDecoder(NewDemuxer(from, r))
+	return &SharedDecoder{
+		RTPWriteCloser: w,
+		decoder:        decode,
+		split:          NewSplitter(decode),
+	}
+}
+
+// Close ends the input, which ends the output of every transcoder created by the decoder.
+func (d *SharedDecoder) Close() error {
+	err := d.RTPWriteCloser.Close()
+	d.split.Close()
+	return err
+}
+
+// OnKeyframeRequest sets a callback that is called when the input needs a keyframe to recover from loss.
+func (d *SharedDecoder) OnKeyframeRequest(f func()) {
+	d.decoder.OnKeyframeRequest(f)
+}
+
+// NewTranscoder creates a transcoder that encodes the decoded input.
+func (d *SharedDecoder) NewTranscoder(to webrtc.RTPCodecCapability, config EncoderConfiguration) (*Transcoder, error) {
+	output := d.split.NewOutput()
+	encode := newEncoder(to, config, output)
+
+	return &Transcoder{
+		RTPWriteCloser: sharedInput{output},
+		RTPReader:      NewMuxer(to, encode),
+		decoder:        d.decoder,
+		encoder:        encode,
+	}, nil
+}
+
+// NewCMAFTranscoder creates a transcoder that packages the decoded input as fragmented mp4, see
+// NewCMAFTranscoder.
+func (d *SharedDecoder) NewCMAFTranscoder(to webrtc.RTPCodecCapability, config EncoderConfiguration, cmaf CMAFConfiguration) *CMAFTranscoder {
+	output := d.split.NewOutput()
+	return &CMAFTranscoder{
+		CMAFMuxer: NewCMAFMuxer(cmaf, newEncoder(to, config, output)),
+		w:         sharedInput{output},
+		decoder:   d.decoder,
+	}
+}
+
+// NewSimulcastTranscoder creates a transcoder that encodes the decoded input to several renditions.
+func (d *SharedDecoder) NewSimulcastTranscoder(to webrtc.RTPCodecCapability, configs []EncoderConfiguration) (*SimulcastTranscoder, error) {
+	if !strings.HasPrefix(to.MimeType, "video") {
+		return nil, fmt.Errorf("simulcast is not supported for %s", to.MimeType)
+	}
+	outputs := make(sharedInput, len(configs))
+	layers := make([]rtpio.RTPReader, len(configs))
+	encoders := make([]*EncodeContext, len(configs))
+	for i, config := range configs {
+		outputs[i] = d.split.NewOutput()
+		scale := NewScaler(config.Width, config.Height, config.ScaleMode, outputs[i])
+		encoders[i] = NewEncoder(to, config, scale)
+		layers[i] = NewMuxer(to, encoders[i])
+	}
+
+	return &SimulcastTranscoder{
+		RTPWriteCloser: outputs,
+		Layers:         layers,
+		decoder:        d.decoder,
+		encoders:       encoders,
 	}, nil
 }
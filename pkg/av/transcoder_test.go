@@ -0,0 +1,55 @@
+package av
+
+import (
+	"io"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestTranscoderSetBitrate(t *testing.T) {
+	tc, err := NewFileTranscoder("../../test/input.ivf", webrtc.RTPCodecTypeVideo, webrtc.RTPCodecCapability{
+		MimeType:  webrtc.MimeTypeH264,
+		ClockRate: 90000,
+	}, EncoderConfiguration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.AdaptBitrate(1000 * 1000)
+
+	// input.ivf has 120 frames, lower the bitrate after the first 40 and compare the size of the first
+	// and last 40 frames.
+	var sizes []int
+	var timestamp uint32
+	for {
+		p, err := tc.ReadRTP()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sizes) == 0 || p.Timestamp != timestamp {
+			sizes = append(sizes, 0)
+			timestamp = p.Timestamp
+			if len(sizes) == 40 {
+				tc.SetBitrate(minBitrate)
+			}
+		}
+		sizes[len(sizes)-1] += len(p.Payload)
+	}
+	if len(sizes) < 120 {
+		t.Fatalf("got %d frames, want 120", len(sizes))
+	}
+
+	sum := func(sizes []int) (n int) {
+		for _, size := range sizes {
+			n += size
+		}
+		return n
+	}
+	before, after := sum(sizes[:40]), sum(sizes[len(sizes)-40:])
+	if after*2 > before {
+		t.Errorf("got %d bytes after lowering the bitrate, want less than half of %d bytes before", after, before)
+	}
+}
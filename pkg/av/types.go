@@ -40,4 +40,4 @@ func NewAVFrame() *AVFrame {
 func (f *AVFrame) Close() error {
 	C.av_frame_free(&f.frame)
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,27 @@
+package codecs
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// AACPayloader payloads raw AAC frames as mpeg4-generic in the AAC-hbr mode, see RFC 3640. Each frame
+// is sent in its own packet, the frames are small so they're never fragmented.
+type AACPayloader struct{}
+
+func (p *AACPayloader) Payload(mtu uint16, payload []byte) [][]byte {
+	if len(payload) == 0 || len(payload) > 0x1fff {
+		return nil
+	}
+	out := make([]byte, 4+len(payload))
+	// the AU headers are 16 bits long, a 13 bit size and a 3 bit index.
+	out[0], out[1] = 0x00, 0x10
+	out[2], out[3] = byte(len(payload)>>5), byte(len(payload)<<3)
+	copy(out[4:], payload)
+	return [][]byte{out}
+}
+
+// AACFmtpLine returns the fmtp line of an mpeg4-generic stream with the AudioSpecificConfig config.
+func AACFmtpLine(config []byte) string {
+	return fmt.Sprintf("streamtype=5;profile-level-id=1;mode=AAC-hbr;sizelength=13;indexlength=3;indexdeltalength=3;config=%s", hex.EncodeToString(config))
+}
@@ -0,0 +1,67 @@
+package codecs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAACFmtpLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		config []byte
+		want   string
+	}{
+		{
+			name:   "44.1 kHz stereo",
+			config: []byte{0x12, 0x10},
+			want:   "streamtype=5;profile-level-id=1;mode=AAC-hbr;sizelength=13;indexlength=3;indexdeltalength=3;config=1210",
+		},
+		{
+			name:   "explicit rate",
+			config: []byte{0x17, 0x80, 0x18, 0x1c, 0x88},
+			want:   "streamtype=5;profile-level-id=1;mode=AAC-hbr;sizelength=13;indexlength=3;indexdeltalength=3;config=1780181c88",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AACFmtpLine(tt.config); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAACPayloader(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    [][]byte
+	}{
+		{
+			name:    "frame",
+			payload: []byte{0x21, 0x10, 0x04},
+			// one 16 bit AU header with a size of 3 and an index of 0.
+			want: [][]byte{{0x00, 0x10, 0x00, 0x18, 0x21, 0x10, 0x04}},
+		},
+		{
+			name:    "largest frame",
+			payload: make([]byte, 0x1fff),
+			want:    [][]byte{append([]byte{0x00, 0x10, 0xff, 0xf8}, make([]byte, 0x1fff)...)},
+		},
+		{name: "empty", payload: nil},
+		{name: "too large", payload: make([]byte, 0x2000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := (&AACPayloader{}).Payload(1200, tt.payload)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d packets, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Errorf("packet %d: got %x, want %x", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package codecs
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// MediaCodec returns the codec of the first payload type of a media section, for example one written
+// by ffmpeg. Static payload types don't need an rtpmap.
+func MediaCodec(s *sdp.SessionDescription, md *sdp.MediaDescription) (webrtc.RTPCodecParameters, error) {
+	if len(md.MediaName.Formats) == 0 {
+		return webrtc.RTPCodecParameters{}, fmt.Errorf("no payload type in %s media section", md.MediaName.Media)
+	}
+	pt, err := strconv.ParseUint(md.MediaName.Formats[0], 10, 8)
+	if err != nil {
+		return webrtc.RTPCodecParameters{}, fmt.Errorf("invalid payload type %q", md.MediaName.Formats[0])
+	}
+	codec, err := s.GetCodecForPayloadType(uint8(pt))
+	if err != nil {
+		for _, c := range DefaultOutputCodecs {
+			if pt < 96 && uint64(c.PayloadType) == pt {
+				return c, nil
+			}
+		}
+		return webrtc.RTPCodecParameters{}, fmt.Errorf("no rtpmap for payload type %d", pt)
+	}
+	var channels uint64
+	if codec.EncodingParameters != "" {
+		if channels, err = strconv.ParseUint(codec.EncodingParameters, 10, 16); err != nil {
+			return webrtc.RTPCodecParameters{}, fmt.Errorf("invalid channels %q", codec.EncodingParameters)
+		}
+	}
+	return webrtc.RTPCodecParameters{
+		PayloadType: webrtc.PayloadType(pt),
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    md.MediaName.Media + "/" + codec.Name,
+			ClockRate:   codec.ClockRate,
+			Channels:    uint16(channels),
+			SDPFmtpLine: codec.Fmtp,
+		},
+	}, nil
+}
@@ -0,0 +1,79 @@
+package codecs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestMediaCodec(t *testing.T) {
+	tests := []struct {
+		name    string
+		sdp     string
+		want    webrtc.RTPCodecParameters
+		wantErr bool
+	}{
+		{
+			name: "ffmpeg h264",
+			sdp: "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=No Name\r\nc=IN IP4 127.0.0.1\r\nt=0 0\r\n" +
+				"m=video 5004 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\na=fmtp:96 packetization-mode=1\r\n",
+			want: webrtc.RTPCodecParameters{
+				PayloadType:        96,
+				RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: "video/H264", ClockRate: 90000, SDPFmtpLine: "packetization-mode=1"},
+			},
+		},
+		{
+			name: "opus channels",
+			sdp: "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\n" +
+				"m=audio 5006 RTP/AVP 111 0\r\na=rtpmap:111 opus/48000/2\r\n",
+			want: webrtc.RTPCodecParameters{
+				PayloadType:        111,
+				RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: "audio/opus", ClockRate: 48000, Channels: 2},
+			},
+		},
+		{
+			name: "static payload type",
+			sdp:  "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\nm=audio 5006 RTP/AVP 0\r\n",
+			want: DefaultOutputCodecs[webrtc.MimeTypePCMU],
+		},
+		{
+			name:    "dynamic payload type without rtpmap",
+			sdp:     "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\nm=video 5004 RTP/AVP 96\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid payload type",
+			sdp:     "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\nm=video 5004 RTP/AVP 300\r\n",
+			wantErr: true,
+		},
+		{
+			name: "invalid channels",
+			sdp: "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\n" +
+				"m=audio 5006 RTP/AVP 111\r\na=rtpmap:111 opus/48000/stereo\r\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &sdp.SessionDescription{}
+			if err := s.Unmarshal([]byte(tt.sdp)); err != nil {
+				t.Fatal(err)
+			}
+			got, err := MediaCodec(s, s.MediaDescriptions[0])
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// the AMF0 markers, see https://rtmp.veriskope.com/pdf/amf0-file-format-specification.pdf
+const (
+	amfNumber      = 0x00
+	amfBoolean     = 0x01
+	amfString      = 0x02
+	amfObject      = 0x03
+	amfNull        = 0x05
+	amfUndefined   = 0x06
+	amfECMAArray   = 0x08
+	amfObjectEnd   = 0x09
+	amfStrictArray = 0x0a
+	amfDate        = 0x0b
+	amfLongString  = 0x0c
+)
+
+var errInvalidAMF = errors.New("invalid amf0 value")
+
+// decodeAMF decodes every AMF0 value of a command or data message. Numbers are float64, objects and
+// ECMA arrays are map[string]interface{}, strict arrays are []interface{}, and null and undefined are nil.
+func decodeAMF(buf []byte) ([]interface{}, error) {
+	r := bytes.NewReader(buf)
+	var values []interface{}
+	for r.Len() > 0 {
+		value, err := readAMF(r)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func readAMF(r *bytes.Reader) (interface{}, error) {
+	marker, err := r.ReadByte()
+	if err != nil {
+		return nil, errInvalidAMF
+	}
+	switch marker {
+	case amfNumber:
+		var n uint64
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, errInvalidAMF
+		}
+		return math.Float64frombits(n), nil
+	case amfBoolean:
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, errInvalidAMF
+		}
+		return b != 0, nil
+	case amfString:
+		return readAMFString(r, 2)
+	case amfLongString:
+		return readAMFString(r, 4)
+	case amfObject:
+		return readAMFProperties(r)
+	case amfECMAArray:
+		// the count is only a hint, the properties end with an object end marker like an object.
+		if _, err := r.Seek(4, io.SeekCurrent); err != nil {
+			return nil, errInvalidAMF
+		}
+		return readAMFProperties(r)
+	case amfStrictArray:
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, errInvalidAMF
+		}
+		var values []interface{}
+		for i := uint32(0); i < n; i++ {
+			value, err := readAMF(r)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case amfDate:
+		var date struct {
+			Milliseconds uint64
+			Timezone     int16
+		}
+		if err := binary.Read(r, binary.BigEndian, &date); err != nil {
+			return nil, errInvalidAMF
+		}
+		return math.Float64frombits(date.Milliseconds), nil
+	case amfNull, amfUndefined:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported amf0 marker %#x", marker)
+}
+
+func readAMFString(r *bytes.Reader, size int) (string, error) {
+	var n uint32
+	if size == 2 {
+		var n16 uint16
+		if err := binary.Read(r, binary.BigEndian, &n16); err != nil {
+			return "", errInvalidAMF
+		}
+		n = uint32(n16)
+	} else if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return "", errInvalidAMF
+	}
+	if int64(n) > int64(r.Len()) {
+		return "", errInvalidAMF
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", errInvalidAMF
+	}
+	return string(buf), nil
+}
+
+func readAMFProperties(r *bytes.Reader) (map[string]interface{}, error) {
+	properties := make(map[string]interface{})
+	for {
+		key, err := readAMFString(r, 2)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			marker, err := r.ReadByte()
+			if err != nil || marker != amfObjectEnd {
+				return nil, errInvalidAMF
+			}
+			return properties, nil
+		}
+		value, err := readAMF(r)
+		if err != nil {
+			return nil, err
+		}
+		properties[key] = value
+	}
+}
+
+// encodeAMF encodes values as AMF0. It only supports the types the server sends: numbers, booleans,
+// strings, objects as map[string]interface{}, and nil as null.
+func encodeAMF(values ...interface{}) []byte {
+	var b bytes.Buffer
+	for _, value := range values {
+		writeAMF(&b, value)
+	}
+	return b.Bytes()
+}
+
+func writeAMF(b *bytes.Buffer, value interface{}) {
+	switch value := value.(type) {
+	case float64:
+		b.WriteByte(amfNumber)
+		binary.Write(b, binary.BigEndian, math.Float64bits(value))
+	case int:
+		writeAMF(b, float64(value))
+	case bool:
+		b.WriteByte(amfBoolean)
+		if value {
+			b.WriteByte(1)
+		} else {
+			b.WriteByte(0)
+		}
+	case string:
+		b.WriteByte(amfString)
+		writeAMFString(b, value)
+	case map[string]interface{}:
+		b.WriteByte(amfObject)
+		// sort the keys so the messages are deterministic.
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			writeAMFString(b, key)
+			writeAMF(b, value[key])
+		}
+		writeAMFString(b, "")
+		b.WriteByte(amfObjectEnd)
+	default:
+		b.WriteByte(amfNull)
+	}
+}
+
+func writeAMFString(b *bytes.Buffer, s string) {
+	binary.Write(b, binary.BigEndian, uint16(len(s)))
+	b.WriteString(s)
+}
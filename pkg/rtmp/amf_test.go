@@ -0,0 +1,86 @@
+package rtmp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeAMF(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  []interface{}
+	}{
+		{name: "number", input: []byte{amfNumber, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0}, want: []interface{}{1.0}},
+		{name: "boolean", input: []byte{amfBoolean, 0x01, amfBoolean, 0x00}, want: []interface{}{true, false}},
+		{name: "string", input: []byte{amfString, 0x00, 0x03, 'a', 'b', 'c'}, want: []interface{}{"abc"}},
+		{name: "long string", input: []byte{amfLongString, 0x00, 0x00, 0x00, 0x01, 'a'}, want: []interface{}{"a"}},
+		{name: "null and undefined", input: []byte{amfNull, amfUndefined}, want: []interface{}{nil, nil}},
+		{
+			name:  "object",
+			input: []byte{amfObject, 0x00, 0x01, 'a', amfString, 0x00, 0x01, 'b', 0x00, 0x00, amfObjectEnd},
+			want:  []interface{}{map[string]interface{}{"a": "b"}},
+		},
+		{
+			// the count is a hint, the properties are read until the end marker.
+			name:  "ecma array",
+			input: []byte{amfECMAArray, 0x00, 0x00, 0x00, 0x05, 0x00, 0x01, 'a', amfBoolean, 0x01, 0x00, 0x00, amfObjectEnd},
+			want:  []interface{}{map[string]interface{}{"a": true}},
+		},
+		{
+			name:  "strict array",
+			input: []byte{amfStrictArray, 0x00, 0x00, 0x00, 0x02, amfNull, amfString, 0x00, 0x00},
+			want:  []interface{}{[]interface{}{nil, ""}},
+		},
+		{
+			name:  "date",
+			input: []byte{amfDate, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0, 0x00, 0x00},
+			want:  []interface{}{1.0},
+		},
+		{
+			name: "connect",
+			input: encodeAMF("connect", 1, map[string]interface{}{
+				"app":   "live",
+				"tcUrl": "rtmp://localhost/live",
+			}),
+			want: []interface{}{"connect", 1.0, map[string]interface{}{"app": "live", "tcUrl": "rtmp://localhost/live"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeAMF(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeAMFInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "truncated number", input: []byte{amfNumber, 0x3f, 0xf0}},
+		{name: "truncated boolean", input: []byte{amfBoolean}},
+		{name: "truncated string length", input: []byte{amfString, 0x00}},
+		{name: "truncated string", input: []byte{amfString, 0x00, 0x03, 'a'}},
+		{name: "truncated long string", input: []byte{amfLongString, 0xff, 0xff, 0xff, 0xff, 'a'}},
+		{name: "truncated object", input: []byte{amfObject, 0x00, 0x01, 'a', amfNull}},
+		{name: "object without end marker", input: []byte{amfObject, 0x00, 0x00, amfNull}},
+		{name: "truncated ecma array", input: []byte{amfECMAArray, 0x00, 0x00}},
+		{name: "truncated strict array", input: []byte{amfStrictArray, 0x00, 0x00, 0x00, 0x02, amfNull}},
+		{name: "truncated date", input: []byte{amfDate, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0}},
+		{name: "unsupported marker", input: []byte{0x11}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := decodeAMF(tt.input); err == nil {
+				t.Errorf("expected an error, got %#v", got)
+			}
+		})
+	}
+}
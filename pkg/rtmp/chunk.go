@@ -0,0 +1,316 @@
+package rtmp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// the message types, see https://rtmp.veriskope.com/docs/spec/#54protocol-control-messages
+const (
+	msgSetChunkSize     = 1
+	msgAbort            = 2
+	msgAcknowledgement  = 3
+	msgUserControl      = 4
+	msgWindowAckSize    = 5
+	msgSetPeerBandwidth = 6
+	msgAudio            = 8
+	msgVideo            = 9
+	msgDataAMF3         = 15
+	msgCommandAMF3      = 17
+	msgDataAMF0         = 18
+	msgCommandAMF0      = 20
+)
+
+// the chunk streams the server sends on.
+const (
+	csidControl = 2
+	csidCommand = 3
+)
+
+const (
+	defaultChunkSize = 128
+	// maxChunkSize bounds the chunk size a client can set, which is buffered for every chunk.
+	maxChunkSize = 1 << 24
+	// readTimeout closes connections that stop sending, publishers send media continuously.
+	readTimeout = 30 * time.Second
+	// windowAckSize is the window the server asks the client to acknowledge, and its output bandwidth.
+	windowAckSize = 2500000
+	// handshakeSize is the size of the C1, C2, S1 and S2 handshake packets.
+	handshakeSize = 1536
+)
+
+type message struct {
+	typ       uint8
+	timestamp uint32
+	streamID  uint32
+	payload   []byte
+}
+
+// chunkStream is the state of an incoming chunk stream, the headers of later chunks are compressed
+// against it.
+type chunkStream struct {
+	timestamp, delta uint32
+	length           uint32
+	typ              uint8
+	streamID         uint32
+	extended         bool
+	// buf is the message being reassembled from the chunks.
+	buf []byte
+}
+
+// conn reads and writes the chunks of an RTMP connection.
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+
+	streams        map[uint32]*chunkStream
+	readChunkSize  uint32
+	writeChunkSize uint32
+
+	// the client's acknowledgement window, and the bytes read since the last acknowledgement.
+	ackWindow, read, acked uint32
+}
+
+func newConn(c net.Conn) *conn {
+	return &conn{
+		Conn:           c,
+		r:              bufio.NewReader(c),
+		streams:        make(map[uint32]*chunkStream),
+		readChunkSize:  defaultChunkSize,
+		writeChunkSize: defaultChunkSize,
+	}
+}
+
+func (c *conn) Read(buf []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(buf)
+	c.read += uint32(n)
+	return n, err
+}
+
+// handshake performs the simple handshake, the digest handshake is only needed by flash players.
+func (c *conn) handshake() error {
+	c0c1 := make([]byte, 1+handshakeSize)
+	if _, err := io.ReadFull(c, c0c1); err != nil {
+		return err
+	}
+	if c0c1[0] != 3 {
+		return fmt.Errorf("unsupported rtmp version %d", c0c1[0])
+	}
+	s0s1s2 := make([]byte, 1+2*handshakeSize)
+	s0s1s2[0] = 3
+	binary.BigEndian.PutUint32(s0s1s2[1:], uint32(time.Now().Unix()))
+	// s2 echoes c1.
+	copy(s0s1s2[1+handshakeSize:], c0c1[1:])
+	if _, err := c.Write(s0s1s2); err != nil {
+		return err
+	}
+	c2 := make([]byte, handshakeSize)
+	_, err := io.ReadFull(c, c2)
+	return err
+}
+
+func (c *conn) readUint(n int) (uint32, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(c, buf[4-n:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(buf[:]), nil
+}
+
+// readMessage reads chunks until a message is complete. Protocol control messages are handled and
+// not returned.
+func (c *conn) readMessage() (*message, error) {
+	for {
+		m, err := c.readChunk()
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			continue
+		}
+		if err := c.acknowledge(); err != nil {
+			return nil, err
+		}
+		switch m.typ {
+		case msgSetChunkSize:
+			if len(m.payload) < 4 {
+				return nil, errors.New("invalid set chunk size message")
+			}
+			size := binary.BigEndian.Uint32(m.payload) & 0x7fffffff
+			if size == 0 || size > maxChunkSize {
+				return nil, fmt.Errorf("invalid chunk size %d", size)
+			}
+			c.readChunkSize = size
+		case msgAbort:
+			if len(m.payload) >= 4 {
+				if cs, ok := c.streams[binary.BigEndian.Uint32(m.payload)]; ok {
+					cs.buf = nil
+				}
+			}
+		case msgWindowAckSize:
+			if len(m.payload) >= 4 {
+				c.ackWindow = binary.BigEndian.Uint32(m.payload)
+			}
+		case msgAcknowledgement, msgUserControl, msgSetPeerBandwidth:
+		default:
+			return m, nil
+		}
+	}
+}
+
+// readChunk reads a chunk, returning the message it completes or nil if the message continues.
+func (c *conn) readChunk() (*message, error) {
+	b, err := c.readUint(1)
+	if err != nil {
+		return nil, err
+	}
+	format, csid := b>>6, b&0x3f
+	switch csid {
+	case 0:
+		n, err := c.readUint(1)
+		if err != nil {
+			return nil, err
+		}
+		csid = 64 + n
+	case 1:
+		n, err := c.readUint(2)
+		if err != nil {
+			return nil, err
+		}
+		// the two byte form is little endian.
+		csid = 64 + n>>8 + (n&0xff)<<8
+	}
+
+	cs, ok := c.streams[csid]
+	if !ok {
+		if format != 0 {
+			return nil, fmt.Errorf("chunk stream %d doesn't start with a full header", csid)
+		}
+		cs = &chunkStream{}
+		c.streams[csid] = cs
+	}
+
+	var timestamp uint32
+	if format <= 2 {
+		if timestamp, err = c.readUint(3); err != nil {
+			return nil, err
+		}
+		cs.extended = timestamp == 0xffffff
+	}
+	if format <= 1 {
+		if cs.length, err = c.readUint(3); err != nil {
+			return nil, err
+		}
+		typ, err := c.readUint(1)
+		if err != nil {
+			return nil, err
+		}
+		cs.typ = uint8(typ)
+	}
+	if format == 0 {
+		var buf [4]byte
+		if _, err := io.ReadFull(c, buf[:]); err != nil {
+			return nil, err
+		}
+		// the message stream id is the only little endian field.
+		cs.streamID = binary.LittleEndian.Uint32(buf[:])
+	}
+	if cs.extended {
+		// type 3 chunks repeat the extended timestamp of the chunk stream.
+		if timestamp, err = c.readUint(4); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cs.buf) == 0 {
+		switch format {
+		case 0:
+			cs.timestamp, cs.delta = timestamp, 0
+		case 1, 2:
+			cs.delta = timestamp
+			cs.timestamp += timestamp
+		case 3:
+			cs.timestamp += cs.delta
+		}
+	}
+
+	n := cs.length - uint32(len(cs.buf))
+	if n > c.readChunkSize {
+		n = c.readChunkSize
+	}
+	start := len(cs.buf)
+	if cs.buf == nil {
+		cs.buf = make([]byte, 0, cs.length)
+	}
+	cs.buf = cs.buf[:start+int(n)]
+	if _, err := io.ReadFull(c, cs.buf[start:]); err != nil {
+		return nil, err
+	}
+	if uint32(len(cs.buf)) < cs.length {
+		return nil, nil
+	}
+	m := &message{typ: cs.typ, timestamp: cs.timestamp, streamID: cs.streamID, payload: cs.buf}
+	cs.buf = nil
+	return m, nil
+}
+
+// acknowledge sends an acknowledgement when the client's window is full, clients may stop sending
+// if they aren't acknowledged.
+func (c *conn) acknowledge() error {
+	if c.ackWindow == 0 || c.read-c.acked < c.ackWindow {
+		return nil
+	}
+	c.acked = c.read
+	return c.writeControl(msgAcknowledgement, c.read)
+}
+
+// writeMessage writes a message as chunks of the chunk stream.
+func (c *conn) writeMessage(csid uint32, m *message) error {
+	// every message starts with a full header, so the headers are small and don't depend on state.
+	header := make([]byte, 12)
+	header[0] = byte(csid)
+	putUint24(header[1:], m.timestamp)
+	putUint24(header[4:], uint32(len(m.payload)))
+	header[7] = m.typ
+	binary.LittleEndian.PutUint32(header[8:], m.streamID)
+
+	buf := header
+	for payload := m.payload; ; {
+		n := len(payload)
+		if n > int(c.writeChunkSize) {
+			n = int(c.writeChunkSize)
+		}
+		buf = append(buf, payload[:n]...)
+		payload = payload[n:]
+		if len(payload) == 0 {
+			break
+		}
+		buf = append(buf, 0xc0|byte(csid))
+	}
+	_, err := c.Write(buf)
+	return err
+}
+
+// writeControl writes a protocol control message with a single value.
+func (c *conn) writeControl(typ uint8, value uint32) error {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, value)
+	return c.writeMessage(csidControl, &message{typ: typ, payload: payload})
+}
+
+// writeCommand writes an AMF0 command on a message stream.
+func (c *conn) writeCommand(streamID uint32, values ...interface{}) error {
+	return c.writeMessage(csidCommand, &message{typ: msgCommandAMF0, streamID: streamID, payload: encodeAMF(values...)})
+}
+
+func putUint24(buf []byte, v uint32) {
+	buf[0], buf[1], buf[2] = byte(v>>16), byte(v>>8), byte(v)
+}
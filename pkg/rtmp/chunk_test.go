@@ -0,0 +1,200 @@
+package rtmp
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testConn reads from a buffer and records what's written.
+type testConn struct {
+	net.Conn
+	r io.Reader
+	w bytes.Buffer
+}
+
+func (c *testConn) Read(b []byte) (int, error)      { return c.r.Read(b) }
+func (c *testConn) Write(b []byte) (int, error)     { return c.w.Write(b) }
+func (c *testConn) SetReadDeadline(time.Time) error { return nil }
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// repeat returns n bytes with the value b.
+func repeat(b byte, n int) []byte {
+	return bytes.Repeat([]byte{b}, n)
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  []*message
+	}{
+		{
+			name: "type 0",
+			input: join(
+				[]byte{0x03, 0x00, 0x00, 0x64, 0x00, 0x00, 0x03, msgCommandAMF0, 0x01, 0x00, 0x00, 0x00}, []byte("abc"),
+			),
+			want: []*message{{typ: msgCommandAMF0, timestamp: 100, streamID: 1, payload: []byte("abc")}},
+		},
+		{
+			name: "compressed headers",
+			input: join(
+				// type 0 at 100.
+				[]byte{0x04, 0x00, 0x00, 0x64, 0x00, 0x00, 0x01, msgAudio, 0x01, 0x00, 0x00, 0x00}, []byte{0xa0},
+				// type 1 changes the length and type, 10 later.
+				[]byte{0x44, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x02, msgVideo}, []byte{0xb0, 0xb1},
+				// type 2 keeps the length and type, 5 later.
+				[]byte{0x84, 0x00, 0x00, 0x05}, []byte{0xc0, 0xc1},
+				// type 3 repeats the last delta.
+				[]byte{0xc4}, []byte{0xd0, 0xd1},
+			),
+			want: []*message{
+				{typ: msgAudio, timestamp: 100, streamID: 1, payload: []byte{0xa0}},
+				{typ: msgVideo, timestamp: 110, streamID: 1, payload: []byte{0xb0, 0xb1}},
+				{typ: msgVideo, timestamp: 115, streamID: 1, payload: []byte{0xc0, 0xc1}},
+				{typ: msgVideo, timestamp: 120, streamID: 1, payload: []byte{0xd0, 0xd1}},
+			},
+		},
+		{
+			name: "continuation",
+			input: join(
+				[]byte{0x06, 0x00, 0x00, 0x0a, 0x00, 0x00, 0xc8, msgVideo, 0x01, 0x00, 0x00, 0x00}, repeat(1, 128),
+				// the continuation doesn't advance the timestamp.
+				[]byte{0xc6}, repeat(2, 72),
+			),
+			want: []*message{{typ: msgVideo, timestamp: 10, streamID: 1, payload: join(repeat(1, 128), repeat(2, 72))}},
+		},
+		{
+			name: "interleaved",
+			input: join(
+				[]byte{0x06, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x82, msgVideo, 0x01, 0x00, 0x00, 0x00}, repeat(1, 128),
+				// a message of another chunk stream completes first.
+				[]byte{0x04, 0x00, 0x00, 0x0b, 0x00, 0x00, 0x01, msgAudio, 0x01, 0x00, 0x00, 0x00}, []byte{0xa0},
+				[]byte{0xc6}, repeat(2, 2),
+			),
+			want: []*message{
+				{typ: msgAudio, timestamp: 11, streamID: 1, payload: []byte{0xa0}},
+				{typ: msgVideo, timestamp: 10, streamID: 1, payload: join(repeat(1, 128), repeat(2, 2))},
+			},
+		},
+		{
+			name: "set chunk size",
+			input: join(
+				[]byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, msgSetChunkSize, 0x00, 0x00, 0x00, 0x00}, []byte{0x00, 0x00, 0x00, 0x04},
+				[]byte{0x06, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x06, msgVideo, 0x01, 0x00, 0x00, 0x00}, []byte{1, 2, 3, 4},
+				[]byte{0xc6}, []byte{5, 6},
+			),
+			want: []*message{{typ: msgVideo, timestamp: 10, streamID: 1, payload: []byte{1, 2, 3, 4, 5, 6}}},
+		},
+		{
+			name: "extended timestamp",
+			input: join(
+				[]byte{0x06, 0xff, 0xff, 0xff, 0x00, 0x00, 0x82, msgVideo, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00}, repeat(1, 128),
+				// continuations repeat the extended timestamp.
+				[]byte{0xc6, 0x01, 0x00, 0x00, 0x00}, repeat(2, 2),
+				// so do type 2 chunks with an extended delta.
+				[]byte{0x86, 0xff, 0xff, 0xff, 0x00, 0x00, 0x10, 0x00}, repeat(3, 128),
+				[]byte{0xc6, 0x00, 0x00, 0x10, 0x00}, repeat(4, 2),
+			),
+			want: []*message{
+				{typ: msgVideo, timestamp: 0x01000000, streamID: 1, payload: join(repeat(1, 128), repeat(2, 2))},
+				{typ: msgVideo, timestamp: 0x01001000, streamID: 1, payload: join(repeat(3, 128), repeat(4, 2))},
+			},
+		},
+		{
+			name: "long chunk stream ids",
+			input: join(
+				// one byte form, 64 + 0.
+				[]byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x01, msgAudio, 0x01, 0x00, 0x00, 0x00}, []byte{0xa0},
+				// two byte form, 64 + 1 + 1 * 256.
+				[]byte{0x01, 0x01, 0x01, 0x00, 0x00, 0x02, 0x00, 0x00, 0x01, msgAudio, 0x01, 0x00, 0x00, 0x00}, []byte{0xa1},
+				// type 3 chunks of both streams.
+				[]byte{0xc0, 0x00}, []byte{0xa2},
+				[]byte{0xc1, 0x01, 0x01}, []byte{0xa3},
+			),
+			want: []*message{
+				{typ: msgAudio, timestamp: 1, streamID: 1, payload: []byte{0xa0}},
+				{typ: msgAudio, timestamp: 2, streamID: 1, payload: []byte{0xa1}},
+				{typ: msgAudio, timestamp: 1, streamID: 1, payload: []byte{0xa2}},
+				{typ: msgAudio, timestamp: 2, streamID: 1, payload: []byte{0xa3}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newConn(&testConn{r: bytes.NewReader(tt.input)})
+			for i, want := range tt.want {
+				got, err := c.readMessage()
+				if err != nil {
+					t.Fatalf("message %d: %v", i, err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("message %d: got %+v, want %+v", i, got, want)
+				}
+			}
+			if m, err := c.readMessage(); err != io.EOF {
+				t.Errorf("expected the input to end, got %+v and %v", m, err)
+			}
+		})
+	}
+}
+
+func TestReadMessageInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "compressed header first", input: []byte{0x43, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x01, msgAudio, 0xa0}},
+		{name: "zero chunk size", input: []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, msgSetChunkSize, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{name: "huge chunk size", input: []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, msgSetChunkSize, 0x00, 0x00, 0x00, 0x00, 0x7f, 0xff, 0xff, 0xff}},
+		{name: "short set chunk size", input: []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, msgSetChunkSize, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04}},
+		{name: "truncated header", input: []byte{0x03, 0x00, 0x00, 0x64, 0x00}},
+		{name: "truncated payload", input: []byte{0x03, 0x00, 0x00, 0x64, 0x00, 0x00, 0x03, msgCommandAMF0, 0x01, 0x00, 0x00, 0x00, 'a'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newConn(&testConn{r: bytes.NewReader(tt.input)})
+			if m, err := c.readMessage(); err == nil || err == io.EOF {
+				t.Errorf("expected an error, got %+v and %v", m, err)
+			}
+		})
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunkSize uint32
+		m         *message
+	}{
+		{name: "single chunk", chunkSize: defaultChunkSize, m: &message{typ: msgCommandAMF0, timestamp: 100, streamID: 1, payload: []byte("abc")}},
+		{name: "chunked", chunkSize: 4, m: &message{typ: msgVideo, timestamp: 100, streamID: 1, payload: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &testConn{}
+			c := newConn(w)
+			c.writeChunkSize = tt.chunkSize
+			if err := c.writeMessage(csidCommand, tt.m); err != nil {
+				t.Fatal(err)
+			}
+
+			// the chunks are read back the way a client would.
+			r := newConn(&testConn{r: &w.w})
+			r.readChunkSize = tt.chunkSize
+			got, err := r.readMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.m) {
+				t.Errorf("got %+v, want %+v", got, tt.m)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+// Package rtmp implements the publishing side of an RTMP server, enough to receive streams from
+// encoders such as OBS and FFmpeg. Playback isn't supported.
+package rtmp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// TagType is the type of a tag, which is the FLV tag type of its data.
+type TagType uint8
+
+const (
+	TagAudio TagType = msgAudio
+	TagVideo TagType = msgVideo
+)
+
+// Tag is an audio or video message of a published stream. Its data is the body of an FLV tag, see
+// https://veovera.org/docs/legacy/video-file-format-v10-1-spec.pdf
+type Tag struct {
+	Type TagType
+	// Timestamp is the decoding time of the tag in milliseconds.
+	Timestamp uint32
+	Data      []byte
+}
+
+// Publisher is a client publishing a stream.
+type Publisher struct {
+	// App is the application the client connected to, the first element of the url path.
+	App string
+	// Key is the stream key the client publishes, any query parameters are removed.
+	Key string
+
+	c         *conn
+	streamID  uint32
+	started   bool
+	unpublish bool
+}
+
+// RemoteAddr returns the address of the client.
+func (p *Publisher) RemoteAddr() net.Addr {
+	return p.c.RemoteAddr()
+}
+
+// ReadTag reads the next audio or video tag of the stream, it returns io.EOF when the client stops
+// publishing. The first call accepts the stream.
+func (p *Publisher) ReadTag() (*Tag, error) {
+	if !p.started {
+		p.started = true
+		if err := p.status("status", "NetStream.Publish.Start", "Start publishing."); err != nil {
+			return nil, err
+		}
+	}
+	for !p.unpublish {
+		m, err := p.c.readMessage()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		switch m.typ {
+		case msgAudio, msgVideo:
+			if len(m.payload) == 0 {
+				continue
+			}
+			return &Tag{Type: TagType(m.typ), Timestamp: m.timestamp, Data: m.payload}, nil
+		case msgCommandAMF0, msgCommandAMF3:
+			name, _, _, err := readCommand(m)
+			if err != nil {
+				return nil, err
+			}
+			switch name {
+			case "FCUnpublish", "deleteStream", "closeStream":
+				p.unpublish = true
+			}
+		}
+	}
+	return nil, io.EOF
+}
+
+func (p *Publisher) status(level, code, description string) error {
+	return p.c.writeCommand(p.streamID, "onStatus", 0, nil, map[string]interface{}{
+		"level":       level,
+		"code":        code,
+		"description": description,
+	})
+}
+
+// Serve accepts connections on the listener and calls handler with every published stream in a new
+// goroutine, the connection is closed when the handler returns. The handler accepts the stream by
+// reading its first tag, if it returns an error before, the stream is rejected with it. Serve returns
+// when the listener fails, for example because it's closed.
+func Serve(lis net.Listener, handler func(*Publisher) error) error {
+	for {
+		c, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer c.Close()
+			if err := serveConn(newConn(c), handler); err != nil && !errors.Is(err, io.EOF) {
+				zap.L().Debug("rtmp connection failed", zap.Stringer("addr", c.RemoteAddr()), zap.Error(err))
+			}
+		}()
+	}
+}
+
+// readCommand splits a command message into its name, transaction id and arguments.
+func readCommand(m *message) (string, float64, []interface{}, error) {
+	payload := m.payload
+	if m.typ == msgCommandAMF3 && len(payload) > 0 {
+		// AMF3 commands are AMF0 values after a format byte.
+		payload = payload[1:]
+	}
+	values, err := decodeAMF(payload)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if len(values) < 2 {
+		return "", 0, nil, errors.New("invalid command")
+	}
+	name, ok := values[0].(string)
+	if !ok {
+		return "", 0, nil, errors.New("invalid command name")
+	}
+	transactionID, _ := values[1].(float64)
+	return name, transactionID, values[2:], nil
+}
+
+// serveConn negotiates the connection until the client publishes, then hands it to the handler.
+func serveConn(c *conn, handler func(*Publisher) error) error {
+	if err := c.handshake(); err != nil {
+		return err
+	}
+
+	var app string
+	for {
+		m, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		if m.typ != msgCommandAMF0 && m.typ != msgCommandAMF3 {
+			continue
+		}
+		name, transactionID, args, err := readCommand(m)
+		if err != nil {
+			return err
+		}
+		switch name {
+		case "connect":
+			if len(args) > 0 {
+				if properties, ok := args[0].(map[string]interface{}); ok {
+					app, _ = properties["app"].(string)
+				}
+			}
+			if err := c.writeControl(msgWindowAckSize, windowAckSize); err != nil {
+				return err
+			}
+			// the peer bandwidth has an extra limit type byte, 2 is dynamic.
+			if err := c.writeMessage(csidControl, &message{typ: msgSetPeerBandwidth, payload: []byte{
+				windowAckSize >> 24, windowAckSize >> 16 & 0xff, windowAckSize >> 8 & 0xff, windowAckSize & 0xff, 2,
+			}}); err != nil {
+				return err
+			}
+			if err := c.writeControl(msgSetChunkSize, 4096); err != nil {
+				return err
+			}
+			c.writeChunkSize = 4096
+			if err := c.writeCommand(0, "_result", transactionID, map[string]interface{}{
+				"fmsVer":       "FMS/3,0,1,123",
+				"capabilities": 31,
+			}, map[string]interface{}{
+				"level":          "status",
+				"code":           "NetConnection.Connect.Success",
+				"description":    "Connection succeeded.",
+				"objectEncoding": 0,
+			}); err != nil {
+				return err
+			}
+		case "createStream":
+			// a connection only publishes one stream, so its id is always 1.
+			if err := c.writeCommand(0, "_result", transactionID, nil, 1); err != nil {
+				return err
+			}
+		case "publish":
+			var key string
+			if len(args) > 1 {
+				key, _ = args[1].(string)
+			}
+			if i := strings.IndexByte(key, '?'); i >= 0 {
+				key = key[:i]
+			}
+			p := &Publisher{App: app, Key: key, c: c, streamID: m.streamID}
+			err := handler(p)
+			if !p.started {
+				if err == nil {
+					err = errors.New("rejected")
+				}
+				p.status("error", "NetStream.Publish.BadName", err.Error())
+			}
+			return err
+		case "play":
+			c.writeCommand(m.streamID, "onStatus", 0, nil, map[string]interface{}{
+				"level":       "error",
+				"code":        "NetStream.Play.Failed",
+				"description": "Playback is not supported.",
+			})
+			return fmt.Errorf("unsupported command %s", name)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package transcoder
+
+import (
+	"sync"
+
+	"github.com/muxable/transcoder/pkg/av"
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// defaultInitialBitrate is the bandwidth estimate used before any feedback is received if the request
+// doesn't specify a bitrate.
+const defaultInitialBitrate = 1000 * 1000
+
+// bitrateController adapts the bitrate of a transcoder to the bandwidth estimates of its subscribers.
+// The output is shared, so it's encoded for the subscriber with the least bandwidth.
+type bitrateController struct {
+	sync.Mutex
+
+	transcoder *av.Transcoder
+	estimates  []*bitrateEstimate
+}
+
+// bitrateEstimate holds the bandwidth estimates of a single subscriber. The subscriber may send REMB,
+// TWCC feedback or both, the lower of the two estimates is used.
+type bitrateEstimate struct {
+	controller *bitrateController
+	remb, twcc int64
+}
+
+// newBitrateController adapts the bitrate of a transcoder that hasn't started yet, it's encoded at the
+// initial estimate until feedback is received.
+func newBitrateController(transcoder *av.Transcoder, config av.EncoderConfiguration) *bitrateController {
+	transcoder.AdaptBitrate(initialBitrate(config))
+	return &bitrateController{transcoder: transcoder}
+}
+
+// initialBitrate is the bitrate an output is encoded at before any feedback is received.
+func initialBitrate(config av.EncoderConfiguration) int64 {
+	if config.Bitrate > 0 {
+		return config.Bitrate
+	}
+	return defaultInitialBitrate
+}
+
+// newEstimate adds a subscriber to the controller.
+func (c *bitrateController) newEstimate() *bitrateEstimate {
+	c.Lock()
+	defer c.Unlock()
+	e := &bitrateEstimate{controller: c}
+	c.estimates = append(c.estimates, e)
+	return e
+}
+
+// remove removes a subscriber from the controller.
+func (e *bitrateEstimate) remove() {
+	c := e.controller
+	c.Lock()
+	for i, x := range c.estimates {
+		if x == e {
+			c.estimates = append(c.estimates[:i], c.estimates[i+1:]...)
+			break
+		}
+	}
+	c.Unlock()
+	c.update()
+}
+
+// registerInterceptors configures a send side bandwidth estimator driven by TWCC feedback.
+func (e *bitrateEstimate) registerInterceptors(m *webrtc.MediaEngine, i *interceptor.Registry, config av.EncoderConfiguration) error {
+	opts := []gcc.Option{
+		gcc.SendSideBWEInitialBitrate(int(initialBitrate(config))),
+		// the transcoder paces its own output, so don't delay packets.
+		gcc.SendSideBWEPacer(gcc.NewNoOpPacer()),
+	}
+	if config.MaxBitrate > 0 {
+		opts = append(opts, gcc.SendSideBWEMaxBitrate(int(config.MaxBitrate)))
+	}
+	f, err := cc.NewInterceptor(func() (cc.BandwidthEstimator, error) {
+		return gcc.NewSendSideBWE(opts...)
+	})
+	if err != nil {
+		return err
+	}
+	f.OnNewPeerConnection(func(_ string, estimator cc.BandwidthEstimator) {
+		estimator.OnTargetBitrateChange(func(bitrate int) {
+			e.controller.Lock()
+			e.twcc = int64(bitrate)
+			e.controller.Unlock()
+			e.controller.update()
+		})
+	})
+	i.Add(f)
+	return webrtc.ConfigureTWCCHeaderExtensionSender(m, i)
+}
+
+// handleRTCP picks up REMB packets sent by the subscriber.
+func (e *bitrateEstimate) handleRTCP(pkts []rtcp.Packet) {
+	for _, pkt := range pkts {
+		if remb, ok := pkt.(*rtcp.ReceiverEstimatedMaximumBitrate); ok {
+			e.controller.Lock()
+			e.remb = int64(remb.Bitrate)
+			e.controller.Unlock()
+			e.controller.update()
+		}
+	}
+}
+
+func (c *bitrateController) update() {
+	c.Lock()
+	var bitrate int64
+	for _, e := range c.estimates {
+		estimate := e.remb
+		if estimate == 0 || (e.twcc > 0 && e.twcc < estimate) {
+			estimate = e.twcc
+		}
+		if estimate > 0 && (bitrate == 0 || estimate < bitrate) {
+			bitrate = estimate
+		}
+	}
+	c.Unlock()
+	if bitrate > 0 {
+		zap.L().Debug("updating bitrate", zap.Int64("bitrate", bitrate))
+		c.transcoder.SetBitrate(bitrate)
+	}
+}
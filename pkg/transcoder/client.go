@@ -7,6 +7,7 @@ import (
 	"github.com/muxable/signal/pkg/signal"
 	"github.com/muxable/transcoder/api"
 	"github.com/pion/interceptor"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
@@ -27,6 +28,24 @@ func NewClient(ctx context.Context, conn *grpc.ClientConn) (*Client, error) {
 type TranscodeOption func(*api.TranscodeRequest)
 
 func (c *Client) Transcode(tl *webrtc.TrackLocalStaticRTP, options ...TranscodeOption) (*webrtc.TrackRemote, error) {
+	trs, err := c.transcode(tl, 1, options...)
+	if err != nil {
+		return nil, err
+	}
+	return trs[0], nil
+}
+
+// TranscodeSimulcast transcodes a video track to several renditions, returning one track per layer in
+// the order the renditions arrive.
+func (c *Client) TranscodeSimulcast(tl *webrtc.TrackLocalStaticRTP, layers []*api.SimulcastLayer, options ...TranscodeOption) ([]*webrtc.TrackRemote, error) {
+	options = append(options, func(request *api.TranscodeRequest) {
+		request.Layers = layers
+	})
+	return c.transcode(tl, len(layers), options...)
+}
+
+// transcode publishes the track and subscribes to the transcoded output, waiting for n tracks.
+func (c *Client) transcode(tl *webrtc.TrackLocalStaticRTP, n int, options ...TranscodeOption) ([]*webrtc.TrackRemote, error) {
 	config := webrtc.Configuration{
 		ICEServers: []webrtc.ICEServer{
 			{URLs: []string{"stun:stun.l.google.com:19302"}},
@@ -106,7 +125,24 @@ func (c *Client) Transcode(tl *webrtc.TrackLocalStaticRTP, options ...TranscodeO
 		}
 	}()
 
-	recv, err := webrtc.NewPeerConnection(config)
+	rm := &webrtc.MediaEngine{}
+	if err := rm.RegisterDefaultCodecs(); err != nil {
+		return nil, err
+	}
+
+	// required to receive simulcast.
+	for _, uri := range []string{sdp.SDESMidURI, sdp.SDESRTPStreamIDURI} {
+		if err := rm.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: uri}, webrtc.RTPCodecTypeVideo); err != nil {
+			return nil, err
+		}
+	}
+
+	ri := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(rm, ri); err != nil {
+		return nil, err
+	}
+
+	recv, err := webrtc.NewAPI(webrtc.WithMediaEngine(rm), webrtc.WithInterceptorRegistry(ri)).NewPeerConnection(config)
 	if err != nil {
 		return nil, err
 	}
@@ -120,7 +156,7 @@ func (c *Client) Transcode(tl *webrtc.TrackLocalStaticRTP, options ...TranscodeO
 		return nil, err
 	}
 
-	promise := make(chan *webrtc.TrackRemote)
+	promise := make(chan *webrtc.TrackRemote, n)
 
 	recv.OnTrack(func(tr *webrtc.TrackRemote, r *webrtc.RTPReceiver) {
 		go func() {
@@ -182,7 +218,11 @@ func (c *Client) Transcode(tl *webrtc.TrackLocalStaticRTP, options ...TranscodeO
 		return nil, err
 	}
 
-	return <-promise, nil
+	trs := make([]*webrtc.TrackRemote, n)
+	for i := range trs {
+		trs[i] = <-promise
+	}
+	return trs, nil
 }
 
 func ToMimeType(mimeType string) TranscodeOption {
@@ -190,3 +230,53 @@ func ToMimeType(mimeType string) TranscodeOption {
 		request.MimeType = mimeType
 	}
 }
+
+// WithBitrate sets the target bitrate of the transcoded track in bits per second.
+func WithBitrate(bitrate uint32) TranscodeOption {
+	return func(request *api.TranscodeRequest) {
+		request.Bitrate = bitrate
+	}
+}
+
+// WithMaxBitrate caps the bitrate of the transcoded track in bits per second.
+func WithMaxBitrate(bitrate uint32) TranscodeOption {
+	return func(request *api.TranscodeRequest) {
+		request.MaxBitrate = bitrate
+	}
+}
+
+// WithResolution sets the output resolution of a transcoded video track.
+func WithResolution(width, height uint32) TranscodeOption {
+	return func(request *api.TranscodeRequest) {
+		request.Width = width
+		request.Height = height
+	}
+}
+
+// WithScaleMode sets how the input is fit to the output resolution when the aspect ratios differ.
+func WithScaleMode(mode api.ScaleMode) TranscodeOption {
+	return func(request *api.TranscodeRequest) {
+		request.ScaleMode = mode
+	}
+}
+
+// WithFramerate caps the frame rate of a transcoded video track.
+func WithFramerate(framerate float64) TranscodeOption {
+	return func(request *api.TranscodeRequest) {
+		request.Framerate = framerate
+	}
+}
+
+// WithKeyframeInterval sets the maximum number of frames between keyframes.
+func WithKeyframeInterval(frames uint32) TranscodeOption {
+	return func(request *api.TranscodeRequest) {
+		request.KeyframeInterval = frames
+	}
+}
+
+// WithProfile sets the codec profile, for example "baseline" or "high" for H.264.
+func WithProfile(profile string) TranscodeOption {
+	return func(request *api.TranscodeRequest) {
+		request.Profile = profile
+	}
+}
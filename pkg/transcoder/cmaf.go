@@ -0,0 +1,219 @@
+package transcoder
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/muxable/transcoder/pkg/av"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// cmafIdleTimeout is how long a packaged track is kept without requests before it's closed.
+const cmafIdleTimeout = 30 * time.Second
+
+// cmafOutputCodecs are the codecs tracks are packaged with, the ones every HLS and DASH player plays.
+var cmafOutputCodecs = map[webrtc.RTPCodecType]string{
+	webrtc.RTPCodecTypeVideo: webrtc.MimeTypeH264,
+	webrtc.RTPCodecTypeAudio: "audio/AAC",
+}
+
+// cmafSegment is a segment of a packaged track, made of one or more fragments.
+type cmafSegment struct {
+	sequence int
+	parts    []av.Fragment
+	// complete is set once the next segment has started or the track has ended.
+	complete bool
+}
+
+func (s *cmafSegment) duration() time.Duration {
+	var d time.Duration
+	for _, p := range s.parts {
+		d += p.Duration
+	}
+	return d
+}
+
+func (s *cmafSegment) data() []byte {
+	var b bytes.Buffer
+	for _, p := range s.parts {
+		b.Write(p.Data)
+	}
+	return b.Bytes()
+}
+
+// cmafTrack is a source packaged as fragmented mp4. It keeps a rolling window of segments for HTTP
+// clients and lives until the source ends or no client has requested it for cmafIdleTimeout.
+type cmafTrack struct {
+	source     *Source
+	transcoder *av.CMAFTranscoder
+	config     av.CMAFConfiguration
+	// window is the number of complete segments that are kept.
+	window int
+	// bitrate is the target bitrate of the encoder, it's advertised to players.
+	bitrate int64
+
+	mu sync.Mutex
+	// updated is closed and replaced whenever a fragment is added or the track ends.
+	updated  chan struct{}
+	init     []byte
+	segments []*cmafSegment
+	ended    bool
+	accessed time.Time
+}
+
+// newCMAFTrack packages the source from its shared decoder, the source's outputsMu must be held.
+func newCMAFTrack(source *Source, config av.CMAFConfiguration, window int, encoder av.EncoderConfiguration) (*cmafTrack, error) {
+	outCodec, err := lookupOutputCodec(cmafOutputCodecs[source.Track.Kind()])
+	if err != nil {
+		return nil, err
+	}
+	t := &cmafTrack{
+		source:     source,
+		transcoder: source.sharedDecoder().NewCMAFTranscoder(outCodec.RTPCodecCapability, encoder, config),
+		config:     config,
+		window:     window,
+		bitrate:    encoder.Bitrate,
+		updated:    make(chan struct{}),
+		accessed:   time.Now(),
+	}
+	t.transcoder.OnInit(t.addInit)
+	t.transcoder.OnFragment(t.addFragment)
+	return t, nil
+}
+
+// notify wakes up the requests waiting for the track to change, mu must be held.
+func (t *cmafTrack) notify() {
+	close(t.updated)
+	t.updated = make(chan struct{})
+}
+
+func (t *cmafTrack) addInit(b []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init = b
+	t.notify()
+}
+
+func (t *cmafTrack) addFragment(f av.Fragment) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := len(t.segments)
+	if n == 0 || f.SegmentStart {
+		sequence := 0
+		if n > 0 {
+			t.segments[n-1].complete = true
+			sequence = t.segments[n-1].sequence + 1
+		}
+		t.segments = append(t.segments, &cmafSegment{sequence: sequence})
+		// keep the window of complete segments and the one in progress.
+		if len(t.segments) > t.window+1 {
+			t.segments = t.segments[len(t.segments)-t.window-1:]
+		}
+	}
+	last := t.segments[len(t.segments)-1]
+	last.parts = append(last.parts, f)
+	t.notify()
+}
+
+// end completes the last segment and marks the track as ended.
+func (t *cmafTrack) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ended = true
+	if n := len(t.segments); n > 0 {
+		t.segments[n-1].complete = true
+	}
+	t.notify()
+}
+
+// run packages the source until it ends or the track is idle.
+func (t *cmafTrack) run() {
+	done := make(chan error, 1)
+	go func() { done <- t.transcoder.Run() }()
+
+	ticker := time.NewTicker(cmafIdleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				zap.L().Error("packaging failed", zap.Error(err))
+			}
+			t.source.removeCMAFTrack(t)
+			t.end()
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			idle := time.Since(t.accessed) > cmafIdleTimeout
+			t.mu.Unlock()
+			if idle {
+				// closing the transcoder ends its track.
+				if err := t.transcoder.Close(); err != nil {
+					zap.L().Error("failed to close transcoder", zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// wait locks the track once ready returns true, the track has ended or the context is done. It
+// returns false in the last case, with the track unlocked.
+func (t *cmafTrack) wait(ctx context.Context, ready func() bool) bool {
+	t.mu.Lock()
+	for {
+		t.accessed = time.Now()
+		if t.ended || ready() {
+			return true
+		}
+		updated := t.updated
+		t.mu.Unlock()
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return false
+		}
+		t.mu.Lock()
+	}
+}
+
+// segment returns the segment with the given sequence number, mu must be held.
+func (t *cmafTrack) segment(sequence int) *cmafSegment {
+	for _, s := range t.segments {
+		if s.sequence == sequence {
+			return s
+		}
+	}
+	return nil
+}
+
+// cmafTrack returns the packaged track of the source, creating it if no client has requested it yet.
+func (s *Source) cmafTrack(config av.CMAFConfiguration, window int, encoder av.EncoderConfiguration) (*cmafTrack, error) {
+	s.outputsMu.Lock()
+	defer s.outputsMu.Unlock()
+	if s.cmaf != nil {
+		return s.cmaf, nil
+	}
+	t, err := newCMAFTrack(s, config, window, encoder)
+	if err != nil {
+		return nil, err
+	}
+	s.cmaf = t
+	go t.run()
+	return t, nil
+}
+
+// removeCMAFTrack forgets a packaged track that has ended so the next request starts a new one.
+func (s *Source) removeCMAFTrack(t *cmafTrack) {
+	s.outputsMu.Lock()
+	defer s.outputsMu.Unlock()
+	if s.cmaf == t {
+		s.cmaf = nil
+	}
+	if err := t.transcoder.Close(); err != nil {
+		zap.L().Error("failed to close transcoder", zap.Error(err))
+	}
+	s.releaseDecoder()
+}
@@ -0,0 +1,412 @@
+package transcoder
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muxable/transcoder/pkg/av"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// DASHConfiguration configures the DASH output of the server. Every published stream is transcoded to
+// H.264 or AAC and packaged into a directory while it's published, with a dynamic manifest that's
+// updated as segments are written. When the stream ends, the manifest is replaced by a static one that
+// lists every segment so the stream can be played back.
+type DASHConfiguration struct {
+	// Directory is where the streams are written, each to a subdirectory named after the stream.
+	Directory string
+	// SegmentDuration is the target duration of a segment, two seconds by default.
+	SegmentDuration time.Duration
+	// Window is the number of segments in the dynamic manifest, six by default. Older segments are kept
+	// on disk, and their timing in memory, for the static manifest that's written when the stream ends.
+	// Disk and memory use grow for as long as a stream is published, nothing is deleted.
+	Window int
+	// Video has the encoder parameters of each rendition of a video track, a single 2 Mbps rendition by
+	// default. Audio tracks have a single rendition.
+	Video []av.EncoderConfiguration
+	Audio av.EncoderConfiguration
+}
+
+// WithDASH packages the published streams as DASH and serves them from the server's Handler.
+func WithDASH(config DASHConfiguration) ServerOption {
+	if config.SegmentDuration <= 0 {
+		config.SegmentDuration = 2 * time.Second
+	}
+	if config.Window <= 0 {
+		config.Window = 6
+	}
+	if len(config.Video) == 0 {
+		config.Video = []av.EncoderConfiguration{{Bitrate: 2_000_000}}
+	}
+	if config.Audio.Bitrate <= 0 {
+		config.Audio.Bitrate = 128_000
+	}
+	return func(s *TranscoderServer) {
+		s.dash = &config
+		s.dashStreams = make(map[string]*dashStream)
+	}
+}
+
+// safeName maps an id to a file name that can't escape its directory. Bytes other than letters, digits,
+// - and . are escaped as _ and their hex value, so different ids never share a name.
+func safeName(id string) string {
+	if id == "" {
+		return "_"
+	}
+	dots := strings.Trim(id, ".") == ""
+	var b strings.Builder
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '.' && !dots {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+	return b.String()
+}
+
+// dashStream is a stream being packaged as DASH.
+type dashStream struct {
+	config *DASHConfiguration
+	dir    string
+	// start is the wall clock time of the start of the timeline, every track is placed relative to it.
+	start time.Time
+
+	mu   sync.Mutex
+	sets []*dashAdaptationSet
+	// writeMu serializes the manifest writes, which share a temporary file.
+	writeMu sync.Mutex
+	// running is the number of tracks that haven't ended, it's guarded by the server's mu.
+	running int
+}
+
+// dashAdaptationSet is a track of a dashStream, with a representation per rendition.
+type dashAdaptationSet struct {
+	kind            webrtc.RTPCodecType
+	representations []*dashRepresentation
+}
+
+type dashRepresentation struct {
+	id      string
+	dir     string
+	bitrate int64
+	codecs  string
+	// segments are numbered from one, every segment of the stream is kept for the static manifest.
+	segments []av.Fragment
+	started  bool
+}
+
+// packageDASH adds a source to the DASH stream of its stream id, starting the stream if it's the first
+// track.
+func (s *TranscoderServer) packageDASH(source *Source) {
+	id := source.Track.StreamID()
+
+	s.mu.Lock()
+	stream, ok := s.dashStreams[id]
+	if !ok {
+		stream = &dashStream{
+			config: s.dash,
+			dir:    filepath.Join(s.dash.Directory, safeName(id)),
+			start:  time.Now(),
+		}
+		s.dashStreams[id] = stream
+	}
+	stream.running++
+	s.mu.Unlock()
+
+	go func() {
+		if err := stream.runTrack(source); err != nil {
+			zap.L().Error("dash packaging failed", zap.String("stream", id), zap.Error(err))
+		}
+
+		s.mu.Lock()
+		stream.running--
+		done := stream.running == 0
+		if done {
+			delete(s.dashStreams, id)
+		}
+		s.mu.Unlock()
+
+		if done {
+			if err := stream.writeManifest(true); err != nil {
+				zap.L().Error("failed to write dash manifest", zap.String("stream", id), zap.Error(err))
+			}
+		}
+	}()
+}
+
+// runTrack packages each rendition of a track until the track ends.
+func (d *dashStream) runTrack(source *Source) error {
+	outCodec, err := lookupOutputCodec(cmafOutputCodecs[source.Track.Kind()])
+	if err != nil {
+		return err
+	}
+	configs := []av.EncoderConfiguration{d.config.Audio}
+	if source.Track.Kind() == webrtc.RTPCodecTypeVideo {
+		configs = d.config.Video
+	}
+
+	set := &dashAdaptationSet{kind: source.Track.Kind()}
+	d.mu.Lock()
+	// a track id may be published again before its old track ends, each track needs its own directory.
+	name := safeName(source.Track.ID())
+	for d.hasTrackDir(name) {
+		name += "_"
+	}
+	for i, config := range configs {
+		set.representations = append(set.representations, &dashRepresentation{
+			id:      fmt.Sprintf("%s-%d", name, i),
+			dir:     fmt.Sprintf("%s/%d", name, i),
+			bitrate: config.Bitrate,
+		})
+	}
+	d.sets = append(d.sets, set)
+	d.mu.Unlock()
+
+	for _, r := range set.representations {
+		if err := os.MkdirAll(filepath.Join(d.dir, r.dir), 0755); err != nil {
+			return err
+		}
+	}
+
+	// the renditions share the source's decoder and are placed on the stream's timeline.
+	source.outputsMu.Lock()
+	decoder := source.sharedDecoder()
+	source.outputsMu.Unlock()
+	cmaf := av.CMAFConfiguration{
+		SegmentDuration: d.config.SegmentDuration,
+		Offset:          time.Since(d.start),
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(configs))
+	for i, config := range configs {
+		tc := decoder.NewCMAFTranscoder(outCodec.RTPCodecCapability, config, cmaf)
+		r := set.representations[i]
+		tc.OnInit(func(b []byte) {
+			if err := ioutil.WriteFile(filepath.Join(d.dir, r.dir, "init.mp4"), b, 0644); err != nil {
+				zap.L().Error("failed to write dash init segment", zap.Error(err))
+				return
+			}
+			d.mu.Lock()
+			r.codecs = tc.Codecs()
+			r.started = true
+			d.mu.Unlock()
+		})
+		tc.OnFragment(func(f av.Fragment) {
+			d.mu.Lock()
+			number := len(r.segments) + 1
+			d.mu.Unlock()
+			name := filepath.Join(d.dir, r.dir, fmt.Sprintf("%d.m4s", number))
+			if err := ioutil.WriteFile(name, f.Data, 0644); err != nil {
+				zap.L().Error("failed to write dash segment", zap.Error(err))
+				return
+			}
+			// the data is on disk, only the timing is needed for the manifest.
+			f.Data = nil
+			d.mu.Lock()
+			r.segments = append(r.segments, f)
+			d.mu.Unlock()
+			if err := d.writeManifest(false); err != nil {
+				zap.L().Error("failed to write dash manifest", zap.Error(err))
+			}
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tc.Run(); err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	// the decoder ends when the track ends, which ends every rendition.
+	wg.Wait()
+	source.outputsMu.Lock()
+	source.releaseDecoder()
+	source.outputsMu.Unlock()
+
+	close(errs)
+	return <-errs
+}
+
+// hasTrackDir returns true if a track already uses the directory name, mu must be held.
+func (d *dashStream) hasTrackDir(name string) bool {
+	for _, set := range d.sets {
+		for _, r := range set.representations {
+			if strings.HasPrefix(r.dir, name+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// the manifest schema, only the parts that are used.
+type mpd struct {
+	XMLName                    xml.Name  `xml:"urn:mpeg:dash:schema:mpd:2011 MPD"`
+	Profiles                   string    `xml:"profiles,attr"`
+	Type                       string    `xml:"type,attr"`
+	AvailabilityStartTime      string    `xml:"availabilityStartTime,attr,omitempty"`
+	PublishTime                string    `xml:"publishTime,attr,omitempty"`
+	MinimumUpdatePeriod        string    `xml:"minimumUpdatePeriod,attr,omitempty"`
+	TimeShiftBufferDepth       string    `xml:"timeShiftBufferDepth,attr,omitempty"`
+	SuggestedPresentationDelay string    `xml:"suggestedPresentationDelay,attr,omitempty"`
+	MediaPresentationDuration  string    `xml:"mediaPresentationDuration,attr,omitempty"`
+	MinBufferTime              string    `xml:"minBufferTime,attr"`
+	Period                     mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	ID             string             `xml:"id,attr"`
+	Start          string             `xml:"start,attr"`
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	ID               int                 `xml:"id,attr"`
+	ContentType      string              `xml:"contentType,attr"`
+	MimeType         string              `xml:"mimeType,attr"`
+	SegmentAlignment bool                `xml:"segmentAlignment,attr"`
+	StartWithSAP     int                 `xml:"startWithSAP,attr"`
+	Representations  []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdRepresentation struct {
+	ID              string             `xml:"id,attr"`
+	Bandwidth       int64              `xml:"bandwidth,attr"`
+	Codecs          string             `xml:"codecs,attr,omitempty"`
+	SegmentTemplate mpdSegmentTemplate `xml:"SegmentTemplate"`
+}
+
+type mpdSegmentTemplate struct {
+	Timescale      int                  `xml:"timescale,attr"`
+	Initialization string               `xml:"initialization,attr"`
+	Media          string               `xml:"media,attr"`
+	StartNumber    int                  `xml:"startNumber,attr"`
+	Timeline       []mpdTimelineSegment `xml:"SegmentTimeline>S"`
+}
+
+type mpdTimelineSegment struct {
+	T int64 `xml:"t,attr"`
+	D int64 `xml:"d,attr"`
+}
+
+// isoDuration formats a duration as an ISO 8601 duration.
+func isoDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%.3fS", d.Seconds())
+}
+
+// manifest renders the manifest of the stream, mu must be held. The dynamic manifest lists the last
+// segments of the window, the static one lists every segment.
+func (d *dashStream) manifest(static bool) mpd {
+	m := mpd{
+		Profiles:      "urn:mpeg:dash:profile:isoff-live:2011",
+		MinBufferTime: isoDuration(d.config.SegmentDuration),
+		Period:        mpdPeriod{ID: "0", Start: isoDuration(0)},
+	}
+	var end time.Duration
+	for i, set := range d.sets {
+		as := mpdAdaptationSet{
+			ID:               i,
+			ContentType:      set.kind.String(),
+			MimeType:         set.kind.String() + "/mp4",
+			SegmentAlignment: true,
+			StartWithSAP:     1,
+		}
+		for _, r := range set.representations {
+			if !r.started || len(r.segments) == 0 {
+				continue
+			}
+			first := 0
+			if !static && len(r.segments) > d.config.Window {
+				first = len(r.segments) - d.config.Window
+			}
+			// the timeline is in milliseconds from the start of the stream.
+			template := mpdSegmentTemplate{
+				Timescale:      1000,
+				Initialization: r.dir + "/init.mp4",
+				Media:          r.dir + "/$Number$.m4s",
+				StartNumber:    first + 1,
+			}
+			for _, f := range r.segments[first:] {
+				template.Timeline = append(template.Timeline, mpdTimelineSegment{
+					T: f.Start.Milliseconds(),
+					D: f.Duration.Milliseconds(),
+				})
+			}
+			last := r.segments[len(r.segments)-1]
+			if e := last.Start + last.Duration; e > end {
+				end = e
+			}
+			as.Representations = append(as.Representations, mpdRepresentation{
+				ID:              r.id,
+				Bandwidth:       r.bitrate,
+				Codecs:          r.codecs,
+				SegmentTemplate: template,
+			})
+		}
+		if len(as.Representations) > 0 {
+			m.Period.AdaptationSets = append(m.Period.AdaptationSets, as)
+		}
+	}
+
+	if static {
+		m.Type = "static"
+		m.MediaPresentationDuration = isoDuration(end)
+	} else {
+		m.Type = "dynamic"
+		m.AvailabilityStartTime = d.start.UTC().Format(time.RFC3339Nano)
+		m.PublishTime = time.Now().UTC().Format(time.RFC3339Nano)
+		m.MinimumUpdatePeriod = isoDuration(d.config.SegmentDuration)
+		m.TimeShiftBufferDepth = isoDuration(time.Duration(d.config.Window) * d.config.SegmentDuration)
+		m.SuggestedPresentationDelay = isoDuration(3 * d.config.SegmentDuration)
+	}
+	return m
+}
+
+// writeManifest replaces the manifest of the stream. It's written to a temporary file first so players
+// never read a partial manifest.
+func (d *dashStream) writeManifest(static bool) error {
+	// the manifest is rendered while holding writeMu too, so an older manifest never replaces a newer one.
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+
+	d.mu.Lock()
+	buf, err := xml.MarshalIndent(d.manifest(static), "", "  ")
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	buf = append([]byte(xml.Header), buf...)
+
+	path := filepath.Join(d.dir, "manifest.mpd")
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// serveDASH serves the files of the packaged streams, the manifest of a stream is
+// /dash/{stream}/manifest.mpd with the stream id mapped to a file name by safeName.
+func (s *TranscoderServer) serveDASH() http.Handler {
+	files := http.StripPrefix("/dash/", http.FileServer(http.Dir(s.dash.Directory)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if strings.HasSuffix(r.URL.Path, ".mpd") {
+			w.Header().Set("Content-Type", "application/dash+xml")
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,141 @@
+package transcoder
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/muxable/transcoder/pkg/av"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestDASHManifest(t *testing.T) {
+	start := time.Date(2022, 2, 22, 12, 0, 0, 0, time.UTC)
+	var segments []av.Fragment
+	for i := 0; i < 4; i++ {
+		segments = append(segments, av.Fragment{Start: time.Duration(i) * 2 * time.Second, Duration: 2 * time.Second})
+	}
+	stream := &dashStream{
+		config: &DASHConfiguration{SegmentDuration: 2 * time.Second, Window: 2},
+		start:  start,
+		sets: []*dashAdaptationSet{
+			{
+				kind: webrtc.RTPCodecTypeVideo,
+				representations: []*dashRepresentation{
+					{id: "video-0", dir: "video/0", bitrate: 2_000_000, codecs: "avc1.42c01f", segments: segments, started: true},
+					// renditions without an init segment aren't listed yet.
+					{id: "video-1", dir: "video/1", bitrate: 500_000, segments: segments},
+				},
+			},
+			{
+				// tracks without segments are left out.
+				kind:            webrtc.RTPCodecTypeAudio,
+				representations: []*dashRepresentation{{id: "audio-0", dir: "audio/0", bitrate: 128_000, started: true}},
+			},
+		},
+	}
+
+	video := func(startNumber int, timeline ...mpdTimelineSegment) mpdPeriod {
+		return mpdPeriod{
+			ID:    "0",
+			Start: "PT0.000S",
+			AdaptationSets: []mpdAdaptationSet{{
+				ID:               0,
+				ContentType:      "video",
+				MimeType:         "video/mp4",
+				SegmentAlignment: true,
+				StartWithSAP:     1,
+				Representations: []mpdRepresentation{{
+					ID:        "video-0",
+					Bandwidth: 2_000_000,
+					Codecs:    "avc1.42c01f",
+					SegmentTemplate: mpdSegmentTemplate{
+						Timescale:      1000,
+						Initialization: "video/0/init.mp4",
+						Media:          "video/0/$Number$.m4s",
+						StartNumber:    startNumber,
+						Timeline:       timeline,
+					},
+				}},
+			}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		static bool
+		want   mpd
+	}{
+		{
+			name: "dynamic",
+			want: mpd{
+				Profiles:                   "urn:mpeg:dash:profile:isoff-live:2011",
+				Type:                       "dynamic",
+				AvailabilityStartTime:      "2022-02-22T12:00:00Z",
+				MinimumUpdatePeriod:        "PT2.000S",
+				TimeShiftBufferDepth:       "PT4.000S",
+				SuggestedPresentationDelay: "PT6.000S",
+				MinBufferTime:              "PT2.000S",
+				// only the window is listed.
+				Period: video(3, mpdTimelineSegment{T: 4000, D: 2000}, mpdTimelineSegment{T: 6000, D: 2000}),
+			},
+		},
+		{
+			name:   "static",
+			static: true,
+			want: mpd{
+				Profiles:                  "urn:mpeg:dash:profile:isoff-live:2011",
+				Type:                      "static",
+				MediaPresentationDuration: "PT8.000S",
+				MinBufferTime:             "PT2.000S",
+				Period: video(1,
+					mpdTimelineSegment{T: 0, D: 2000},
+					mpdTimelineSegment{T: 2000, D: 2000},
+					mpdTimelineSegment{T: 4000, D: 2000},
+					mpdTimelineSegment{T: 6000, D: 2000}),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stream.manifest(tt.static)
+			// the publish time is when the manifest is rendered.
+			if !tt.static && got.PublishTime == "" {
+				t.Error("expected a publish time")
+			}
+			got.PublishTime = ""
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got manifest %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSafeName(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{id: "stream-1.v2", want: "stream-1.v2"},
+		{id: "a/b", want: "a_2fb"},
+		{id: "a b", want: "a_20b"},
+		{id: "a_b", want: "a_5fb"},
+		{id: "a_2fb", want: "a_5f2fb"},
+		{id: "../a", want: ".._2fa"},
+		{id: "..", want: "_2e_2e"},
+		{id: ".", want: "_2e"},
+		{id: "", want: "_"},
+	}
+	names := make(map[string]string)
+	for _, tt := range tests {
+		got := safeName(tt.id)
+		if got != tt.want {
+			t.Errorf("safeName(%q): got %q, want %q", tt.id, got, tt.want)
+		}
+		// different ids must not share a directory.
+		if id, ok := names[got]; ok {
+			t.Errorf("safeName(%q) and safeName(%q) are both %q", id, tt.id, got)
+		}
+		names[got] = tt.id
+	}
+}
@@ -0,0 +1,376 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/muxable/transcoder/pkg/av"
+	"github.com/pion/webrtc/v3"
+)
+
+// HLSConfiguration configures the HLS output of the server. Tracks are transcoded to H.264 or AAC and
+// packaged as fragmented mp4 when a player first requests them.
+type HLSConfiguration struct {
+	// SegmentDuration is the target duration of a segment, two seconds by default.
+	SegmentDuration time.Duration
+	// PartDuration enables low latency HLS with partial segments of this duration if it's set.
+	PartDuration time.Duration
+	// Window is the number of segments in a playlist, six by default.
+	Window int
+	// Video and Audio are the encoder parameters, the bitrates are advertised in the playlists.
+	Video, Audio av.EncoderConfiguration
+}
+
+// WithHLS serves the published tracks over HLS from the server's Handler.
+func WithHLS(config HLSConfiguration) ServerOption {
+	if config.SegmentDuration <= 0 {
+		config.SegmentDuration = 2 * time.Second
+	}
+	if config.Window <= 0 {
+		config.Window = 6
+	}
+	if config.Video.Bitrate <= 0 {
+		config.Video.Bitrate = 2_000_000
+	}
+	if config.Audio.Bitrate <= 0 {
+		config.Audio.Bitrate = 128_000
+	}
+	return func(s *TranscoderServer) {
+		s.hls = &config
+	}
+}
+
+// lookupSource returns the published source with the given ids, or nil if there's none.
+func (s *TranscoderServer) lookupSource(streamID, trackID string) *Source {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, source := range s.sources {
+		tr := source.Track
+		if tr.StreamID() == streamID && tr.ID() == trackID && tr.RID() == "" {
+			return source
+		}
+	}
+	return nil
+}
+
+// streamSources returns the published sources of a stream, simulcast layers are skipped.
+func (s *TranscoderServer) streamSources(streamID string) []*Source {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sources []*Source
+	for _, source := range s.sources {
+		if source.Track.StreamID() == streamID && source.Track.RID() == "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// hlsTrack returns the packaged track of a source for HLS.
+func (s *TranscoderServer) hlsTrack(source *Source) (*cmafTrack, error) {
+	encoder := s.hls.Audio
+	if source.Track.Kind() == webrtc.RTPCodecTypeVideo {
+		encoder = s.hls.Video
+	}
+	// tracks are packaged when they're first requested, the offset places them on the stream's timeline
+	// so the renditions stay in sync.
+	return source.cmafTrack(av.CMAFConfiguration{
+		SegmentDuration:  s.hls.SegmentDuration,
+		FragmentDuration: s.hls.PartDuration,
+		Offset:           time.Since(s.hlsStart(source.Track.StreamID())),
+	}, s.hls.Window, encoder)
+}
+
+// hlsStart returns the origin of a stream's timeline, the time its first track was packaged.
+func (s *TranscoderServer) hlsStart(streamID string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start, ok := s.hlsStarts[streamID]
+	if !ok {
+		start = time.Now()
+		if s.hlsStarts == nil {
+			s.hlsStarts = make(map[string]time.Time)
+		}
+		s.hlsStarts[streamID] = start
+	}
+	return start
+}
+
+// serveHLS serves the playlists and segments of the published streams:
+//
+//	/hls/{stream}/index.m3u8                  the multivariant playlist of a stream
+//	/hls/{stream}/{track}/index.m3u8          the media playlist of a track
+//	/hls/{stream}/{track}/init.mp4            the init segment
+//	/hls/{stream}/{track}/{segment}.m4s       a segment
+//	/hls/{stream}/{track}/{segment}.{part}.m4s a partial segment, for low latency HLS
+func (s *TranscoderServer) serveHLS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	elems, err := pathElems(r, "/hls/")
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case len(elems) == 2 && elems[1] == "index.m3u8":
+		s.serveHLSMultivariantPlaylist(w, elems[0])
+	case len(elems) == 3:
+		source := s.lookupSource(elems[0], elems[1])
+		if source == nil {
+			http.NotFound(w, r)
+			return
+		}
+		t, err := s.hlsTrack(source)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// requests for the live edge are held until it's available.
+		ctx, cancel := context.WithTimeout(r.Context(), 3*s.hls.SegmentDuration)
+		defer cancel()
+		if elems[2] == "index.m3u8" {
+			s.serveHLSMediaPlaylist(ctx, w, r, t)
+		} else {
+			s.serveHLSSegment(ctx, w, r, t, elems[2])
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *TranscoderServer) serveHLSMultivariantPlaylist(w http.ResponseWriter, streamID string) {
+	var video, audio []*Source
+	for _, source := range s.streamSources(streamID) {
+		if source.Track.Kind() == webrtc.RTPCodecTypeVideo {
+			video = append(video, source)
+		} else {
+			audio = append(audio, source)
+		}
+	}
+	if len(video) == 0 && len(audio) == 0 {
+		http.Error(w, "stream not found", http.StatusNotFound)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	if len(video) == 0 {
+		// an audio only stream has a variant per track.
+		for _, source := range audio {
+			fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d\n%s/index.m3u8\n", s.hls.Audio.Bitrate, url.PathEscape(source.Track.ID()))
+		}
+	} else {
+		for i, source := range audio {
+			fmt.Fprintf(&b, "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",NAME=%q,DEFAULT=%s,AUTOSELECT=YES,URI=\"%s/index.m3u8\"\n",
+				source.Track.ID(), yesNo(i == 0), url.PathEscape(source.Track.ID()))
+		}
+		for _, source := range video {
+			if len(audio) > 0 {
+				fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,AUDIO=\"audio\"\n", s.hls.Video.Bitrate+s.hls.Audio.Bitrate)
+			} else {
+				fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d\n", s.hls.Video.Bitrate)
+			}
+			fmt.Fprintf(&b, "%s/index.m3u8\n", url.PathEscape(source.Track.ID()))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(b.String()))
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
+
+// queryInt parses an optional integer query parameter, it returns -1 if the parameter is missing.
+func queryInt(r *http.Request, key string) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s", key)
+	}
+	return n, nil
+}
+
+// available returns true if a segment, or a part of it if part isn't -1, has been written. mu must be
+// held.
+func (t *cmafTrack) available(sequence, part int) bool {
+	n := len(t.segments)
+	if n == 0 {
+		return false
+	}
+	last := t.segments[n-1]
+	if last.sequence != sequence {
+		return last.sequence > sequence
+	}
+	return last.complete || (part >= 0 && len(last.parts) > part)
+}
+
+func (s *TranscoderServer) serveHLSMediaPlaylist(ctx context.Context, w http.ResponseWriter, r *http.Request, t *cmafTrack) {
+	// blocking playlist reloads, the player asks for the playlist once it has a segment or part.
+	msn, err := queryInt(r, "_HLS_msn")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	part, err := queryInt(r, "_HLS_part")
+	if err != nil || (part >= 0 && msn < 0) {
+		http.Error(w, "invalid _HLS_part", http.StatusBadRequest)
+		return
+	}
+	lowLatency := s.hls.PartDuration > 0
+
+	ok := t.wait(ctx, func() bool {
+		if t.init == nil || len(t.segments) == 0 {
+			return false
+		}
+		if msn >= 0 {
+			return t.available(msn, part)
+		}
+		// a playlist needs a complete segment unless it can list parts.
+		return lowLatency || t.segments[0].complete
+	})
+	if !ok {
+		http.Error(w, "track isn't ready", http.StatusServiceUnavailable)
+		return
+	}
+	playlist := t.hlsPlaylist(s.hls)
+	t.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(playlist))
+}
+
+// hlsPlaylist renders the media playlist of the track, mu must be held.
+func (t *cmafTrack) hlsPlaylist(config *HLSConfiguration) string {
+	lowLatency := config.PartDuration > 0
+
+	// the target duration must be at least the duration of every segment, rounded.
+	target := int(math.Ceil(config.SegmentDuration.Seconds()))
+	for _, s := range t.segments {
+		if d := int(math.Round(s.duration().Seconds())); d > target {
+			target = d
+		}
+	}
+
+	var b strings.Builder
+	version := 7
+	if lowLatency {
+		version = 9
+	}
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:%d\n#EXT-X-TARGETDURATION:%d\n", version, target)
+	if len(t.segments) > 0 {
+		fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", t.segments[0].sequence)
+	}
+	b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	if lowLatency {
+		partTarget := config.PartDuration.Seconds()
+		fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", 3*partTarget)
+		fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", partTarget)
+	}
+	b.WriteString("#EXT-X-MAP:URI=\"init.mp4\"\n")
+
+	for i, s := range t.segments {
+		// parts are only listed close to the live edge.
+		if lowLatency && i >= len(t.segments)-3 {
+			for j, p := range s.parts {
+				fmt.Fprintf(&b, "#EXT-X-PART:DURATION=%.3f,URI=\"%d.%d.m4s\"", p.Duration.Seconds(), s.sequence, j)
+				if p.Independent {
+					b.WriteString(",INDEPENDENT=YES")
+				}
+				b.WriteString("\n")
+			}
+		}
+		if s.complete {
+			fmt.Fprintf(&b, "#EXTINF:%.3f,\n%d.m4s\n", s.duration().Seconds(), s.sequence)
+		} else if lowLatency {
+			fmt.Fprintf(&b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"%d.%d.m4s\"\n", s.sequence, len(s.parts))
+		}
+	}
+	if t.ended {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	return b.String()
+}
+
+func (s *TranscoderServer) serveHLSSegment(ctx context.Context, w http.ResponseWriter, r *http.Request, t *cmafTrack, name string) {
+	contentType := "audio/mp4"
+	if t.source.Track.Kind() == webrtc.RTPCodecTypeVideo {
+		contentType = "video/mp4"
+	}
+
+	if name == "init.mp4" {
+		if !t.wait(ctx, func() bool { return t.init != nil }) {
+			http.Error(w, "track isn't ready", http.StatusServiceUnavailable)
+			return
+		}
+		init := t.init
+		t.mu.Unlock()
+		if init == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(init)
+		return
+	}
+
+	// segments are named {segment}.m4s and parts {segment}.{part}.m4s.
+	if !strings.HasSuffix(name, ".m4s") {
+		http.NotFound(w, r)
+		return
+	}
+	elems := strings.Split(strings.TrimSuffix(name, ".m4s"), ".")
+	if len(elems) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+	sequence, err := strconv.Atoi(elems[0])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	part := -1
+	if len(elems) == 2 {
+		if part, err = strconv.Atoi(elems[1]); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	// players request the hinted part before it's written.
+	if !t.wait(ctx, func() bool { return t.available(sequence, part) }) {
+		http.Error(w, "segment isn't ready", http.StatusServiceUnavailable)
+		return
+	}
+	var data []byte
+	if segment := t.segment(sequence); segment != nil {
+		if part < 0 && segment.complete {
+			data = segment.data()
+		} else if part >= 0 && part < len(segment.parts) {
+			data = segment.parts[part].Data
+		}
+	}
+	t.mu.Unlock()
+	if data == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(data)
+}
@@ -0,0 +1,117 @@
+package transcoder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/muxable/transcoder/pkg/av"
+)
+
+// testSegment returns the fragments of a segment with parts of the given durations, the first starts
+// with a keyframe.
+func testSegment(parts ...time.Duration) []av.Fragment {
+	fragments := make([]av.Fragment, len(parts))
+	for i, d := range parts {
+		fragments[i] = av.Fragment{Duration: d, Independent: i == 0, SegmentStart: i == 0}
+	}
+	return fragments
+}
+
+func TestHLSPlaylist(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   HLSConfiguration
+		window   int
+		segments [][]av.Fragment
+		ended    bool
+		want     string
+	}{
+		{
+			name:   "window",
+			config: HLSConfiguration{SegmentDuration: 2 * time.Second},
+			window: 2,
+			segments: [][]av.Fragment{
+				testSegment(2 * time.Second),
+				testSegment(2 * time.Second),
+				testSegment(2600 * time.Millisecond),
+				testSegment(2 * time.Second),
+			},
+			want: "#EXTM3U\n" +
+				"#EXT-X-VERSION:7\n" +
+				"#EXT-X-TARGETDURATION:3\n" +
+				"#EXT-X-MEDIA-SEQUENCE:1\n" +
+				"#EXT-X-INDEPENDENT-SEGMENTS\n" +
+				"#EXT-X-MAP:URI=\"init.mp4\"\n" +
+				"#EXTINF:2.000,\n1.m4s\n" +
+				"#EXTINF:2.600,\n2.m4s\n",
+		},
+		{
+			name:   "ended",
+			config: HLSConfiguration{SegmentDuration: 2 * time.Second},
+			window: 2,
+			segments: [][]av.Fragment{
+				testSegment(2 * time.Second),
+				testSegment(2 * time.Second),
+				testSegment(2600 * time.Millisecond),
+				testSegment(time.Second),
+			},
+			ended: true,
+			want: "#EXTM3U\n" +
+				"#EXT-X-VERSION:7\n" +
+				"#EXT-X-TARGETDURATION:3\n" +
+				"#EXT-X-MEDIA-SEQUENCE:1\n" +
+				"#EXT-X-INDEPENDENT-SEGMENTS\n" +
+				"#EXT-X-MAP:URI=\"init.mp4\"\n" +
+				"#EXTINF:2.000,\n1.m4s\n" +
+				"#EXTINF:2.600,\n2.m4s\n" +
+				"#EXTINF:1.000,\n3.m4s\n" +
+				"#EXT-X-ENDLIST\n",
+		},
+		{
+			name:   "low latency",
+			config: HLSConfiguration{SegmentDuration: 2 * time.Second, PartDuration: time.Second},
+			window: 3,
+			segments: [][]av.Fragment{
+				testSegment(time.Second, time.Second),
+				testSegment(time.Second, time.Second),
+				testSegment(time.Second, time.Second),
+				testSegment(time.Second, time.Second),
+				testSegment(time.Second),
+			},
+			want: "#EXTM3U\n" +
+				"#EXT-X-VERSION:9\n" +
+				"#EXT-X-TARGETDURATION:2\n" +
+				"#EXT-X-MEDIA-SEQUENCE:1\n" +
+				"#EXT-X-INDEPENDENT-SEGMENTS\n" +
+				"#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=3.000\n" +
+				"#EXT-X-PART-INF:PART-TARGET=1.000\n" +
+				"#EXT-X-MAP:URI=\"init.mp4\"\n" +
+				// parts are only listed for the last three segments.
+				"#EXTINF:2.000,\n1.m4s\n" +
+				"#EXT-X-PART:DURATION=1.000,URI=\"2.0.m4s\",INDEPENDENT=YES\n" +
+				"#EXT-X-PART:DURATION=1.000,URI=\"2.1.m4s\"\n" +
+				"#EXTINF:2.000,\n2.m4s\n" +
+				"#EXT-X-PART:DURATION=1.000,URI=\"3.0.m4s\",INDEPENDENT=YES\n" +
+				"#EXT-X-PART:DURATION=1.000,URI=\"3.1.m4s\"\n" +
+				"#EXTINF:2.000,\n3.m4s\n" +
+				"#EXT-X-PART:DURATION=1.000,URI=\"4.0.m4s\",INDEPENDENT=YES\n" +
+				"#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"4.1.m4s\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track := &cmafTrack{window: tt.window, updated: make(chan struct{})}
+			for _, segment := range tt.segments {
+				for _, f := range segment {
+					track.addFragment(f)
+				}
+			}
+			if tt.ended {
+				track.end()
+			}
+			if got := track.hlsPlaylist(&tt.config); got != tt.want {
+				t.Errorf("got playlist\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package transcoder
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Handler returns the HTTP endpoints of the server, which are enabled by their options: the HLS output
+// with WithHLS, the DASH output with WithDASH, and the WHIP and WHEP endpoints with WithWHIP and
+// WithWHEP. It's served separately from the grpc server.
+func (s *TranscoderServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	if s.hls != nil {
+		mux.HandleFunc("/hls/", s.serveHLS)
+	}
+	if s.dash != nil {
+		mux.Handle("/dash/", s.serveDASH())
+	}
+	if s.whip != nil {
+		mux.HandleFunc("/whip/", s.serveWHIP)
+	}
+	if s.whep != nil {
+		mux.HandleFunc("/whep/", s.serveWHEP)
+		mux.HandleFunc("/whep", s.serveWHEP)
+	}
+	return mux
+}
+
+// pathElems splits the path of a request after prefix and unescapes each element.
+func pathElems(r *http.Request, prefix string) ([]string, error) {
+	var elems []string
+	for _, elem := range strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), prefix), "/") {
+		elem, err := url.PathUnescape(elem)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+	}
+	return elems, nil
+}
+
+// httpError writes the error of a grpc handler as an HTTP response.
+func httpError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	message := status.Convert(err).Message()
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		code = http.StatusBadRequest
+	case codes.NotFound, codes.DeadlineExceeded:
+		// the track wasn't published in time.
+		code = http.StatusNotFound
+		message = "track not found"
+	case codes.PermissionDenied:
+		code = http.StatusForbidden
+	case codes.ResourceExhausted:
+		code = http.StatusServiceUnavailable
+	case codes.Unimplemented:
+		code = http.StatusNotImplemented
+	}
+	http.Error(w, message, code)
+}
+
+// authorized returns true if the request has the bearer token, or if no token is needed.
+func authorized(r *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) == 1
+}
+
+// allowCORS lets browsers on other origins call the signalling endpoints, and answers preflight
+// requests. It returns true if the request was a preflight request.
+func allowCORS(w http.ResponseWriter, r *http.Request, methods string) bool {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "Location")
+	if r.Method != http.MethodOptions {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Methods", methods)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// maxOfferSize bounds the size of an sdp offer in a request body.
+const maxOfferSize = 64 << 10
+
+// readOffer reads the sdp offer of a request, writing an error response if it isn't one.
+func readOffer(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/sdp" {
+		http.Error(w, "expected an application/sdp offer", http.StatusUnsupportedMediaType)
+		return "", false
+	}
+	buf, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxOfferSize))
+	if err != nil {
+		http.Error(w, "failed to read offer", http.StatusBadRequest)
+		return "", false
+	}
+	return string(buf), true
+}
+
+// answer applies an offer and returns the answer with every ICE candidate, since the HTTP endpoints
+// don't support trickle ICE.
+func answer(ctx context.Context, pc *webrtc.PeerConnection, offer string) (string, error) {
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		return "", err
+	}
+	desc, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(desc); err != nil {
+		return "", err
+	}
+	select {
+	case <-gathered:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	return pc.LocalDescription().SDP, nil
+}
+
+// writeAnswer responds to an offer with the answer of a new session.
+func writeAnswer(w http.ResponseWriter, location, sdp string) {
+	w.Header().Set("Content-Type", "application/sdp")
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(sdp))
+}
+
+// sessionKey identifies a peer connection created over HTTP by the endpoint and stream in its
+// resource url, so a session can only be closed through the url it was created with.
+type sessionKey struct {
+	endpoint string
+	streamID string
+	id       string
+}
+
+// addSession registers a peer connection created over HTTP so it can be closed with a DELETE request
+// to its resource url, and returns its key.
+func (s *TranscoderServer) addSession(endpoint, streamID string, pc *webrtc.PeerConnection) (sessionKey, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return sessionKey{}, err
+	}
+	key := sessionKey{endpoint: endpoint, streamID: streamID, id: hex.EncodeToString(buf)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions == nil {
+		s.sessions = make(map[sessionKey]*webrtc.PeerConnection)
+	}
+	s.sessions[key] = pc
+	return key, nil
+}
+
+func (s *TranscoderServer) removeSession(key sessionKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, key)
+}
+
+// closeSession closes the peer connection of a session, which removes the session.
+func (s *TranscoderServer) closeSession(key sessionKey) error {
+	s.mu.Lock()
+	pc, ok := s.sessions[key]
+	s.mu.Unlock()
+	if !ok {
+		return errors.New("session not found")
+	}
+	return pc.Close()
+}
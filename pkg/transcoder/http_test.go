@@ -0,0 +1,62 @@
+package transcoder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestCloseSession(t *testing.T) {
+	s := &TranscoderServer{whip: &WHIPConfiguration{}, whep: &WHEPConfiguration{}}
+	handler := s.Handler()
+
+	newSession := func(endpoint, streamID string) (*webrtc.PeerConnection, sessionKey) {
+		pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { pc.Close() })
+		key, err := s.addSession(endpoint, streamID, pc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pc, key
+	}
+	whipPC, whip := newSession("whip", "a/b")
+	whepPC, whep := newSession("whep", "")
+
+	del := func(target string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, target, nil))
+		return w.Code
+	}
+
+	// a session can't be closed through another endpoint or stream.
+	for _, target := range []string{
+		"/whip/a%2Fb/" + whep.id,
+		"/whip/c/" + whip.id,
+		"/whep/" + whip.id,
+	} {
+		if code := del(target); code != http.StatusNotFound {
+			t.Errorf("DELETE %s: got status %d, want %d", target, code, http.StatusNotFound)
+		}
+	}
+	if whipPC.ConnectionState() == webrtc.PeerConnectionStateClosed || whepPC.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		t.Fatal("expected the sessions to be open")
+	}
+
+	if code := del("/whip/a%2Fb/" + whip.id); code != http.StatusOK {
+		t.Errorf("got status %d for the whip session, want %d", code, http.StatusOK)
+	}
+	if whipPC.ConnectionState() != webrtc.PeerConnectionStateClosed {
+		t.Error("expected the whip session to be closed")
+	}
+	if code := del("/whep/" + whep.id); code != http.StatusOK {
+		t.Errorf("got status %d for the whep session, want %d", code, http.StatusOK)
+	}
+	if whepPC.ConnectionState() != webrtc.PeerConnectionStateClosed {
+		t.Error("expected the whep session to be closed")
+	}
+}
@@ -0,0 +1,101 @@
+package transcoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/muxable/transcoder/pkg/av"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"go.uber.org/zap"
+)
+
+// ingestRetryInterval is how long an ingest waits before reconnecting after its input fails.
+const ingestRetryInterval = time.Second
+
+// ingestTrack is a stream of an av.Ingest published as a track.
+type ingestTrack struct {
+	*av.IngestStream
+	id, streamID string
+}
+
+func (t *ingestTrack) ID() string       { return t.id }
+func (t *ingestTrack) StreamID() string { return t.streamID }
+func (t *ingestTrack) RID() string      { return "" }
+
+func (t *ingestTrack) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
+	p, err := t.IngestStream.ReadRTP()
+	return p, nil, err
+}
+
+// ingestInput is a live input published by an ingest.
+type ingestInput struct {
+	url, format string
+	// options are the options of the input format or protocol.
+	options  map[string]string
+	streamID string
+}
+
+// ingest publishes the streams of a live input until it ends or the context is done. The tracks are
+// named after their kind, video and audio, with a number appended if there are more than one, for
+// example audio2.
+func (s *TranscoderServer) ingest(ctx context.Context, input ingestInput) error {
+	ingest := av.NewIngest(input.url, input.format)
+	for key, value := range input.options {
+		ingest.SetOption(key, value)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			ingest.Close()
+		case <-stop:
+		}
+	}()
+	if err := ingest.Open(); err != nil {
+		return err
+	}
+
+	if !acquire(&s.publishers, s.maxPublishers) {
+		ingest.Close()
+		ingest.Run()
+		return errors.New("too many publishers")
+	}
+	defer atomic.AddInt64(&s.publishers, -1)
+
+	counts := make(map[string]int)
+	ingest.OnStream(func(stream *av.IngestStream) {
+		kind := stream.Kind().String()
+		counts[kind]++
+		id := kind
+		if counts[kind] > 1 {
+			id = fmt.Sprintf("%s%d", kind, counts[kind])
+		}
+		// live inputs can't be asked for a keyframe, encoders send them at a fixed interval.
+		source := newSource(&ingestTrack{IngestStream: stream, id: id, streamID: input.streamID}, nil)
+		stream.OnSenderReport(func(ntp time.Time, rtpTime uint32) {
+			source.senderReport(&rtcp.SenderReport{NTPTime: toNTPTime(ntp), RTPTime: rtpTime})
+		})
+		s.addSource(source)
+	})
+	return ingest.Run()
+}
+
+// ingestLoop runs an ingest until the context is done, reconnecting whenever the input ends or fails.
+func (s *TranscoderServer) ingestLoop(ctx context.Context, input ingestInput) error {
+	for {
+		if err := s.ingest(ctx, input); err != nil && ctx.Err() == nil {
+			zap.L().Warn("ingest failed", zap.String("stream", input.streamID), zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(ingestRetryInterval):
+		}
+	}
+}
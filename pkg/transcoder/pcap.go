@@ -0,0 +1,111 @@
+package transcoder
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtpio/pkg/rtpio"
+)
+
+const (
+	// linktypeRaw is a raw IP packet without a link layer header.
+	linktypeRaw = 101
+	// pcapPort is the UDP port the packets are attributed to, use "Decode As RTP" in Wireshark.
+	pcapPort = 5004
+)
+
+// PCAPWriter writes rtp packets to a pcap capture, wrapped in IPv4 and UDP headers from and to
+// localhost so they can be inspected with Wireshark.
+type PCAPWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// NewPCAPWriter writes the pcap header to w and returns a writer for the packets.
+func NewPCAPWriter(w io.Writer) (*PCAPWriter, error) {
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], linktypeRaw)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &PCAPWriter{w: w}, nil
+}
+
+func (w *PCAPWriter) WriteRTP(p *rtp.Packet) error {
+	payload, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+
+	n := 20 + 8 + len(payload)
+	record := make([]byte, 16+n)
+
+	now := time.Now()
+	binary.LittleEndian.PutUint32(record[0:], uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(now.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:], uint32(n))
+	binary.LittleEndian.PutUint32(record[12:], uint32(n))
+
+	ip := record[16:36]
+	ip[0] = 0x45 // version 4, 20 byte header.
+	binary.BigEndian.PutUint16(ip[2:], uint16(n))
+	ip[8] = 64 // ttl
+	ip[9] = 17 // udp
+	copy(ip[12:], []byte{127, 0, 0, 1})
+	copy(ip[16:], []byte{127, 0, 0, 1})
+	binary.BigEndian.PutUint16(ip[10:], checksum(ip))
+
+	udp := record[36:44]
+	binary.BigEndian.PutUint16(udp[0:], pcapPort)
+	binary.BigEndian.PutUint16(udp[2:], pcapPort)
+	binary.BigEndian.PutUint16(udp[4:], uint16(8+len(payload)))
+	// a zero udp checksum means it isn't computed.
+
+	copy(record[44:], payload)
+
+	w.Lock()
+	defer w.Unlock()
+	_, err = w.w.Write(record)
+	return err
+}
+
+// checksum computes the IPv4 header checksum.
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+type pcapFile struct {
+	*PCAPWriter
+	*os.File
+}
+
+var _ rtpio.RTPWriteCloser = (*pcapFile)(nil)
+
+// CreatePCAPFile creates a pcap file at path that rtp packets can be written to.
+func CreatePCAPFile(path string) (rtpio.RTPWriteCloser, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewPCAPWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &pcapFile{PCAPWriter: w, File: f}, nil
+}
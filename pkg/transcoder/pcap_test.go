@@ -0,0 +1,95 @@
+package transcoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+func TestPCAPWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewPCAPWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRTP(&rtp.Packet{
+		Header:  rtp.Header{Version: 2, PayloadType: 96, SequenceNumber: 1, Timestamp: 2, SSRC: 3},
+		Payload: []byte{0xaa, 0xbb},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	if len(b) != 24+16+42 {
+		t.Fatalf("got %d bytes, want %d", len(b), 24+16+42)
+	}
+
+	header := []byte{
+		0xd4, 0xc3, 0xb2, 0xa1, // magic
+		0x02, 0x00, 0x04, 0x00, // version 2.4
+		0x00, 0x00, 0x00, 0x00, // timezone
+		0x00, 0x00, 0x00, 0x00, // accuracy
+		0xff, 0xff, 0x00, 0x00, // snaplen
+		0x65, 0x00, 0x00, 0x00, // raw ip
+	}
+	if !bytes.Equal(b[:24], header) {
+		t.Errorf("got header %x, want %x", b[:24], header)
+	}
+
+	// the record header starts with the time the packet was written.
+	record := b[24:40]
+	if incl, orig := binary.LittleEndian.Uint32(record[8:]), binary.LittleEndian.Uint32(record[12:]); incl != 42 || orig != 42 {
+		t.Errorf("got lengths %d and %d, want 42", incl, orig)
+	}
+
+	packet := []byte{
+		// ipv4 from and to 127.0.0.1, ttl 64, udp.
+		0x45, 0x00, 0x00, 0x2a, 0x00, 0x00, 0x00, 0x00,
+		0x40, 0x11, 0x7c, 0xc1, 0x7f, 0x00, 0x00, 0x01,
+		0x7f, 0x00, 0x00, 0x01,
+		// udp from and to port 5004, without a checksum.
+		0x13, 0x8c, 0x13, 0x8c, 0x00, 0x16, 0x00, 0x00,
+		// rtp
+		0x80, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02,
+		0x00, 0x00, 0x00, 0x03, 0xaa, 0xbb,
+	}
+	if !bytes.Equal(b[40:], packet) {
+		t.Errorf("got packet %x, want %x", b[40:], packet)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   uint16
+	}{
+		{
+			name:   "localhost",
+			header: []byte{0x45, 0x00, 0x00, 0x2a, 0x00, 0x00, 0x00, 0x00, 0x40, 0x11, 0x00, 0x00, 0x7f, 0x00, 0x00, 0x01, 0x7f, 0x00, 0x00, 0x01},
+			want:   0x7cc1,
+		},
+		{
+			// the example from wikipedia's IPv4 header checksum article.
+			name:   "carry",
+			header: []byte{0x45, 0x00, 0x00, 0x73, 0x00, 0x00, 0x40, 0x00, 0x40, 0x11, 0x00, 0x00, 0xc0, 0xa8, 0x00, 0x01, 0xc0, 0xa8, 0x00, 0xc7},
+			want:   0xb861,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checksum(tt.header)
+			if got != tt.want {
+				t.Errorf("got %#04x, want %#04x", got, tt.want)
+			}
+			// a header with its checksum filled in sums to zero.
+			header := append([]byte{}, tt.header...)
+			binary.BigEndian.PutUint16(header[10:], got)
+			if checksum(header) != 0 {
+				t.Errorf("got %#04x for the checksummed header, want 0", checksum(header))
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package transcoder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/muxable/transcoder/api"
+	"github.com/muxable/transcoder/pkg/av"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WithRecordingDirectory enables the Record rpc, which writes files to dir.
+func WithRecordingDirectory(dir string) ServerOption {
+	return func(s *TranscoderServer) {
+		s.recordingDir = dir
+	}
+}
+
+// recordingPath resolves a file name in the recording directory, names can't escape the directory.
+// Segments replace %d in the file name with their number, any other % is rejected so a name can't be
+// formatted into another directory.
+func (s *TranscoderServer) recordingPath(name string) (string, error) {
+	if strings.Contains(strings.ReplaceAll(filepath.Base(name), "%d", ""), "%") || strings.Contains(filepath.Dir(name), "%") {
+		return "", status.Error(codes.InvalidArgument, "path can only contain %d in the file name")
+	}
+	path, err := confinedPath(s.recordingDir, name)
+	if err != nil {
+		return "", err
+	}
+	if !inDirectory(s.recordingDir, av.SegmentName(path, 0)) {
+		return "", status.Error(codes.InvalidArgument, "path is outside the recording directory")
+	}
+	return path, nil
+}
+
+// confinedPath resolves a file name requested by a client in dir, creating its parent directories.
+// Names are resolved as if dir was the root, so they can't escape it.
+func confinedPath(dir, name string) (string, error) {
+	if name == "" {
+		return "", status.Error(codes.InvalidArgument, "missing path")
+	}
+	path := filepath.Join(dir, filepath.Clean("/"+name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", status.Errorf(codes.Internal, "failed to create directory: %v", err)
+	}
+	return path, nil
+}
+
+// inDirectory returns true if path is in dir or one of its subdirectories.
+func inDirectory(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// recorderTrack validates a track of a Record request.
+func validateRecordTrack(track *api.TranscodeRequest) error {
+	if track == nil {
+		return status.Error(codes.InvalidArgument, "missing track")
+	}
+	if len(track.Layers) > 0 {
+		return status.Error(codes.InvalidArgument, "simulcast recordings are not supported")
+	}
+	if track.MimeType != "" {
+		if _, err := lookupOutputCodec(track.MimeType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *TranscoderServer) Record(request *api.RecordRequest, stream api.Transcoder_RecordServer) error {
+	if s.recordingDir == "" {
+		return status.Error(codes.PermissionDenied, "recording is not enabled")
+	}
+
+	requests := append([]*api.TranscodeRequest{request.Track}, request.Tracks...)
+	for _, track := range requests {
+		if err := validateRecordTrack(track); err != nil {
+			return err
+		}
+	}
+	path, err := s.recordingPath(request.Path)
+	if err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	sources, tracks, err := s.recorderTracks(ctx, requests)
+	if err != nil {
+		return err
+	}
+
+	recorder := av.NewRecorder(path, av.SegmentConfiguration{
+		Duration: time.Duration(request.SegmentDurationSeconds) * time.Second,
+		Size:     int64(request.SegmentSizeBytes),
+	}, tracks...)
+	recorder.OnFile(func(f av.File) {
+		name, err := filepath.Rel(s.recordingDir, f.Path)
+		if err != nil {
+			name = f.Path
+		}
+		zap.L().Info("recorded file", zap.String("path", f.Path), zap.Duration("duration", f.Duration), zap.Int64("size", f.Size))
+		if err := stream.Send(&api.RecordedFile{
+			Path:            name,
+			DurationSeconds: f.Duration.Seconds(),
+			SizeBytes:       uint64(f.Size),
+		}); err != nil {
+			zap.L().Debug("failed to send recorded file", zap.Error(err))
+		}
+	})
+	if err := runRecorder(ctx, recorder, sources); err != nil {
+		return status.Errorf(codes.Internal, "recording failed: %v", err)
+	}
+	return status.FromContextError(ctx.Err()).Err()
+}
+
+// recorderTracks waits for the tracks of a request and describes how each one is written, either as it
+// was published or transcoded.
+func (s *TranscoderServer) recorderTracks(ctx context.Context, requests []*api.TranscodeRequest) ([]*Source, []av.RecorderTrack, error) {
+	sources := make([]*Source, len(requests))
+	tracks := make([]av.RecorderTrack, len(requests))
+	for i, track := range requests {
+		matched, err := s.waitForSource(ctx, track)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources[i] = matched
+		tracks[i] = av.RecorderTrack{Codec: matched.Track.Codec()}
+		if track.MimeType != "" {
+			outCodec, err := lookupOutputCodec(track.MimeType)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !strings.HasPrefix(outCodec.MimeType, matched.Track.Kind().String()+"/") {
+				return nil, nil, status.Errorf(codes.InvalidArgument, "cannot transcode %s track to %s", matched.Track.Kind(), outCodec.MimeType)
+			}
+			tracks[i].To = outCodec.RTPCodecCapability
+			tracks[i].Config = encoderConfiguration(track)
+		}
+	}
+	return sources, tracks, nil
+}
+
+// runRecorder writes the sources to a recorder until their tracks end or the context is done, which
+// finishes the last file. It returns the error of the recorder.
+func runRecorder(ctx context.Context, recorder *av.Recorder, sources []*Source) error {
+	for i, input := range recorder.Inputs {
+		input.OnKeyframeRequest(sources[i].requestKeyframe)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- recorder.Run() }()
+
+	// the inputs are closed when their tracks end, which finishes the last file.
+	for i, input := range recorder.Inputs {
+		sources[i].addSink(input)
+	}
+	removeSinks := func() {
+		for i, input := range recorder.Inputs {
+			sources[i].removeSink(input)
+		}
+	}
+
+	select {
+	case err := <-done:
+		removeSinks()
+		return err
+	case <-ctx.Done():
+		// wait for the last file to be finished.
+		removeSinks()
+		return <-done
+	}
+}
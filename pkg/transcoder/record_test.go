@@ -0,0 +1,49 @@
+package transcoder
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/muxable/transcoder/pkg/av"
+)
+
+func TestRecordingPath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		// want is the name of the segment numbered 46 relative to the recording directory, empty if the
+		// path is rejected.
+		want string
+	}{
+		{name: "file", path: "a.webm", want: "a-46.webm"},
+		{name: "subdirectory", path: "a/b.webm", want: "a/b-46.webm"},
+		{name: "parent directory", path: "../a.webm", want: "a-46.webm"},
+		{name: "numbered", path: "a/%d.webm", want: "a/46.webm"},
+		{name: "numbered twice", path: "a-%d-%d.webm", want: "a-46-46.webm"},
+		// 46 is '.', so formatting the name would write to the parent of the recording directory.
+		{name: "character verb", path: "%[1]c%[1]c/x.webm"},
+		{name: "string verb", path: "%s.webm"},
+		{name: "literal percent", path: "100%.webm"},
+		{name: "numbered directory", path: "%d/a.webm"},
+		{name: "empty", path: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := &TranscoderServer{recordingDir: dir}
+			path, err := s.recordingPath(tt.path)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := av.SegmentName(path, 46); got != filepath.Join(dir, tt.want) {
+				t.Errorf("got %s, want %s", got, filepath.Join(dir, tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package transcoder
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/muxable/transcoder/pkg/codecs"
+	"github.com/muxable/transcoder/pkg/rtmp"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	rtpcodecs "github.com/pion/rtp/codecs"
+	"github.com/pion/rtpio/pkg/rtpio"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+const (
+	// the FLV codec ids of the supported codecs.
+	flvCodecAVC = 7
+	flvCodecAAC = 10
+
+	// rtmpMTU is the size of the rtp packets the tags are split into.
+	rtmpMTU = 1200
+	// rtmpReportInterval is how often sender reports are generated to synchronize the tracks.
+	rtmpReportInterval = time.Second
+	// aacFrameSize is the number of samples in an AAC frame.
+	aacFrameSize = 1024
+)
+
+// aacSampleRates are the sample rates of the sampling frequency index of an AudioSpecificConfig.
+var aacSampleRates = []uint32{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// ServeRTMP accepts RTMP publishers on the listener until it's closed, for example from OBS. Each stream
+// is published with its stream key as the stream id and its tracks are named video and audio, so they
+// can be subscribed to like any other track. Only H.264 video and AAC audio are supported.
+func (s *TranscoderServer) ServeRTMP(lis net.Listener) error {
+	return rtmp.Serve(lis, s.rtmpPublish)
+}
+
+// rtmpTrack is a track of an RTMP stream, its tags are packetized to rtp.
+type rtmpTrack struct {
+	id, streamID string
+	kind         webrtc.RTPCodecType
+	codec        webrtc.RTPCodecParameters
+
+	r rtpio.RTPReadCloser
+	w rtpio.RTPWriteCloser
+
+	payloader rtp.Payloader
+	sequencer rtp.Sequencer
+	ssrc      uint32
+	source    *Source
+
+	// reportedAt is the timestamp of the last sender report in milliseconds.
+	reportedAt uint32
+	reported   bool
+}
+
+func newRTMPTrack(streamID string, kind webrtc.RTPCodecType, codec webrtc.RTPCodecParameters, payloader rtp.Payloader) *rtmpTrack {
+	r, w := rtpio.RTPPipe()
+	return &rtmpTrack{
+		id:        kind.String(),
+		streamID:  streamID,
+		kind:      kind,
+		codec:     codec,
+		r:         r,
+		w:         w,
+		payloader: payloader,
+		sequencer: rtp.NewRandomSequencer(),
+		ssrc:      rand.Uint32(),
+	}
+}
+
+func (t *rtmpTrack) ID() string                       { return t.id }
+func (t *rtmpTrack) StreamID() string                 { return t.streamID }
+func (t *rtmpTrack) RID() string                      { return "" }
+func (t *rtmpTrack) Kind() webrtc.RTPCodecType        { return t.kind }
+func (t *rtmpTrack) Codec() webrtc.RTPCodecParameters { return t.codec }
+
+func (t *rtmpTrack) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
+	p, err := t.r.ReadRTP()
+	return p, nil, err
+}
+
+// write packetizes a frame with the given rtp timestamp. at is the presentation time of the frame in
+// milliseconds since start, it's used to generate the sender reports.
+func (t *rtmpTrack) write(frame []byte, timestamp uint32, start time.Time, at uint32) error {
+	if !t.reported || at-t.reportedAt >= uint32(rtmpReportInterval/time.Millisecond) {
+		t.reported, t.reportedAt = true, at
+		t.source.senderReport(&rtcp.SenderReport{
+			SSRC:    t.ssrc,
+			NTPTime: toNTPTime(start.Add(time.Duration(at) * time.Millisecond)),
+			RTPTime: timestamp,
+		})
+	}
+	payloads := t.payloader.Payload(rtmpMTU, frame)
+	for i, payload := range payloads {
+		p := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         i == len(payloads)-1,
+				PayloadType:    uint8(t.codec.PayloadType),
+				SequenceNumber: t.sequencer.NextSequenceNumber(),
+				Timestamp:      timestamp,
+				SSRC:           t.ssrc,
+			},
+			Payload: payload,
+		}
+		if err := t.w.WriteRTP(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rtmpStream converts the tags of an RTMP stream to rtp, registering a source for each track once its
+// sequence header is received.
+type rtmpStream struct {
+	s     *TranscoderServer
+	key   string
+	video *rtmpTrack
+	audio *rtmpTrack
+
+	// start is the wall clock time of the first tag, which has the timestamp base.
+	start time.Time
+	base  uint32
+
+	// the parameters of the last AVC sequence header, they're sent before every keyframe.
+	nalLengthSize int
+	parameterSets [][]byte
+
+	// audioTimestamp is the rtp timestamp of the next AAC frame.
+	audioTimestamp uint32
+}
+
+func (s *TranscoderServer) rtmpPublish(p *rtmp.Publisher) error {
+	if p.Key == "" || strings.ContainsAny(p.Key, " \t\r\n") {
+		return errors.New("invalid stream key")
+	}
+
+	if !s.reserveStream(p.Key) {
+		return errors.New("stream key is already publishing")
+	}
+	defer s.releaseStream(p.Key)
+
+	if !acquire(&s.publishers, s.maxPublishers) {
+		return errors.New("too many publishers")
+	}
+	defer atomic.AddInt64(&s.publishers, -1)
+
+	stream := &rtmpStream{s: s, key: p.Key}
+	// closing the tracks ends them, which removes their sources.
+	defer stream.close()
+
+	zap.L().Info("rtmp stream published", zap.String("key", p.Key), zap.Stringer("addr", p.RemoteAddr()))
+	for {
+		tag, err := p.ReadTag()
+		if err != nil {
+			return err
+		}
+		if stream.start.IsZero() {
+			stream.start, stream.base = time.Now(), tag.Timestamp
+		}
+		switch tag.Type {
+		case rtmp.TagVideo:
+			err = stream.writeVideo(tag.Timestamp-stream.base, tag.Data)
+		case rtmp.TagAudio:
+			err = stream.writeAudio(tag.Timestamp-stream.base, tag.Data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *rtmpStream) close() {
+	for _, track := range []*rtmpTrack{r.video, r.audio} {
+		if track != nil {
+			track.w.Close()
+		}
+	}
+}
+
+// addTrack registers a track as a source.
+func (r *rtmpStream) addTrack(track *rtmpTrack) {
+	// an RTMP publisher can't be asked for a keyframe, encoders send them at a fixed interval.
+	track.source = newSource(track, nil)
+	r.s.addSource(track.source)
+}
+
+// writeVideo converts an AVC video tag to Annex B and packetizes it.
+func (r *rtmpStream) writeVideo(at uint32, data []byte) error {
+	if data[0]&0x0f != flvCodecAVC {
+		return fmt.Errorf("unsupported video codec %d, only H.264 is supported", data[0]&0x0f)
+	}
+	if len(data) < 5 {
+		return errors.New("invalid avc tag")
+	}
+	keyframe := data[0]>>4 == 1
+	// the composition time is a signed 24 bit offset of the presentation time.
+	cts := int32(uint32(data[2])<<16|uint32(data[3])<<8|uint32(data[4])) << 8 >> 8
+	body := data[5:]
+
+	switch data[1] {
+	case 0:
+		return r.writeAVCSequenceHeader(body)
+	case 1:
+		if r.video == nil {
+			// the frames can't be decoded without the sequence header.
+			return nil
+		}
+		var frame []byte
+		if keyframe {
+			frame = annexB(nil, r.parameterSets)
+		}
+		nalus, err := splitAVCC(body, r.nalLengthSize)
+		if err != nil {
+			return err
+		}
+		frame = annexB(frame, nalus)
+		pts := uint32(int32(at) + cts)
+		return r.video.write(frame, pts*90, r.start, pts)
+	}
+	return nil
+}
+
+// splitAVCC splits the length prefixed nal units of an AVC tag.
+func splitAVCC(body []byte, nalLengthSize int) ([][]byte, error) {
+	var nalus [][]byte
+	for len(body) > 0 {
+		if len(body) < nalLengthSize {
+			return nil, errors.New("invalid avc nal unit")
+		}
+		var n uint32
+		for _, b := range body[:nalLengthSize] {
+			n = n<<8 | uint32(b)
+		}
+		body = body[nalLengthSize:]
+		if uint32(len(body)) < n {
+			return nil, errors.New("invalid avc nal unit")
+		}
+		nalus = append(nalus, body[:n])
+		body = body[n:]
+	}
+	return nalus, nil
+}
+
+// annexB appends the nal units to frame, each prefixed with a start code.
+func annexB(frame []byte, nalus [][]byte) []byte {
+	for _, nalu := range nalus {
+		frame = append(frame, 0, 0, 0, 1)
+		frame = append(frame, nalu...)
+	}
+	return frame
+}
+
+// avcConfig is the content of an AVCDecoderConfigurationRecord.
+type avcConfig struct {
+	nalLengthSize int
+	// parameterSets are the sps followed by the pps.
+	parameterSets [][]byte
+	sps           []byte
+}
+
+// parseAVCConfig reads an AVCDecoderConfigurationRecord, see ISO/IEC 14496-15 5.2.4.1.
+func parseAVCConfig(record []byte) (*avcConfig, error) {
+	if len(record) < 6 {
+		return nil, errors.New("invalid avc sequence header")
+	}
+	config := &avcConfig{nalLengthSize: int(record[4]&0x03) + 1}
+	// the sps count is followed by the sps, then the pps count by the pps.
+	buf := record[5:]
+	for _, mask := range []byte{0x1f, 0xff} {
+		if len(buf) < 1 {
+			return nil, errors.New("invalid avc sequence header")
+		}
+		n := int(buf[0] & mask)
+		buf = buf[1:]
+		for i := 0; i < n; i++ {
+			if len(buf) < 2 || len(buf) < 2+int(binary.BigEndian.Uint16(buf)) {
+				return nil, errors.New("invalid avc sequence header")
+			}
+			ps := buf[2 : 2+binary.BigEndian.Uint16(buf)]
+			if config.sps == nil && mask == 0x1f {
+				config.sps = ps
+			}
+			config.parameterSets = append(config.parameterSets, ps)
+			buf = buf[2+len(ps):]
+		}
+	}
+	return config, nil
+}
+
+// fmtpLine returns the fmtp line of the H.264 stream, or an empty string if there's no valid sps.
+func (c *avcConfig) fmtpLine() string {
+	if len(c.sps) < 4 {
+		return ""
+	}
+	sprops := make([]string, len(c.parameterSets))
+	for i, ps := range c.parameterSets {
+		sprops[i] = base64.StdEncoding.EncodeToString(ps)
+	}
+	return fmt.Sprintf("packetization-mode=1;profile-level-id=%x;sprop-parameter-sets=%s", c.sps[1:4], strings.Join(sprops, ","))
+}
+
+// writeAVCSequenceHeader reads the parameter sets from an AVCDecoderConfigurationRecord, and adds the
+// video track if it's the first one.
+func (r *rtmpStream) writeAVCSequenceHeader(record []byte) error {
+	config, err := parseAVCConfig(record)
+	if err != nil {
+		return err
+	}
+	r.nalLengthSize = config.nalLengthSize
+	r.parameterSets = config.parameterSets
+	fmtp := config.fmtpLine()
+	if r.video != nil || fmtp == "" {
+		return nil
+	}
+
+	codec := codecs.DefaultOutputCodecs[webrtc.MimeTypeH264]
+	codec.SDPFmtpLine = fmtp
+	r.video = newRTMPTrack(r.key, webrtc.RTPCodecTypeVideo, codec, &rtpcodecs.H264Payloader{})
+	r.addTrack(r.video)
+	return nil
+}
+
+// writeAudio packetizes an AAC audio tag.
+func (r *rtmpStream) writeAudio(at uint32, data []byte) error {
+	if data[0]>>4 != flvCodecAAC {
+		return fmt.Errorf("unsupported audio codec %d, only AAC is supported", data[0]>>4)
+	}
+	if len(data) < 2 {
+		return errors.New("invalid aac tag")
+	}
+	switch data[1] {
+	case 0:
+		if r.audio != nil {
+			return nil
+		}
+		return r.writeAACSequenceHeader(data[2:])
+	case 1:
+		if r.audio == nil {
+			return nil
+		}
+		// the timestamps are counted in samples, the millisecond timestamps of the tags are only used
+		// when they drift, for example if frames were dropped.
+		rate := r.audio.codec.ClockRate
+		timestamp := uint32(uint64(at) * uint64(rate) / 1000)
+		if drift := int32(timestamp - r.audioTimestamp); r.audio.reported && drift < int32(rate/20) && drift > -int32(rate/20) {
+			timestamp = r.audioTimestamp
+		}
+		r.audioTimestamp = timestamp + aacFrameSize
+		return r.audio.write(data[2:], timestamp, r.start, at)
+	}
+	return nil
+}
+
+// parseAACConfig reads the sample rate and channels of an AudioSpecificConfig.
+func parseAACConfig(config []byte) (rate uint32, channels uint16, err error) {
+	if len(config) < 2 {
+		return 0, 0, errors.New("invalid aac sequence header")
+	}
+	// the object type is 5 bits, followed by the 4 bit sampling frequency index and channels.
+	index := (config[0]&0x07)<<1 | config[1]>>7
+	channels = uint16(config[1] >> 3 & 0x0f)
+	if index == 0x0f {
+		// the sample rate is explicit.
+		if len(config) < 5 {
+			return 0, 0, errors.New("invalid aac sequence header")
+		}
+		rate = (uint32(config[1]&0x7f)<<17 | uint32(config[2])<<9 | uint32(config[3])<<1 | uint32(config[4])>>7)
+		channels = uint16(config[4] >> 3 & 0x0f)
+	} else if int(index) < len(aacSampleRates) {
+		rate = aacSampleRates[index]
+	} else {
+		return 0, 0, errors.New("invalid aac sample rate")
+	}
+	return rate, channels, nil
+}
+
+// writeAACSequenceHeader reads the sample rate and channels of an AudioSpecificConfig and adds the
+// audio track.
+func (r *rtmpStream) writeAACSequenceHeader(config []byte) error {
+	rate, channels, err := parseAACConfig(config)
+	if err != nil {
+		return err
+	}
+
+	codec := webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    "audio/MPEG4-GENERIC",
+			ClockRate:   rate,
+			Channels:    channels,
+			SDPFmtpLine: codecs.AACFmtpLine(config),
+		},
+		PayloadType: 97,
+	}
+	r.audio = newRTMPTrack(r.key, webrtc.RTPCodecTypeAudio, codec, &codecs.AACPayloader{})
+	r.addTrack(r.audio)
+	return nil
+}
@@ -0,0 +1,138 @@
+package transcoder
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParseAVCConfig(t *testing.T) {
+	sps := []byte{0x67, 0x42, 0xc0, 0x1f}
+	pps := []byte{0x68, 0xce}
+	tests := []struct {
+		name   string
+		record []byte
+		want   *avcConfig
+		fmtp   string
+	}{
+		{
+			name:   "baseline",
+			record: []byte{0x01, 0x42, 0xc0, 0x1f, 0xff, 0xe1, 0x00, 0x04, 0x67, 0x42, 0xc0, 0x1f, 0x01, 0x00, 0x02, 0x68, 0xce},
+			want:   &avcConfig{nalLengthSize: 4, parameterSets: [][]byte{sps, pps}, sps: sps},
+			fmtp:   "packetization-mode=1;profile-level-id=42c01f;sprop-parameter-sets=Z0LAHw==,aM4=",
+		},
+		{
+			name:   "two byte lengths",
+			record: []byte{0x01, 0x42, 0xc0, 0x1f, 0xfd, 0xe1, 0x00, 0x04, 0x67, 0x42, 0xc0, 0x1f, 0x01, 0x00, 0x02, 0x68, 0xce},
+			want:   &avcConfig{nalLengthSize: 2, parameterSets: [][]byte{sps, pps}, sps: sps},
+			fmtp:   "packetization-mode=1;profile-level-id=42c01f;sprop-parameter-sets=Z0LAHw==,aM4=",
+		},
+		{
+			// the track can't be described without the profile in the sps.
+			name:   "short sps",
+			record: []byte{0x01, 0x42, 0xc0, 0x1f, 0xff, 0xe1, 0x00, 0x02, 0x67, 0x42, 0x00},
+			want:   &avcConfig{nalLengthSize: 4, parameterSets: [][]byte{{0x67, 0x42}}, sps: []byte{0x67, 0x42}},
+		},
+		{name: "empty", record: nil},
+		{name: "truncated sps", record: []byte{0x01, 0x42, 0xc0, 0x1f, 0xff, 0xe1, 0x00, 0x04, 0x67, 0x42}},
+		{name: "missing pps count", record: []byte{0x01, 0x42, 0xc0, 0x1f, 0xff, 0xe1, 0x00, 0x04, 0x67, 0x42, 0xc0, 0x1f}},
+		{name: "truncated pps", record: []byte{0x01, 0x42, 0xc0, 0x1f, 0xff, 0xe1, 0x00, 0x04, 0x67, 0x42, 0xc0, 0x1f, 0x01, 0x00, 0x02, 0x68}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAVCConfig(tt.record)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if fmtp := got.fmtpLine(); fmtp != tt.fmtp {
+				t.Errorf("got fmtp %q, want %q", fmtp, tt.fmtp)
+			}
+		})
+	}
+}
+
+func TestSplitAVCC(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          []byte
+		nalLengthSize int
+		want          []byte
+		wantErr       bool
+	}{
+		{
+			name:          "four byte lengths",
+			body:          []byte{0x00, 0x00, 0x00, 0x02, 0x65, 0x88, 0x00, 0x00, 0x00, 0x01, 0x06},
+			nalLengthSize: 4,
+			want:          []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x00, 0x00, 0x00, 0x01, 0x06},
+		},
+		{
+			name:          "two byte lengths",
+			body:          []byte{0x00, 0x02, 0x65, 0x88},
+			nalLengthSize: 2,
+			want:          []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88},
+		},
+		{name: "empty", nalLengthSize: 4},
+		{name: "truncated length", body: []byte{0x00, 0x00, 0x02}, nalLengthSize: 4, wantErr: true},
+		{name: "truncated nal unit", body: []byte{0x00, 0x00, 0x00, 0x03, 0x65, 0x88}, nalLengthSize: 4, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nalus, err := splitAVCC(tt.body, tt.nalLengthSize)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %x", nalus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := annexB(nil, nalus); !bytes.Equal(got, tt.want) {
+				t.Errorf("got %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAACConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   []byte
+		rate     uint32
+		channels uint16
+		wantErr  bool
+	}{
+		{name: "44.1 kHz stereo", config: []byte{0x12, 0x10}, rate: 44100, channels: 2},
+		{name: "48 kHz stereo", config: []byte{0x11, 0x90}, rate: 48000, channels: 2},
+		{name: "explicit rate", config: []byte{0x17, 0x80, 0x18, 0x1c, 0x88}, rate: 12345, channels: 1},
+		{name: "reserved rate", config: []byte{0x16, 0x90}, wantErr: true},
+		{name: "truncated", config: []byte{0x12}, wantErr: true},
+		{name: "truncated explicit rate", config: []byte{0x17, 0x80, 0x18}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, channels, err := parseAACConfig(tt.config)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d Hz and %d channels", rate, channels)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rate != tt.rate || channels != tt.channels {
+				t.Errorf("got %d Hz and %d channels, want %d Hz and %d channels", rate, channels, tt.rate, tt.channels)
+			}
+		})
+	}
+}
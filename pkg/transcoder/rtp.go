@@ -0,0 +1,524 @@
+package transcoder
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/muxable/transcoder/api"
+	"github.com/muxable/transcoder/pkg/av"
+	"github.com/muxable/transcoder/pkg/codecs"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/rtpio/pkg/rtpio"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/srtp/v2"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// rtpTimeout ends a plain rtp track when its sender stops sending. It doesn't apply before the first
+	// packet, the track waits for the sender to start until the call is canceled.
+	rtpTimeout = 10 * time.Second
+	// rtpPortAttempts is how many ephemeral port pairs are tried when the server has no port range.
+	rtpPortAttempts = 16
+)
+
+// RTPConfiguration configures the PublishRTP and SubscribeRTP rpcs, which receive and send plain rtp
+// streams described by an sdp instead of a PeerConnection, for example to and from ffmpeg or GStreamer.
+type RTPConfiguration struct {
+	// PortMin and PortMax are the range of UDP ports the streams are received on, any free port is used
+	// if they're zero. Each stream uses two consecutive ports, for rtp and rtcp.
+	PortMin, PortMax uint16
+	// Host is the address of the server in the response sdp, it defaults to 127.0.0.1.
+	Host string
+}
+
+// WithRTP enables the PublishRTP and SubscribeRTP rpcs. SubscribeRTP sends to any address, so they
+// should only be enabled for trusted clients.
+func WithRTP(config RTPConfiguration) ServerOption {
+	return func(s *TranscoderServer) {
+		s.rtp = &config
+	}
+}
+
+// listen allocates an even port for rtp and the next one for rtcp, as RFC 3550 recommends.
+func (c *RTPConfiguration) listen() (*net.UDPConn, *net.UDPConn, error) {
+	try := func(port int) (*net.UDPConn, *net.UDPConn, bool) {
+		rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+		if err != nil {
+			return nil, nil, false
+		}
+		port = rtpConn.LocalAddr().(*net.UDPAddr).Port
+		if port%2 != 0 || port == 65535 {
+			rtpConn.Close()
+			return nil, nil, false
+		}
+		rtcpConn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port + 1})
+		if err != nil {
+			rtpConn.Close()
+			return nil, nil, false
+		}
+		return rtpConn, rtcpConn, true
+	}
+
+	if c.PortMin == 0 && c.PortMax == 0 {
+		for i := 0; i < rtpPortAttempts; i++ {
+			if rtpConn, rtcpConn, ok := try(0); ok {
+				return rtpConn, rtcpConn, nil
+			}
+		}
+		return nil, nil, errors.New("failed to allocate udp ports")
+	}
+	min, max := int(c.PortMin+c.PortMin%2), int(c.PortMax)
+	if min >= max {
+		return nil, nil, errors.New("the udp port range is too small")
+	}
+	// start at a random port so the pairs of ended streams aren't reused immediately.
+	n := (max - min + 1) / 2
+	start := rand.Intn(n)
+	for i := 0; i < n; i++ {
+		if rtpConn, rtcpConn, ok := try(min + (start+i)%n*2); ok {
+			return rtpConn, rtcpConn, nil
+		}
+	}
+	return nil, nil, errors.New("no free udp ports in range")
+}
+
+// rtpTrack is a plain rtp stream received over UDP.
+type rtpTrack struct {
+	id, streamID string
+	kind         webrtc.RTPCodecType
+	codec        webrtc.RTPCodecParameters
+
+	rtpConn, rtcpConn *net.UDPConn
+
+	// started is set once a packet is received, the read timeout only applies after it.
+	started bool
+
+	// ssrc is the ssrc of the last packet, and rtcpAddr is where the sender's rtcp was last received
+	// from. Keyframe requests are sent there.
+	ssrc     uint32
+	rtcpAddr atomic.Value
+}
+
+func (t *rtpTrack) ID() string                       { return t.id }
+func (t *rtpTrack) StreamID() string                 { return t.streamID }
+func (t *rtpTrack) RID() string                      { return "" }
+func (t *rtpTrack) Kind() webrtc.RTPCodecType        { return t.kind }
+func (t *rtpTrack) Codec() webrtc.RTPCodecParameters { return t.codec }
+
+// ReadRTP reads the next packet of the codec's payload type, it returns io.EOF if the sender has started
+// and none is received for rtpTimeout.
+func (t *rtpTrack) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
+	for {
+		var deadline time.Time
+		if t.started {
+			deadline = time.Now().Add(rtpTimeout)
+		}
+		if err := t.rtpConn.SetReadDeadline(deadline); err != nil {
+			return nil, nil, err
+		}
+		// the packets are buffered by the sinks, so each one needs its own buffer.
+		buf := make([]byte, 1500)
+		n, err := t.rtpConn.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, nil, io.EOF
+			}
+			return nil, nil, err
+		}
+		p := &rtp.Packet{}
+		if err := p.Unmarshal(buf[:n]); err != nil {
+			zap.L().Debug("failed to unmarshal rtp packet", zap.Error(err))
+			continue
+		}
+		if p.PayloadType != uint8(t.codec.PayloadType) {
+			continue
+		}
+		t.started = true
+		atomic.StoreUint32(&t.ssrc, p.SSRC)
+		return p, nil, nil
+	}
+}
+
+// readRTCP forwards the sender reports of the track to its source until the track is closed.
+func (t *rtpTrack) readRTCP(source *Source) {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := t.rtcpConn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		t.rtcpAddr.Store(addr)
+		pkts, err := rtcp.Unmarshal(buf[:n])
+		if err != nil {
+			zap.L().Debug("failed to unmarshal rtcp packet", zap.Error(err))
+			continue
+		}
+		for _, pkt := range pkts {
+			if sr, ok := pkt.(*rtcp.SenderReport); ok {
+				source.senderReport(sr)
+			}
+		}
+	}
+}
+
+// pli asks the sender for a keyframe, senders that don't send rtcp can't be asked.
+func (t *rtpTrack) pli() error {
+	addr, ok := t.rtcpAddr.Load().(*net.UDPAddr)
+	if !ok {
+		return nil
+	}
+	buf, err := rtcp.Marshal([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: atomic.LoadUint32(&t.ssrc)}})
+	if err != nil {
+		return err
+	}
+	_, err = t.rtcpConn.WriteToUDP(buf, addr)
+	return err
+}
+
+func (t *rtpTrack) close() {
+	t.rtpConn.Close()
+	t.rtcpConn.Close()
+}
+
+func (s *TranscoderServer) PublishRTP(request *api.PublishRTPRequest, stream api.Transcoder_PublishRTPServer) error {
+	if s.rtp == nil {
+		return status.Error(codes.PermissionDenied, "rtp publishing is not enabled")
+	}
+	if request.StreamId == "" {
+		return status.Error(codes.InvalidArgument, "missing stream id")
+	}
+	desc := &sdp.SessionDescription{}
+	if err := desc.Unmarshal([]byte(request.Sdp)); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid sdp: %v", err)
+	}
+
+	// resolve every track before allocating ports so an invalid sdp doesn't leak them.
+	tracks := make([]*rtpTrack, len(desc.MediaDescriptions))
+	counts := make(map[string]int)
+	for i, md := range desc.MediaDescriptions {
+		kind := webrtc.NewRTPCodecType(md.MediaName.Media)
+		if kind == 0 {
+			// other media, such as data channels, are rejected with port zero.
+			continue
+		}
+		codec, err := codecs.MediaCodec(desc, md)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid %s media section: %v", md.MediaName.Media, err)
+		}
+		id, ok := md.Attribute(sdp.AttrKeyMID)
+		if !ok || id == "" {
+			counts[kind.String()]++
+			id = kind.String()
+			if counts[kind.String()] > 1 {
+				id = fmt.Sprintf("%s%d", kind, counts[kind.String()])
+			}
+		}
+		tracks[i] = &rtpTrack{id: id, streamID: request.StreamId, kind: kind, codec: codec}
+	}
+
+	if !s.reserveStream(request.StreamId) {
+		return status.Error(codes.AlreadyExists, "stream is already publishing")
+	}
+	defer s.releaseStream(request.StreamId)
+
+	if !acquire(&s.publishers, s.maxPublishers) {
+		return status.Error(codes.ResourceExhausted, "too many publishers")
+	}
+	defer atomic.AddInt64(&s.publishers, -1)
+
+	defer func() {
+		for _, track := range tracks {
+			if track != nil && track.rtpConn != nil {
+				track.close()
+			}
+		}
+	}()
+	ports := make([]uint32, len(tracks))
+	for i, track := range tracks {
+		if track == nil {
+			continue
+		}
+		rtpConn, rtcpConn, err := s.rtp.listen()
+		if err != nil {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		track.rtpConn, track.rtcpConn = rtpConn, rtcpConn
+		ports[i] = uint32(rtpConn.LocalAddr().(*net.UDPAddr).Port)
+	}
+
+	answer, err := rtpAnswer(desc, s.rtp.Host, ports)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to create sdp: %v", err)
+	}
+	if err := stream.Send(&api.PublishRTPResponse{Sdp: answer, Ports: ports}); err != nil {
+		return err
+	}
+
+	zap.L().Info("rtp stream published", zap.String("stream", request.StreamId), zap.Uint32s("ports", ports))
+	var wg sync.WaitGroup
+	for _, track := range tracks {
+		if track == nil {
+			continue
+		}
+		source := newSource(track, track.pli)
+		go track.readRTCP(source)
+		s.addSource(source)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-source.done
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-stream.Context().Done():
+		return status.FromContextError(stream.Context().Err()).Err()
+	}
+}
+
+// rtpAnswer rewrites an sdp to send to the server's host and ports.
+func rtpAnswer(desc *sdp.SessionDescription, host string, ports []uint32) (string, error) {
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	addressType := "IP4"
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		addressType = "IP6"
+	}
+	desc.ConnectionInformation = &sdp.ConnectionInformation{
+		NetworkType: "IN",
+		AddressType: addressType,
+		Address:     &sdp.Address{Address: host},
+	}
+	for i, md := range desc.MediaDescriptions {
+		md.ConnectionInformation = nil
+		md.MediaName.Port = sdp.RangedPort{Value: int(ports[i])}
+	}
+	buf, err := desc.Marshal()
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// srtpProfiles are the supported SRTP protection profiles by their SDES name, with the lengths of their
+// master keys and salts.
+var srtpProfiles = map[string]struct {
+	profile         srtp.ProtectionProfile
+	keyLen, saltLen int
+}{
+	"AES_CM_128_HMAC_SHA1_80": {srtp.ProtectionProfileAes128CmHmacSha1_80, 16, 14},
+	"AES_CM_128_HMAC_SHA1_32": {srtp.ProtectionProfileAes128CmHmacSha1_32, 16, 14},
+	"AEAD_AES_128_GCM":        {srtp.ProtectionProfileAeadAes128Gcm, 16, 12},
+}
+
+// defaultSRTPProfile is the profile of SRTPKeys without one, every SRTP implementation supports it.
+const defaultSRTPProfile = "AES_CM_128_HMAC_SHA1_80"
+
+// SRTPKeys encrypt an rtp stream with SRTP.
+type SRTPKeys struct {
+	// Profile is the SDES name of the protection profile, for example AES_CM_128_HMAC_SHA1_80 which is
+	// the default.
+	Profile               string
+	MasterKey, MasterSalt []byte
+}
+
+// protectionProfile returns the name and profile of the keys, checking the lengths of the key and salt.
+func (k *SRTPKeys) protectionProfile() (string, srtp.ProtectionProfile, error) {
+	name := k.Profile
+	if name == "" {
+		name = defaultSRTPProfile
+	}
+	p, ok := srtpProfiles[name]
+	if !ok {
+		return "", 0, fmt.Errorf("unsupported srtp profile %s", name)
+	}
+	if len(k.MasterKey) != p.keyLen || len(k.MasterSalt) != p.saltLen {
+		return "", 0, fmt.Errorf("%s needs a %d byte master key and a %d byte master salt", name, p.keyLen, p.saltLen)
+	}
+	return name, p.profile, nil
+}
+
+// ParseSRTPKeys reads the base64 master key and salt of an SDES inline parameter, which is also how
+// ffmpeg takes them.
+func ParseSRTPKeys(profile, inline string) (*SRTPKeys, error) {
+	if profile == "" {
+		profile = defaultSRTPProfile
+	}
+	p, ok := srtpProfiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unsupported srtp profile %s", profile)
+	}
+	buf, err := base64.StdEncoding.DecodeString(inline)
+	if err != nil {
+		return nil, fmt.Errorf("invalid srtp keys: %w", err)
+	}
+	if len(buf) != p.keyLen+p.saltLen {
+		return nil, fmt.Errorf("srtp keys must be %d bytes long", p.keyLen+p.saltLen)
+	}
+	return &SRTPKeys{Profile: profile, MasterKey: buf[:p.keyLen], MasterSalt: buf[p.keyLen:]}, nil
+}
+
+// RTPSender sends an rtp stream to a UDP address, encrypted with SRTP if it has keys. The packets are
+// rewritten to the payload type of its session description.
+type RTPSender struct {
+	conn  *net.UDPConn
+	addr  *net.UDPAddr
+	codec webrtc.RTPCodecParameters
+	keys  *SRTPKeys
+	srtp  *srtp.Context
+	buf   []byte
+}
+
+// NewRTPSender creates a sender of codec to address, as host:port. keys can be nil to send plain rtp.
+func NewRTPSender(address string, codec webrtc.RTPCodecParameters, keys *SRTPKeys) (*RTPSender, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	s := &RTPSender{addr: addr, codec: codec}
+	if keys != nil {
+		name, profile, err := keys.protectionProfile()
+		if err != nil {
+			return nil, err
+		}
+		if s.srtp, err = srtp.CreateContext(keys.MasterKey, keys.MasterSalt, profile); err != nil {
+			return nil, err
+		}
+		s.keys = &SRTPKeys{Profile: name, MasterKey: keys.MasterKey, MasterSalt: keys.MasterSalt}
+	}
+	// the socket isn't connected so an unreachable receiver doesn't fail the writes.
+	if s.conn, err = net.ListenUDP("udp", nil); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SessionDescription describes the stream for the receiver, including the SRTP keys.
+func (s *RTPSender) SessionDescription() string {
+	host := s.addr.IP
+	if host == nil || host.IsUnspecified() {
+		host = net.IPv4(127, 0, 0, 1)
+	}
+	desc := av.NewSessionDescription(s.codec, host, s.addr.Port)
+	if s.keys != nil {
+		md := desc.MediaDescriptions[0]
+		md.MediaName.Protos = []string{"RTP", "SAVP"}
+		inline := base64.StdEncoding.EncodeToString(append(append([]byte{}, s.keys.MasterKey...), s.keys.MasterSalt...))
+		md.WithValueAttribute("crypto", fmt.Sprintf("1 %s inline:%s", s.keys.Profile, inline))
+	}
+	return desc.Marshal()
+}
+
+// WriteRTP sends a packet, it's not modified since the packets of an output are shared.
+func (s *RTPSender) WriteRTP(p *rtp.Packet) error {
+	pkt := *p
+	pkt.PayloadType = uint8(s.codec.PayloadType)
+	buf, err := pkt.Marshal()
+	if err != nil {
+		return err
+	}
+	if s.srtp != nil {
+		if s.buf, err = s.srtp.EncryptRTP(s.buf, buf, nil); err != nil {
+			return err
+		}
+		buf = s.buf
+	}
+	_, err = s.conn.WriteToUDP(buf, s.addr)
+	return err
+}
+
+// Close closes the socket.
+func (s *RTPSender) Close() error {
+	return s.conn.Close()
+}
+
+func (s *TranscoderServer) SubscribeRTP(request *api.SubscribeRTPRequest, stream api.Transcoder_SubscribeRTPServer) error {
+	if s.rtp == nil {
+		return status.Error(codes.PermissionDenied, "rtp subscribing is not enabled")
+	}
+	if request.Track == nil {
+		return status.Error(codes.InvalidArgument, "missing track")
+	}
+	if len(request.Track.Layers) > 0 {
+		return status.Error(codes.InvalidArgument, "simulcast is not supported over rtp")
+	}
+	if request.Track.MimeType != "" {
+		if _, err := lookupOutputCodec(request.Track.MimeType); err != nil {
+			return err
+		}
+	}
+	if _, err := net.ResolveUDPAddr("udp", request.Address); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid address: %v", err)
+	}
+	var keys *SRTPKeys
+	if request.Srtp != nil {
+		keys = &SRTPKeys{Profile: request.Srtp.Profile, MasterKey: request.Srtp.MasterKey, MasterSalt: request.Srtp.MasterSalt}
+		if _, _, err := keys.protectionProfile(); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	if !acquire(&s.subscribers, s.maxSubscribers) {
+		return status.Error(codes.ResourceExhausted, "too many subscribers")
+	}
+	defer atomic.AddInt64(&s.subscribers, -1)
+
+	ctx := stream.Context()
+	matched, err := s.waitForSource(ctx, request.Track)
+	if err != nil {
+		return err
+	}
+	outCodec, err := subscriberCodec(matched, request.Track)
+	if err != nil {
+		return err
+	}
+	sender, err := NewRTPSender(request.Address, outCodec, keys)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer sender.Close()
+
+	out, err := matched.output(outCodec.RTPCodecCapability, encoderConfiguration(request.Track), nil, nil)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to create transcoder: %v", err)
+	}
+	writers := []rtpio.RTPWriter{sender}
+	defer matched.release(out, writers)
+	if err := stream.Send(&api.SubscribeRTPResponse{Sdp: sender.SessionDescription()}); err != nil {
+		return err
+	}
+	out.addTrack(0, sender)
+	// the receiver can't ask for keyframes, so start with one.
+	out.forceKeyframe(0)
+
+	zap.L().Info("rtp subscriber started", zap.String("stream", matched.Track.StreamID()), zap.String("track", matched.Track.ID()), zap.String("address", request.Address))
+	select {
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-matched.done:
+		// the publisher left.
+		return nil
+	}
+}
@@ -0,0 +1,306 @@
+package transcoder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/muxable/transcoder/api"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ffmpegSDP is the sdp ffmpeg writes with -sdp_file for an rtp output of each stream.
+const ffmpegSDP = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=No Name\r\n" +
+	"t=0 0\r\n" +
+	"a=tool:libavformat 58.76.100\r\n" +
+	"m=video 5004 RTP/AVP 96\r\n" +
+	"c=IN IP4 127.0.0.1\r\n" +
+	"a=rtpmap:96 H264/90000\r\n" +
+	"a=fmtp:96 packetization-mode=1\r\n" +
+	"m=audio 5006 RTP/AVP 97\r\n" +
+	"c=IN IP4 127.0.0.1\r\n" +
+	"a=rtpmap:97 opus/48000/2\r\n"
+
+func TestRTPAnswer(t *testing.T) {
+	tests := []struct {
+		name  string
+		host  string
+		ports []uint32
+		want  string
+	}{
+		{
+			name:  "default host",
+			ports: []uint32{6000, 6002},
+			want: "v=0\r\n" +
+				"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+				"s=No Name\r\n" +
+				"c=IN IP4 127.0.0.1\r\n" +
+				"t=0 0\r\n" +
+				"a=tool:libavformat 58.76.100\r\n" +
+				"m=video 6000 RTP/AVP 96\r\n" +
+				"a=rtpmap:96 H264/90000\r\n" +
+				"a=fmtp:96 packetization-mode=1\r\n" +
+				"m=audio 6002 RTP/AVP 97\r\n" +
+				"a=rtpmap:97 opus/48000/2\r\n",
+		},
+		{
+			name:  "ipv6 host",
+			host:  "2001:db8::1",
+			ports: []uint32{6000, 6002},
+			want: "v=0\r\n" +
+				"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+				"s=No Name\r\n" +
+				"c=IN IP6 2001:db8::1\r\n" +
+				"t=0 0\r\n" +
+				"a=tool:libavformat 58.76.100\r\n" +
+				"m=video 6000 RTP/AVP 96\r\n" +
+				"a=rtpmap:96 H264/90000\r\n" +
+				"a=fmtp:96 packetization-mode=1\r\n" +
+				"m=audio 6002 RTP/AVP 97\r\n" +
+				"a=rtpmap:97 opus/48000/2\r\n",
+		},
+		{
+			// rejected sections have port zero.
+			name:  "rejected section",
+			host:  "203.0.113.1",
+			ports: []uint32{6000, 0},
+			want: "v=0\r\n" +
+				"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+				"s=No Name\r\n" +
+				"c=IN IP4 203.0.113.1\r\n" +
+				"t=0 0\r\n" +
+				"a=tool:libavformat 58.76.100\r\n" +
+				"m=video 6000 RTP/AVP 96\r\n" +
+				"a=rtpmap:96 H264/90000\r\n" +
+				"a=fmtp:96 packetization-mode=1\r\n" +
+				"m=audio 0 RTP/AVP 97\r\n" +
+				"a=rtpmap:97 opus/48000/2\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desc := &sdp.SessionDescription{}
+			if err := desc.Unmarshal([]byte(ffmpegSDP)); err != nil {
+				t.Fatal(err)
+			}
+			got, err := rtpAnswer(desc, tt.host, tt.ports)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got sdp\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublishRTPInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []ServerOption
+		// publishing is a stream id that is already publishing.
+		publishing string
+		request    *api.PublishRTPRequest
+		code       codes.Code
+	}{
+		{
+			name:    "not enabled",
+			request: &api.PublishRTPRequest{StreamId: "test", Sdp: ffmpegSDP},
+			code:    codes.PermissionDenied,
+		},
+		{
+			name:    "missing stream id",
+			options: []ServerOption{WithRTP(RTPConfiguration{})},
+			request: &api.PublishRTPRequest{Sdp: ffmpegSDP},
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "invalid sdp",
+			options: []ServerOption{WithRTP(RTPConfiguration{})},
+			request: &api.PublishRTPRequest{StreamId: "test", Sdp: "m=video"},
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "missing rtpmap",
+			options: []ServerOption{WithRTP(RTPConfiguration{})},
+			request: &api.PublishRTPRequest{
+				StreamId: "test",
+				Sdp:      "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\nm=video 5004 RTP/AVP 96\r\n",
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name:       "already publishing",
+			options:    []ServerOption{WithRTP(RTPConfiguration{})},
+			publishing: "test",
+			request:    &api.PublishRTPRequest{StreamId: "test", Sdp: ffmpegSDP},
+			code:       codes.AlreadyExists,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewTranscoderServer(webrtc.Configuration{}, tt.options...)
+			if tt.publishing != "" && !s.reserveStream(tt.publishing) {
+				t.Fatal("failed to reserve the stream")
+			}
+			// the request is rejected before anything is sent on the stream.
+			if err := s.PublishRTP(tt.request, nil); status.Code(err) != tt.code {
+				t.Errorf("expected %v, got %v", tt.code, err)
+			}
+		})
+	}
+}
+
+func TestRTPConfigurationListen(t *testing.T) {
+	tests := []struct {
+		name             string
+		portMin, portMax uint16
+		wantErr          bool
+	}{
+		{name: "ephemeral"},
+		{name: "range", portMin: 47000, portMax: 47009},
+		{name: "odd range", portMin: 47011, portMax: 47020},
+		{name: "single pair", portMin: 47022, portMax: 47023},
+		{name: "too small", portMin: 47025, portMax: 47026, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &RTPConfiguration{PortMin: tt.portMin, PortMax: tt.portMax}
+			rtpConn, rtcpConn, err := c.listen()
+			if tt.wantErr {
+				if err == nil {
+					rtpConn.Close()
+					rtcpConn.Close()
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rtpConn.Close()
+			defer rtcpConn.Close()
+
+			rtpPort, rtcpPort := rtpConn.LocalAddr().(*net.UDPAddr).Port, rtcpConn.LocalAddr().(*net.UDPAddr).Port
+			if rtpPort%2 != 0 || rtcpPort != rtpPort+1 {
+				t.Errorf("got ports %d and %d, want an even port and the next one", rtpPort, rtcpPort)
+			}
+			if tt.portMax > 0 && (rtpPort < int(tt.portMin) || rtcpPort > int(tt.portMax)) {
+				t.Errorf("got ports %d and %d, want ports in %d-%d", rtpPort, rtcpPort, tt.portMin, tt.portMax)
+			}
+		})
+	}
+}
+
+func TestRTPConfigurationListenExhausted(t *testing.T) {
+	c := &RTPConfiguration{PortMin: 47030, PortMax: 47031}
+	rtpConn, rtcpConn, err := c.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rtpConn.Close()
+	defer rtcpConn.Close()
+
+	if rtpConn, rtcpConn, err := c.listen(); err == nil {
+		rtpConn.Close()
+		rtcpConn.Close()
+		t.Error("expected the range to be exhausted")
+	}
+}
+
+func TestParseSRTPKeys(t *testing.T) {
+	// inline returns the base64 of a key of n bytes followed by a salt of m bytes.
+	inline := func(n, m int) string {
+		return base64.StdEncoding.EncodeToString(append(bytes.Repeat([]byte{1}, n), bytes.Repeat([]byte{2}, m)...))
+	}
+	tests := []struct {
+		name    string
+		profile string
+		inline  string
+		want    *SRTPKeys
+	}{
+		{
+			name:   "default profile",
+			inline: inline(16, 14),
+			want:   &SRTPKeys{Profile: "AES_CM_128_HMAC_SHA1_80", MasterKey: bytes.Repeat([]byte{1}, 16), MasterSalt: bytes.Repeat([]byte{2}, 14)},
+		},
+		{
+			name:    "sha1 32",
+			profile: "AES_CM_128_HMAC_SHA1_32",
+			inline:  inline(16, 14),
+			want:    &SRTPKeys{Profile: "AES_CM_128_HMAC_SHA1_32", MasterKey: bytes.Repeat([]byte{1}, 16), MasterSalt: bytes.Repeat([]byte{2}, 14)},
+		},
+		{
+			name:    "gcm",
+			profile: "AEAD_AES_128_GCM",
+			inline:  inline(16, 12),
+			want:    &SRTPKeys{Profile: "AEAD_AES_128_GCM", MasterKey: bytes.Repeat([]byte{1}, 16), MasterSalt: bytes.Repeat([]byte{2}, 12)},
+		},
+		{name: "unsupported profile", profile: "F8_128_HMAC_SHA1_80", inline: inline(16, 14)},
+		{name: "invalid base64", inline: "not base64!"},
+		{name: "too short", inline: inline(16, 12)},
+		{name: "too long", inline: inline(16, 15)},
+		{name: "gcm with a cm salt", profile: "AEAD_AES_128_GCM", inline: inline(16, 14)},
+		{name: "empty", inline: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSRTPKeys(tt.profile, tt.inline)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			// parsed keys are always valid for their profile.
+			if name, _, err := got.protectionProfile(); err != nil || name != tt.want.Profile {
+				t.Errorf("got profile %s and %v, want %s", name, err, tt.want.Profile)
+			}
+		})
+	}
+}
+
+func TestSRTPKeysProtectionProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    SRTPKeys
+		want    string
+		wantErr bool
+	}{
+		{name: "default profile", keys: SRTPKeys{MasterKey: make([]byte, 16), MasterSalt: make([]byte, 14)}, want: "AES_CM_128_HMAC_SHA1_80"},
+		{name: "gcm", keys: SRTPKeys{Profile: "AEAD_AES_128_GCM", MasterKey: make([]byte, 16), MasterSalt: make([]byte, 12)}, want: "AEAD_AES_128_GCM"},
+		{name: "unsupported profile", keys: SRTPKeys{Profile: "NULL_HMAC_SHA1_80", MasterKey: make([]byte, 16), MasterSalt: make([]byte, 14)}, wantErr: true},
+		{name: "short key", keys: SRTPKeys{MasterKey: make([]byte, 15), MasterSalt: make([]byte, 14)}, wantErr: true},
+		{name: "missing salt", keys: SRTPKeys{MasterKey: make([]byte, 16)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, _, err := tt.keys.protectionProfile()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != tt.want {
+				t.Errorf("got %s, want %s", name, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package transcoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/muxable/transcoder/pkg/av"
+)
+
+// rtspTimeout closes RTSP connections that stop sending, so the camera is reconnected to.
+const rtspTimeout = 10 * time.Second
+
+// RTSPSource is a stream pulled from an RTSP server, for example an IP camera.
+type RTSPSource struct {
+	// URL is the rtsp:// url of the stream, including the credentials if the server needs them.
+	URL string
+	// StreamID is the stream id its tracks are published with.
+	StreamID string
+	// Transport is how the media is received, tcp interleaves it in the RTSP connection and udp
+	// receives it on separate ports. It defaults to tcp, which works through NATs and doesn't lose
+	// packets.
+	Transport string
+}
+
+// IngestRTSP publishes the audio and video of an RTSP stream until the context is done, reconnecting
+// whenever the stream ends or the server is unreachable. The tracks are named video and audio, so they
+// can be subscribed to like any other track.
+func (s *TranscoderServer) IngestRTSP(ctx context.Context, source RTSPSource) error {
+	input, err := source.input()
+	if err != nil {
+		return err
+	}
+	return s.ingestLoop(ctx, input)
+}
+
+// input validates the source and returns the input that pulls it.
+func (source RTSPSource) input() (ingestInput, error) {
+	u, err := url.Parse(source.URL)
+	if err != nil {
+		return ingestInput{}, err
+	}
+	if u.Scheme != "rtsp" && u.Scheme != "rtsps" {
+		return ingestInput{}, fmt.Errorf("unsupported rtsp url scheme %s", u.Scheme)
+	}
+	if source.StreamID == "" {
+		return ingestInput{}, errors.New("missing rtsp stream id")
+	}
+	transport := source.Transport
+	switch transport {
+	case "":
+		transport = "tcp"
+	case "tcp", "udp":
+	default:
+		return ingestInput{}, fmt.Errorf("unsupported rtsp transport %s", transport)
+	}
+	return ingestInput{
+		url:    source.URL,
+		format: "rtsp",
+		options: map[string]string{
+			"rtsp_transport":       transport,
+			av.RTSPTimeoutOption(): fmt.Sprint(rtspTimeout.Microseconds()),
+		},
+		streamID: source.StreamID,
+	}, nil
+}
@@ -1,130 +1,331 @@
 package transcoder
 
 import (
+	"context"
 	"errors"
+	"io"
 	"log"
-	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/muxable/signal/pkg/signal"
 	"github.com/muxable/transcoder/api"
-	"github.com/muxable/transcoder/internal/av"
-	"github.com/muxable/transcoder/internal/codecs"
+	"github.com/muxable/transcoder/pkg/av"
+	"github.com/muxable/transcoder/pkg/codecs"
 	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
 	"github.com/pion/rtpio/pkg/rtpio"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-type Source struct {
-	*webrtc.PeerConnection
-	*webrtc.TrackRemote
-
-	sinks []rtpio.RTPWriteCloser
-}
-
-func (s *Source) addSink(sink rtpio.RTPWriteCloser) {
-	s.sinks = append(s.sinks, sink)
-	if len(s.sinks) == 1 {
-		go func() {
-			dial, _ := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127,0,0,1), Port: 5020})
-			for {
-				p, _, err := s.TrackRemote.ReadRTP()
-				if err != nil {
-					for _, sink := range s.sinks {
-						sink.Close()
-					}
-					return
-				}
-				buf, err := p.Marshal()
-				if err != nil {
-					zap.L().Error("failed to marshal rtp packet", zap.Error(err))
-				}
-				dial.Write(buf)
-				for _, sink := range s.sinks {
-					if err := sink.WriteRTP(p); err != nil {
-						zap.L().Error("failed to write rtp packet", zap.Error(err))
-					}
-				}
-			}
-		}()
-	}
-}
-
 type TranscoderServer struct {
 	api.UnimplementedTranscoderServer
 	config webrtc.Configuration
 
+	mu sync.Mutex
 	// the transcoding server likely cannot process a huge number of remote tracks
 	// so there's no need to optimize this.
 	sources []*Source
 
-	// this is like the poor man's rx behavior subject.
-	onTrack *sync.Cond
+	// onTrack is closed and replaced whenever a source is added, this is like the poor man's rx
+	// behavior subject.
+	onTrack chan struct{}
+
+	taps   []*Tap
+	tapRPC bool
+	// tapDir is where the Tap rpc writes pcap files, they're rejected if empty.
+	tapDir string
+
+	// recordingDir is where the Record rpc writes files, it's disabled if empty.
+	recordingDir string
+
+	// hls serves the tracks over HTTP, it's disabled if nil.
+	hls *HLSConfiguration
+	// hlsStarts are the origins of the timelines of the streams served over HLS, by stream id. They're
+	// guarded by mu and removed when the last track of the stream ends.
+	hlsStarts map[string]time.Time
+
+	// dash packages every published stream, it's disabled if nil.
+	dash        *DASHConfiguration
+	dashStreams map[string]*dashStream
+
+	// whip and whep publish and subscribe to tracks over HTTP, they're disabled if nil.
+	whip *WHIPConfiguration
+	whep *WHEPConfiguration
+	// sessions are the peer connections created over HTTP, keyed by their resource url.
+	sessions map[sessionKey]*webrtc.PeerConnection
+
+	// reservedStreams are the stream ids of the RTMP and plain RTP publishers, so an id can't be published
+	// twice.
+	reservedStreams map[string]bool
+
+	// srtPush enables the PushSRT rpc.
+	srtPush bool
+
+	// rtp receives plain rtp streams with the PublishRTP rpc, it's disabled if nil.
+	rtp *RTPConfiguration
+
+	settingEngine webrtc.SettingEngine
+
+	// the number of calls in progress and their limits, zero is unlimited.
+	publishers, subscribers       int64
+	maxPublishers, maxSubscribers int64
 }
 
-func NewTranscoderServer(config webrtc.Configuration) *TranscoderServer {
-	return &TranscoderServer{
-		config:      config,
-		onTrack:     sync.NewCond(&sync.Mutex{}),
+type ServerOption func(*TranscoderServer)
+
+// WithTap mirrors the packets of the matching tracks, see AddTap.
+func WithTap(tap *Tap) ServerOption {
+	return func(s *TranscoderServer) {
+		s.taps = append(s.taps, tap)
 	}
 }
 
-func (s *TranscoderServer) Publish(conn api.Transcoder_PublishServer) error {
+// WithTapRPC enables the Tap rpc. It should only be enabled for trusted clients as it exposes the media
+// of every track.
+func WithTapRPC() ServerOption {
+	return func(s *TranscoderServer) {
+		s.tapRPC = true
+	}
+}
+
+// WithTapDirectory lets the Tap rpc write pcap files to dir, paths in requests are relative to it.
+func WithTapDirectory(dir string) ServerOption {
+	return func(s *TranscoderServer) {
+		s.tapDir = dir
+	}
+}
+
+// WithSettingEngine configures the peer connections, for example to restrict the UDP port range or
+// set the NAT 1:1 IPs.
+func WithSettingEngine(settingEngine webrtc.SettingEngine) ServerOption {
+	return func(s *TranscoderServer) {
+		s.settingEngine = settingEngine
+	}
+}
+
+// WithMaxPublishers limits the number of concurrent Publish calls.
+func WithMaxPublishers(n int) ServerOption {
+	return func(s *TranscoderServer) {
+		s.maxPublishers = int64(n)
+	}
+}
+
+// WithMaxSubscribers limits the number of concurrent Subscribe calls.
+func WithMaxSubscribers(n int) ServerOption {
+	return func(s *TranscoderServer) {
+		s.maxSubscribers = int64(n)
+	}
+}
+
+// acquire increments a call counter, returning false if the limit is reached.
+func acquire(n *int64, max int64) bool {
+	if atomic.AddInt64(n, 1) > max && max > 0 {
+		atomic.AddInt64(n, -1)
+		return false
+	}
+	return true
+}
+
+func (s *TranscoderServer) newAPI(m *webrtc.MediaEngine, i *interceptor.Registry) *webrtc.API {
+	return webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(i), webrtc.WithSettingEngine(s.settingEngine))
+}
+
+func NewTranscoderServer(config webrtc.Configuration, options ...ServerOption) *TranscoderServer {
+	s := &TranscoderServer{
+		config:  config,
+		onTrack: make(chan struct{}),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// reserveStream reserves a stream id for a publisher until releaseStream is called, it returns false if
+// the id is already reserved or has a source.
+func (s *TranscoderServer) reserveStream(streamID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reservedStreams[streamID] {
+		return false
+	}
+	for _, source := range s.sources {
+		if source.StreamID() == streamID {
+			return false
+		}
+	}
+	if s.reservedStreams == nil {
+		s.reservedStreams = make(map[string]bool)
+	}
+	s.reservedStreams[streamID] = true
+	return true
+}
+
+// releaseStream releases a stream id reserved by reserveStream.
+func (s *TranscoderServer) releaseStream(streamID string) {
+	s.mu.Lock()
+	delete(s.reservedStreams, streamID)
+	s.mu.Unlock()
+}
+
+// addSource registers a source until its track ends.
+func (s *TranscoderServer) addSource(source *Source) {
+	s.mu.Lock()
+	for _, tap := range s.taps {
+		if tap.matches(source.Track) {
+			source.addTap(tap)
+		}
+	}
+	s.sources = append(s.sources, source)
+	close(s.onTrack)
+	s.onTrack = make(chan struct{})
+	s.mu.Unlock()
+
+	if s.dash != nil && source.Track.RID() == "" {
+		s.packageDASH(source)
+	}
+
+	go func() {
+		source.run()
+		s.removeSource(source)
+	}()
+}
+
+func (s *TranscoderServer) removeSource(source *Source) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, x := range s.sources {
+		if x == source {
+			s.sources = append(s.sources[:i], s.sources[i+1:]...)
+			break
+		}
+	}
+	streamID := source.Track.StreamID()
+	for _, x := range s.sources {
+		if x.Track.StreamID() == streamID {
+			return
+		}
+	}
+	delete(s.hlsStarts, streamID)
+}
+
+// waitForSource returns the source that matches the request, waiting for it to be published if
+// necessary. It returns an error if the context is done first.
+func (s *TranscoderServer) waitForSource(ctx context.Context, request *api.TranscodeRequest) (*Source, error) {
+	for {
+		s.mu.Lock()
+		for _, source := range s.sources {
+			tr := source.Track
+			if tr.StreamID() == request.StreamId && tr.ID() == request.TrackId && tr.RID() == request.RtpStreamId {
+				s.mu.Unlock()
+				return source, nil
+			}
+		}
+		onTrack := s.onTrack
+		s.mu.Unlock()
+
+		select {
+		case <-onTrack:
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// newPublisher creates a peer connection that accepts tracks of every codec and registers them as
+// sources until they end.
+func (s *TranscoderServer) newPublisher() (*webrtc.PeerConnection, error) {
 	m := &webrtc.MediaEngine{}
 
 	// signal that we accept all the codecs.
 	for _, codec := range codecs.DefaultOutputCodecs {
 		if strings.HasPrefix(codec.MimeType, "video/") {
 			if err := m.RegisterCodec(codec, webrtc.RTPCodecTypeVideo); err != nil {
-				return err
+				return nil, err
 			}
 		} else if strings.HasPrefix(codec.MimeType, "audio/") {
 			if err := m.RegisterCodec(codec, webrtc.RTPCodecTypeAudio); err != nil {
-				return err
+				return nil, err
 			}
 		}
 	}
 
 	i := &interceptor.Registry{}
 	if err := webrtc.RegisterDefaultInterceptors(m, i); err != nil {
-		return err
+		return nil, err
 	}
 
-	peerConnection, err := webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(i)).NewPeerConnection(s.config)
+	peerConnection, err := s.newAPI(m, i).NewPeerConnection(s.config)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	signaller := signal.Negotiate(peerConnection)
-
 	peerConnection.OnTrack(func(tr *webrtc.TrackRemote, r *webrtc.RTPReceiver) {
+		source := NewSource(peerConnection, tr)
+
+		// sender reports are used to synchronize the tracks of a recording.
 		go func() {
-			buf := make([]byte, 1500)
 			for {
-				if _, _, err := r.Read(buf); err != nil {
+				var pkts []rtcp.Packet
+				var err error
+				if tr.RID() == "" {
+					pkts, _, err = r.ReadRTCP()
+				} else {
+					pkts, _, err = r.ReadSimulcastRTCP(tr.RID())
+				}
+				if err != nil {
 					return
 				}
+				for _, pkt := range pkts {
+					if sr, ok := pkt.(*rtcp.SenderReport); ok && sr.SSRC == uint32(tr.SSRC()) {
+						source.senderReport(sr)
+					}
+				}
 			}
 		}()
 
-		source := &Source{
-			PeerConnection: peerConnection,
-			TrackRemote:    tr,
-		}
+		s.addSource(source)
+	})
 
-		s.onTrack.L.Lock()
-		s.sources = append(s.sources, source)
-		s.onTrack.Broadcast()
-		s.onTrack.L.Unlock()
+	return peerConnection, nil
+}
+
+func (s *TranscoderServer) Publish(conn api.Transcoder_PublishServer) error {
+	if !acquire(&s.publishers, s.maxPublishers) {
+		return status.Error(codes.ResourceExhausted, "too many publishers")
+	}
+	defer atomic.AddInt64(&s.publishers, -1)
+
+	peerConnection, err := s.newPublisher()
+	if err != nil {
+		return err
+	}
+
+	// closing the peer connection ends its tracks, which removes their sources.
+	defer peerConnection.Close()
+
+	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed {
+			peerConnection.Close()
+		}
 	})
 
+	signaller := negotiate(peerConnection)
+	defer signaller.Close()
+
 	go func() {
 		for {
 			signal, err := signaller.ReadSignal()
 			if err != nil {
-				zap.L().Error("failed to read signal", zap.Error(err))
+				if err != io.EOF {
+					zap.L().Error("failed to read signal", zap.Error(err))
+				}
 				return
 			}
 			if err := conn.Send(signal); err != nil {
@@ -148,97 +349,293 @@ func (s *TranscoderServer) Publish(conn api.Transcoder_PublishServer) error {
 	}
 }
 
-func (s *TranscoderServer) Subscribe(conn api.Transcoder_SubscribeServer) error {
-	request, err := conn.Recv()
-	if err != nil {
-		return err
+// defaultOutputMimeTypes are the codecs a track is transcoded to when the request doesn't specify one.
+var defaultOutputMimeTypes = map[webrtc.RTPCodecType]string{
+	webrtc.RTPCodecTypeVideo: webrtc.MimeTypeH264,
+	webrtc.RTPCodecTypeAudio: webrtc.MimeTypeOpus,
+}
+
+// lookupOutputCodec finds the codec parameters to publish for a requested mime type.
+func lookupOutputCodec(mimeType string) (webrtc.RTPCodecParameters, error) {
+	for key, codec := range codecs.DefaultOutputCodecs {
+		if !strings.EqualFold(key, mimeType) {
+			continue
+		}
+		if _, ok := av.AvCodec[codec.MimeType]; !ok {
+			return webrtc.RTPCodecParameters{}, status.Errorf(codes.Unimplemented, "transcoding to %s is not supported", codec.MimeType)
+		}
+		return codec, nil
 	}
+	return webrtc.RTPCodecParameters{}, status.Errorf(codes.InvalidArgument, "unknown mime type %q", mimeType)
+}
 
-	op, ok := request.Operation.(*api.SubscribeRequest_Request)
-	if !ok {
-		return errors.New("unexpected signal")
+// encoderConfiguration extracts the encoder parameters from a request.
+func encoderConfiguration(request *api.TranscodeRequest) av.EncoderConfiguration {
+	return av.EncoderConfiguration{
+		Bitrate:          int64(request.Bitrate),
+		MaxBitrate:       int64(request.MaxBitrate),
+		Width:            int(request.Width),
+		Height:           int(request.Height),
+		ScaleMode:        av.ScaleMode(request.ScaleMode),
+		Framerate:        request.Framerate,
+		KeyframeInterval: int(request.KeyframeInterval),
+		Profile:          request.Profile,
 	}
+}
 
-	var matched *Source
-	for matched == nil {
-		s.onTrack.L.Lock()
-		// find the track that matches the request.
-		for i, source := range s.sources {
-			tr := source.TrackRemote
-			if tr.StreamID() == op.Request.StreamId && tr.ID() == op.Request.TrackId && tr.RID() == op.Request.RtpStreamId {
-				matched = source
-				s.sources = append(s.sources[:i], s.sources[i+1:]...)
-				break
-			}
+// layerConfigurations applies the overrides of each simulcast layer to the base encoder parameters.
+func layerConfigurations(base av.EncoderConfiguration, layers []*api.SimulcastLayer) ([]av.EncoderConfiguration, error) {
+	configs := make([]av.EncoderConfiguration, len(layers))
+	rids := make(map[string]bool)
+	for i, layer := range layers {
+		if layer.Rid == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "simulcast layer %d has no rid", i)
+		}
+		if rids[layer.Rid] {
+			return nil, status.Errorf(codes.InvalidArgument, "duplicate simulcast rid %q", layer.Rid)
 		}
+		rids[layer.Rid] = true
 
-		if matched == nil {
-			s.onTrack.Wait()
+		config := base
+		if layer.Width > 0 || layer.Height > 0 {
+			config.Width = int(layer.Width)
+			config.Height = int(layer.Height)
+		}
+		if layer.Bitrate > 0 {
+			config.Bitrate = int64(layer.Bitrate)
+		}
+		if layer.MaxBitrate > 0 {
+			config.MaxBitrate = int64(layer.MaxBitrate)
 		}
-		s.onTrack.L.Unlock()
+		if layer.Framerate > 0 {
+			config.Framerate = layer.Framerate
+		}
+		configs[i] = config
 	}
+	return configs, nil
+}
 
-	inCodec := matched.TrackRemote.Codec()
-
-	tc, err := av.NewTranscoder(inCodec, webrtc.RTPCodecCapability{})
+// subscriberCodec returns the codec a track is transcoded to for a subscriber, the requested one or the
+// default for its kind.
+func subscriberCodec(matched *Source, request *api.TranscodeRequest) (webrtc.RTPCodecParameters, error) {
+	mimeType := request.MimeType
+	if mimeType == "" {
+		mimeType = defaultOutputMimeTypes[matched.Track.Kind()]
+	}
+	outCodec, err := lookupOutputCodec(mimeType)
 	if err != nil {
-		return err
+		return webrtc.RTPCodecParameters{}, err
+	}
+	if !strings.HasPrefix(outCodec.MimeType, matched.Track.Kind().String()+"/") {
+		return webrtc.RTPCodecParameters{}, status.Errorf(codes.InvalidArgument, "cannot transcode %s track to %s", matched.Track.Kind(), outCodec.MimeType)
+	}
+	return outCodec, nil
+}
+
+// subscriber is a peer connection that sends a transcoded track.
+type subscriber struct {
+	*webrtc.PeerConnection
+	source *Source
+	// cleanup releases the transcoder and closes the peer connection, in reverse order.
+	cleanup []func()
+}
+
+func (sub *subscriber) Close() {
+	for i := len(sub.cleanup) - 1; i >= 0; i-- {
+		sub.cleanup[i]()
 	}
+}
 
-	matched.addSink(tc)
+// newSubscriber waits for the requested track and creates a peer connection that sends it transcoded.
+// The caller negotiates the connection and must close the subscriber when it's done.
+func (s *TranscoderServer) newSubscriber(ctx context.Context, request *api.TranscodeRequest) (_ *subscriber, err error) {
+	sub := &subscriber{}
+	defer func() {
+		if err != nil {
+			sub.Close()
+		}
+	}()
 
-	outCodec := &webrtc.RTPCodecParameters{
-		PayloadType: webrtc.PayloadType(96),
-		RTPCodecCapability: webrtc.RTPCodecCapability{
-			MimeType: webrtc.MimeTypeH264,
-			ClockRate: 90000,
-		},
+	// validate the requested codec before waiting for the track so bad requests fail fast.
+	if request.MimeType != "" {
+		if _, err := lookupOutputCodec(request.MimeType); err != nil {
+			return nil, err
+		}
 	}
 
-	tl, err := webrtc.NewTrackLocalStaticRTP(outCodec.RTPCodecCapability, matched.TrackRemote.ID(), matched.TrackRemote.StreamID())
+	matched, err := s.waitForSource(ctx, request)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	go rtpio.CopyRTP(tl, tc)
+	outCodec, err := subscriberCodec(matched, request)
+	if err != nil {
+		return nil, err
+	}
+
+	config := encoderConfiguration(request)
+	id, streamID := matched.Track.ID(), matched.Track.StreamID()
+
+	var out *output
+	var tracks []webrtc.TrackLocal
+	var writers []rtpio.RTPWriter
+	if len(request.Layers) == 0 {
+		out, err = matched.output(outCodec.RTPCodecCapability, config, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		sub.cleanup = append(sub.cleanup, func() { matched.release(out, writers) })
+
+		tl, err := webrtc.NewTrackLocalStaticRTP(outCodec.RTPCodecCapability, id, streamID)
+		if err != nil {
+			return nil, err
+		}
+
+		tracks = append(tracks, tl)
+		writers = append(writers, tl)
+	} else {
+		if matched.Track.Kind() != webrtc.RTPCodecTypeVideo {
+			return nil, status.Errorf(codes.InvalidArgument, "simulcast is only supported for video tracks")
+		}
+
+		configs, err := layerConfigurations(config, request.Layers)
+		if err != nil {
+			return nil, err
+		}
+
+		rids := make([]string, len(request.Layers))
+		for i, layer := range request.Layers {
+			rids[i] = layer.Rid
+		}
+
+		out, err = matched.output(outCodec.RTPCodecCapability, config, configs, rids)
+		if err != nil {
+			return nil, err
+		}
+		sub.cleanup = append(sub.cleanup, func() { matched.release(out, writers) })
+
+		for _, rid := range rids {
+			tl, err := newRIDTrack(outCodec.RTPCodecCapability, id, streamID, rid)
+			if err != nil {
+				return nil, err
+			}
+
+			tracks = append(tracks, tl)
+			writers = append(writers, tl)
+		}
+	}
 
 	m := &webrtc.MediaEngine{}
 
-	if err := m.RegisterCodec(*outCodec, matched.TrackRemote.Kind()); err != nil {
-		return err
+	if err := m.RegisterCodec(outCodec, matched.Track.Kind()); err != nil {
+		return nil, err
+	}
+
+	if len(tracks) > 1 {
+		// receivers use these to demultiplex the simulcast layers.
+		for _, uri := range []string{sdp.SDESMidURI, sdp.SDESRTPStreamIDURI} {
+			if err := m.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: uri}, webrtc.RTPCodecTypeVideo); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	i := &interceptor.Registry{}
 	if err := webrtc.RegisterDefaultInterceptors(m, i); err != nil {
-		return err
+		return nil, err
+	}
+
+	// only single video tracks adapt, simulcast layers keep their configured bitrates.
+	var estimate *bitrateEstimate
+	if out.bitrate != nil {
+		estimate = out.bitrate.newEstimate()
+		sub.cleanup = append(sub.cleanup, estimate.remove)
+		if err := estimate.registerInterceptors(m, i, config); err != nil {
+			return nil, err
+		}
 	}
 
-	peerConnection, err := webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(i)).NewPeerConnection(s.config)
+	peerConnection, err := s.newAPI(m, i).NewPeerConnection(s.config)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	sub.cleanup = append(sub.cleanup, func() { peerConnection.Close() })
 
-	rtpSender, err := peerConnection.AddTrack(tl)
+	rtpSender, err := peerConnection.AddTrack(tracks[0])
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	go func() {
-		buf := make([]byte, 1500)
-		for {
-			if _, _, err := rtpSender.Read(buf); err != nil {
-				return
-			}
+	for _, tl := range tracks[1:] {
+		if err := rtpSender.AddEncoding(tl); err != nil {
+			return nil, err
 		}
-	}()
+	}
+
+	for i, tl := range tracks {
+		go func(i int, rid string) {
+			for {
+				pkts, _, err := rtpSender.ReadSimulcastRTCP(rid)
+				if err != nil {
+					return
+				}
+				for _, pkt := range pkts {
+					switch pkt.(type) {
+					case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+						out.forceKeyframe(i)
+					}
+				}
+				if estimate != nil {
+					estimate.handleRTCP(pkts)
+				}
+			}
+		}(i, tl.RID())
+	}
+
+	for i, w := range writers {
+		out.addTrack(i, w)
+	}
+
+	sub.PeerConnection = peerConnection
+	sub.source = matched
+	return sub, nil
+}
 
-	signaller := signal.Negotiate(peerConnection)
+func (s *TranscoderServer) Subscribe(conn api.Transcoder_SubscribeServer) error {
+	if !acquire(&s.subscribers, s.maxSubscribers) {
+		return status.Error(codes.ResourceExhausted, "too many subscribers")
+	}
+	defer atomic.AddInt64(&s.subscribers, -1)
+
+	request, err := conn.Recv()
+	if err != nil {
+		return err
+	}
+
+	op, ok := request.Operation.(*api.SubscribeRequest_Request)
+	if !ok {
+		return errors.New("unexpected signal")
+	}
+
+	// the client can bound the wait with a deadline on the call.
+	ctx := conn.Context()
+	sub, err := s.newSubscriber(ctx, op.Request)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+	peerConnection, matched := sub.PeerConnection, sub.source
+
+	signaller := negotiate(peerConnection)
+	defer signaller.Close()
 
 	go func() {
 		for {
 			signal, err := signaller.ReadSignal()
 			if err != nil {
-				zap.L().Error("failed to read signal", zap.Error(err))
+				if err != io.EOF {
+					zap.L().Error("failed to read signal", zap.Error(err))
+				}
 				return
 			}
 
@@ -251,21 +648,40 @@ func (s *TranscoderServer) Subscribe(conn api.Transcoder_SubscribeServer) error
 		}
 	}()
 
-	for {
-		signal, err := conn.Recv()
-		if err != nil {
-			return err
-		}
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			signal, err := conn.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
 
-		log.Printf("received %v", signal)
+			log.Printf("received %v", signal)
 
-		switch signal := signal.Operation.(type) {
-		case *api.SubscribeRequest_Signal:
-			if err := signaller.WriteSignal(signal.Signal); err != nil {
-				return err
+			switch signal := signal.Operation.(type) {
+			case *api.SubscribeRequest_Signal:
+				if err := signaller.WriteSignal(signal.Signal); err != nil {
+					errs <- err
+					return
+				}
+			case *api.SubscribeRequest_Request:
+				errs <- errors.New("unexpected request")
+				return
 			}
-		case *api.SubscribeRequest_Request:
-			return errors.New("unexpected request")
 		}
+	}()
+
+	select {
+	case err := <-errs:
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-matched.done:
+		// the publisher left.
+		return nil
 	}
 }
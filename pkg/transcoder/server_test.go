@@ -0,0 +1,231 @@
+package transcoder
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/muxable/transcoder/api"
+	"github.com/muxable/transcoder/pkg/av"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestSubscribeWithoutTrack(t *testing.T) {
+	tests := []struct {
+		name string
+		// end ends the call before the track is published.
+		end  func(cancel context.CancelFunc)
+		code codes.Code
+	}{
+		{name: "deadline", end: func(context.CancelFunc) {}, code: codes.DeadlineExceeded},
+		{name: "cancel", end: func(cancel context.CancelFunc) { cancel() }, code: codes.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer goleak.VerifyNone(t)
+
+			lis := bufconn.Listen(1 << 20)
+			server := grpc.NewServer()
+			api.RegisterTranscoderServer(server, NewTranscoderServer(webrtc.Configuration{}))
+			go server.Serve(lis)
+			defer server.Stop()
+
+			conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+				return lis.Dial()
+			}))
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			stream, err := api.NewTranscoderClient(conn).Subscribe(ctx)
+			if err != nil {
+				t.Fatalf("failed to subscribe: %v", err)
+			}
+			if err := stream.Send(&api.SubscribeRequest{
+				Operation: &api.SubscribeRequest_Request{
+					Request: &api.TranscodeRequest{StreamId: "missing", TrackId: "missing"},
+				},
+			}); err != nil {
+				t.Fatalf("failed to send request: %v", err)
+			}
+
+			tt.end(cancel)
+
+			if _, err := stream.Recv(); status.Code(err) != tt.code {
+				t.Errorf("expected %v, got %v", tt.code, err)
+			}
+		})
+	}
+}
+
+// testTrack is a published track that sends the packets written to it until it's closed.
+type testTrack struct {
+	packets chan *rtp.Packet
+}
+
+func (t *testTrack) ID() string                { return "audio" }
+func (t *testTrack) StreamID() string          { return "test" }
+func (t *testTrack) RID() string               { return "" }
+func (t *testTrack) Kind() webrtc.RTPCodecType { return webrtc.RTPCodecTypeAudio }
+
+func (t *testTrack) Codec() webrtc.RTPCodecParameters {
+	return webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2},
+		PayloadType:        111,
+	}
+}
+
+func (t *testTrack) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
+	p, ok := <-t.packets
+	if !ok {
+		return nil, nil, io.EOF
+	}
+	return p, nil, nil
+}
+
+// fileTrack is a published video track that sends test/input.ivf as VP8 in real time, like a live
+// publisher.
+type fileTrack struct {
+	streamID string
+	tc       *av.Transcoder
+
+	// start is when the first packet was sent, base is its timestamp.
+	start time.Time
+	base  uint32
+}
+
+func newFileTrack(t *testing.T, streamID string) *fileTrack {
+	tc, err := av.NewFileTranscoder("../../test/input.ivf", webrtc.RTPCodecTypeVideo, webrtc.RTPCodecCapability{
+		MimeType:  webrtc.MimeTypeVP8,
+		ClockRate: 90000,
+	}, av.EncoderConfiguration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tc.Close() })
+	return &fileTrack{streamID: streamID, tc: tc}
+}
+
+func (t *fileTrack) ID() string                { return "video" }
+func (t *fileTrack) StreamID() string          { return t.streamID }
+func (t *fileTrack) RID() string               { return "" }
+func (t *fileTrack) Kind() webrtc.RTPCodecType { return webrtc.RTPCodecTypeVideo }
+
+func (t *fileTrack) Codec() webrtc.RTPCodecParameters {
+	return webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		PayloadType:        96,
+	}
+}
+
+func (t *fileTrack) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
+	p, err := t.tc.ReadRTP()
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.start.IsZero() {
+		t.start, t.base = time.Now(), p.Timestamp
+	}
+	time.Sleep(time.Until(t.start.Add(time.Duration(p.Timestamp-t.base) * time.Second / 90000)))
+	return p, nil, nil
+}
+
+// testSink receives the packets of a source, dropping them if they aren't read.
+type testSink struct {
+	packets chan *rtp.Packet
+}
+
+func newTestSink() *testSink {
+	return &testSink{packets: make(chan *rtp.Packet, 1)}
+}
+
+func (s *testSink) WriteRTP(p *rtp.Packet) error {
+	select {
+	case s.packets <- p:
+	default:
+	}
+	return nil
+}
+
+func (s *testSink) Close() error { return nil }
+
+func TestSubscribeUntilPublisherEnds(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	s := NewTranscoderServer(webrtc.Configuration{})
+	api.RegisterTranscoderServer(server, s)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	track := &testTrack{packets: make(chan *rtp.Packet)}
+	s.addSource(newSource(track, nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := api.NewTranscoderClient(conn).Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if err := stream.Send(&api.SubscribeRequest{
+		Operation: &api.SubscribeRequest_Request{
+			Request: &api.TranscodeRequest{StreamId: "test", TrackId: "audio"},
+		},
+	}); err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+
+	// the server sends its offer once the subscription is set up.
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("failed to receive signal: %v", err)
+	}
+
+	close(track.packets)
+
+	// the call ends without an error when the publisher leaves.
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("expected the call to end, got %v", err)
+		}
+	}
+
+	// the source is removed after its subscribers are notified.
+	for {
+		s.mu.Lock()
+		n := len(s.sources)
+		s.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected the source to be removed, got %d sources", n)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package transcoder
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/muxable/signal/api"
+	"github.com/pion/webrtc/v3"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// signaller negotiates a peer connection like signal.Negotiate, but it can be closed so that nothing
+// waits on a call that has ended.
+type signaller struct {
+	pc     *webrtc.PeerConnection
+	readCh chan *api.Signal
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// negotiate sends an offer whenever the peer connection needs to be negotiated, and trickles its ICE
+// candidates. The signaller must be closed when the call ends.
+func negotiate(pc *webrtc.PeerConnection) *signaller {
+	s := &signaller{
+		pc:     pc,
+		readCh: make(chan *api.Signal),
+		done:   make(chan struct{}),
+	}
+	pc.OnNegotiationNeeded(func() {
+		offer, err := pc.CreateOffer(nil)
+		if err != nil {
+			return
+		}
+		if err := pc.SetLocalDescription(offer); err != nil {
+			return
+		}
+		s.send(&api.Signal{Payload: &api.Signal_OfferSdp{OfferSdp: offer.SDP}})
+	})
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		trickle, err := json.Marshal(candidate.ToJSON())
+		if err != nil {
+			return
+		}
+		s.send(&api.Signal{Payload: &api.Signal_Trickle{Trickle: string(trickle)}})
+	})
+	return s
+}
+
+// send queues a signal for ReadSignal, it's dropped if the signaller is closed.
+func (s *signaller) send(signal *api.Signal) {
+	select {
+	case s.readCh <- signal:
+	case <-s.done:
+	}
+}
+
+// ReadSignal returns the next signal to send to the remote peer, or io.EOF once the signaller is closed.
+func (s *signaller) ReadSignal() (*anypb.Any, error) {
+	select {
+	case signal := <-s.readCh:
+		return anypb.New(signal)
+	case <-s.done:
+		return nil, io.EOF
+	}
+}
+
+// WriteSignal applies a signal received from the remote peer.
+func (s *signaller) WriteSignal(any *anypb.Any) error {
+	signal := &api.Signal{}
+	if err := any.UnmarshalTo(signal); err != nil {
+		return err
+	}
+	switch payload := signal.Payload.(type) {
+	case *api.Signal_OfferSdp:
+		if err := s.pc.SetRemoteDescription(webrtc.SessionDescription{
+			SDP:  payload.OfferSdp,
+			Type: webrtc.SDPTypeOffer,
+		}); err != nil {
+			return err
+		}
+		answer, err := s.pc.CreateAnswer(nil)
+		if err != nil {
+			return err
+		}
+		if err := s.pc.SetLocalDescription(answer); err != nil {
+			return err
+		}
+		s.send(&api.Signal{Payload: &api.Signal_AnswerSdp{AnswerSdp: answer.SDP}})
+	case *api.Signal_AnswerSdp:
+		return s.pc.SetRemoteDescription(webrtc.SessionDescription{
+			SDP:  payload.AnswerSdp,
+			Type: webrtc.SDPTypeAnswer,
+		})
+	case *api.Signal_Trickle:
+		candidate := webrtc.ICECandidateInit{}
+		if err := json.Unmarshal([]byte(payload.Trickle), &candidate); err != nil {
+			return err
+		}
+		return s.pc.AddICECandidate(candidate)
+	}
+	return nil
+}
+
+// Close ends ReadSignal and drops any signals that are still pending.
+func (s *signaller) Close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
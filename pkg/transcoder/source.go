@@ -0,0 +1,355 @@
+package transcoder
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/muxable/transcoder/api"
+	"github.com/muxable/transcoder/pkg/av"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/rtpio/pkg/rtpio"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// Track is the media of a Source. It's implemented by *webrtc.TrackRemote for WebRTC publishers, other
+// ingests packetize their media to rtp.
+type Track interface {
+	ID() string
+	StreamID() string
+	RID() string
+	Kind() webrtc.RTPCodecType
+	Codec() webrtc.RTPCodecParameters
+	ReadRTP() (*rtp.Packet, interceptor.Attributes, error)
+}
+
+// Source is a published track. It lives until the track ends, usually because the publisher's
+// PeerConnection was closed.
+type Source struct {
+	Track
+
+	// pli asks the publisher for a keyframe, it's nil if the publisher can't be asked.
+	pli func() error
+
+	sinksMu sync.Mutex
+	sinks   []rtpio.RTPWriteCloser
+	// report is the latest sender report of the track.
+	report *rtcp.SenderReport
+
+	tapsMu sync.Mutex
+	taps   []*Tap
+
+	keyframeMu sync.Mutex
+	keyframeAt time.Time
+
+	// the track is decoded once for every subscriber and packaged output, and each distinct output is
+	// encoded once. decoderUsers counts the outputs reading from the decoder.
+	outputsMu    sync.Mutex
+	decoder      *av.SharedDecoder
+	decoderUsers int
+	outputs      map[string]*output
+	// cmaf is the track packaged for HTTP clients, it's nil until one requests it.
+	cmaf *cmafTrack
+
+	// done is closed when the track ends.
+	done chan struct{}
+}
+
+// output is an encoded rendition of a source that's shared by every subscriber that requests it.
+type output struct {
+	source      *Source
+	key         string
+	transcoder  io.Closer
+	subscribers int
+
+	mu sync.Mutex
+	// tracks are the subscriber tracks for each layer.
+	tracks [][]rtpio.RTPWriter
+
+	forceKeyframe func(layer int)
+	// bitrate is nil if the output doesn't adapt to the subscribers' bandwidth.
+	bitrate *bitrateController
+}
+
+func NewSource(pc *webrtc.PeerConnection, tr *webrtc.TrackRemote) *Source {
+	return newSource(tr, func() error {
+		return pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(tr.SSRC())}})
+	})
+}
+
+func newSource(track Track, pli func() error) *Source {
+	return &Source{
+		Track: track,
+		pli:   pli,
+		done:  make(chan struct{}),
+	}
+}
+
+// keyframeRequestInterval limits how often a keyframe is requested from the publisher.
+const keyframeRequestInterval = 500 * time.Millisecond
+
+// requestKeyframe sends a PLI to the publisher of the track.
+func (s *Source) requestKeyframe() {
+	if s.pli == nil {
+		return
+	}
+	s.keyframeMu.Lock()
+	if time.Since(s.keyframeAt) < keyframeRequestInterval {
+		s.keyframeMu.Unlock()
+		return
+	}
+	s.keyframeAt = time.Now()
+	s.keyframeMu.Unlock()
+
+	if err := s.pli(); err != nil {
+		zap.L().Error("failed to send pli", zap.Error(err))
+	}
+}
+
+// run forwards the track to the sinks until the track ends, then closes the sinks.
+func (s *Source) run() {
+	defer close(s.done)
+	for {
+		p, _, err := s.Track.ReadRTP()
+		if err != nil {
+			s.sinksMu.Lock()
+			for _, sink := range s.sinks {
+				sink.Close()
+			}
+			s.sinks = nil
+			s.sinksMu.Unlock()
+			return
+		}
+		s.tap(p, api.TapDirection_INPUT)
+		s.sinksMu.Lock()
+		for _, sink := range s.sinks {
+			if err := sink.WriteRTP(p); err != nil {
+				zap.L().Error("failed to write rtp packet", zap.Error(err))
+			}
+		}
+		s.sinksMu.Unlock()
+	}
+}
+
+func (s *Source) addTap(tap *Tap) {
+	s.tapsMu.Lock()
+	defer s.tapsMu.Unlock()
+	s.taps = append(s.taps, tap)
+}
+
+func (s *Source) removeTap(tap *Tap) {
+	s.tapsMu.Lock()
+	defer s.tapsMu.Unlock()
+	for i, t := range s.taps {
+		if t == tap {
+			s.taps = append(s.taps[:i], s.taps[i+1:]...)
+			return
+		}
+	}
+}
+
+// tap mirrors a packet to the taps of the source.
+func (s *Source) tap(p *rtp.Packet, direction api.TapDirection) {
+	s.tapsMu.Lock()
+	defer s.tapsMu.Unlock()
+	for _, t := range s.taps {
+		t.write(p, direction)
+	}
+}
+
+// senderReportWriter is a sink that synchronizes the track with other tracks, see
+// (*av.RecorderInput).WriteSenderReport.
+type senderReportWriter interface {
+	WriteSenderReport(ntp time.Time, rtpTime uint32)
+}
+
+// ntpTime converts a 64 bit NTP timestamp to a time.
+func ntpTime(t uint64) time.Time {
+	// NTP counts from 1900, unix time from 1970.
+	const offset = 2208988800
+	seconds, fraction := int64(t>>32)-offset, int64(t&0xffffffff)
+	return time.Unix(seconds, fraction*int64(time.Second)>>32)
+}
+
+// toNTPTime converts a time to a 64 bit NTP timestamp, for sources that generate their own sender
+// reports.
+func toNTPTime(t time.Time) uint64 {
+	const offset = 2208988800
+	seconds, fraction := uint64(t.Unix()+offset), uint64(t.Nanosecond())<<32/uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+// senderReport forwards a sender report of the track to the sinks that synchronize tracks.
+func (s *Source) senderReport(sr *rtcp.SenderReport) {
+	s.sinksMu.Lock()
+	defer s.sinksMu.Unlock()
+	s.report = sr
+	for _, sink := range s.sinks {
+		if w, ok := sink.(senderReportWriter); ok {
+			w.WriteSenderReport(ntpTime(sr.NTPTime), sr.RTPTime)
+		}
+	}
+}
+
+func (s *Source) addSink(sink rtpio.RTPWriteCloser) {
+	s.sinksMu.Lock()
+	defer s.sinksMu.Unlock()
+	select {
+	case <-s.done:
+		// the track has already ended.
+		sink.Close()
+	default:
+		s.sinks = append(s.sinks, sink)
+		if w, ok := sink.(senderReportWriter); ok && s.report != nil {
+			w.WriteSenderReport(ntpTime(s.report.NTPTime), s.report.RTPTime)
+		}
+	}
+}
+
+// removeSink detaches a sink and closes it.
+func (s *Source) removeSink(sink rtpio.RTPWriteCloser) {
+	s.sinksMu.Lock()
+	for i, x := range s.sinks {
+		if x == sink {
+			s.sinks = append(s.sinks[:i], s.sinks[i+1:]...)
+			break
+		}
+	}
+	s.sinksMu.Unlock()
+	if err := sink.Close(); err != nil {
+		zap.L().Error("failed to close sink", zap.Error(err))
+	}
+}
+
+// output returns the output for the given codec and encoder configurations, creating it if no other
+// subscriber has requested it yet. If configs is nil, a single rendition with config is encoded,
+// otherwise one rendition per simulcast layer. Every call must be paired with a call to release.
+func (s *Source) output(codec webrtc.RTPCodecCapability, config av.EncoderConfiguration, configs []av.EncoderConfiguration, rids []string) (*output, error) {
+	key := fmt.Sprintf("%s %+v %+v %q", codec.MimeType, config, configs, rids)
+
+	s.outputsMu.Lock()
+	defer s.outputsMu.Unlock()
+
+	if o, ok := s.outputs[key]; ok {
+		o.subscribers++
+		return o, nil
+	}
+
+	decoder := s.sharedDecoder()
+	o := &output{source: s, key: key, subscribers: 1}
+	if configs == nil {
+		tc, err := decoder.NewTranscoder(codec, config)
+		if err != nil {
+			s.releaseDecoder()
+			return nil, err
+		}
+		o.transcoder = tc
+		o.tracks = make([][]rtpio.RTPWriter, 1)
+		o.forceKeyframe = func(int) { tc.ForceKeyframe() }
+		if s.Track.Kind() == webrtc.RTPCodecTypeVideo {
+			o.bitrate = newBitrateController(tc, config)
+		}
+		go o.copy(0, tc)
+	} else {
+		tc, err := decoder.NewSimulcastTranscoder(codec, configs)
+		if err != nil {
+			s.releaseDecoder()
+			return nil, err
+		}
+		o.transcoder = tc
+		o.tracks = make([][]rtpio.RTPWriter, len(configs))
+		o.forceKeyframe = tc.ForceKeyframe
+		for i, layer := range tc.Layers {
+			go o.copy(i, layer)
+		}
+	}
+
+	if s.outputs == nil {
+		s.outputs = make(map[string]*output)
+	}
+	s.outputs[key] = o
+	return o, nil
+}
+
+// release removes a subscriber's tracks from an output. When an output has no subscribers left its
+// transcoder is closed, and when nothing else reads from the decoder it's closed too.
+func (s *Source) release(o *output, tracks []rtpio.RTPWriter) {
+	o.mu.Lock()
+	for layer := range o.tracks {
+		for _, track := range tracks {
+			for i, x := range o.tracks[layer] {
+				if x == track {
+					o.tracks[layer] = append(o.tracks[layer][:i], o.tracks[layer][i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	o.mu.Unlock()
+
+	s.outputsMu.Lock()
+	defer s.outputsMu.Unlock()
+
+	o.subscribers--
+	if o.subscribers > 0 {
+		return
+	}
+	delete(s.outputs, o.key)
+	if err := o.transcoder.Close(); err != nil {
+		zap.L().Error("failed to close transcoder", zap.Error(err))
+	}
+	s.releaseDecoder()
+}
+
+// sharedDecoder returns the decoder of the track, creating it if nothing reads from it yet. Every call
+// must be paired with a call to releaseDecoder, outputsMu must be held.
+func (s *Source) sharedDecoder() *av.SharedDecoder {
+	if s.decoder == nil {
+		s.decoder = av.NewSharedDecoder(s.Track.Codec())
+		s.decoder.OnKeyframeRequest(s.requestKeyframe)
+		s.addSink(s.decoder)
+	}
+	s.decoderUsers++
+	return s.decoder
+}
+
+// releaseDecoder closes the decoder once nothing reads from it, outputsMu must be held.
+func (s *Source) releaseDecoder() {
+	s.decoderUsers--
+	if s.decoderUsers == 0 && s.decoder != nil {
+		s.removeSink(s.decoder)
+		s.decoder = nil
+	}
+}
+
+// addTrack adds a subscriber track to a layer of the output.
+func (o *output) addTrack(layer int, track rtpio.RTPWriter) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.tracks[layer] = append(o.tracks[layer], track)
+}
+
+// copy writes the packets of a layer to every subscriber track until the transcoder is closed.
+func (o *output) copy(layer int, r rtpio.RTPReader) {
+	for {
+		p, err := r.ReadRTP()
+		if err != nil {
+			if err != io.EOF {
+				zap.L().Error("failed to read transcoded rtp packet", zap.Error(err))
+			}
+			return
+		}
+		o.source.tap(p, api.TapDirection_OUTPUT)
+		o.mu.Lock()
+		for _, track := range o.tracks[layer] {
+			if err := track.WriteRTP(p); err != nil {
+				zap.L().Error("failed to write rtp packet", zap.Error(err))
+			}
+		}
+		o.mu.Unlock()
+	}
+}
@@ -0,0 +1,125 @@
+package transcoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/muxable/transcoder/api"
+	"github.com/muxable/transcoder/pkg/av"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SRTOptions configures an SRT connection, the zero value uses the SRT defaults without encryption.
+type SRTOptions struct {
+	// Latency is the receiver's buffering latency, larger values recover more losses.
+	Latency time.Duration
+	// Passphrase encrypts the stream, it must be 10 to 79 characters long and match the peer's.
+	Passphrase string
+	// StreamID identifies the stream to the listener.
+	StreamID string
+}
+
+// url returns the libsrt url of a connection to or on address.
+func (o SRTOptions) url(address, mode string) string {
+	query := url.Values{}
+	query.Set("mode", mode)
+	if o.Latency > 0 {
+		// libsrt takes the latency in microseconds.
+		query.Set("latency", fmt.Sprint(o.Latency.Microseconds()))
+	}
+	if o.Passphrase != "" {
+		query.Set("passphrase", o.Passphrase)
+	}
+	if o.StreamID != "" {
+		query.Set("streamid", o.StreamID)
+	}
+	return fmt.Sprintf("srt://%s?%s", address, query.Encode())
+}
+
+func (o SRTOptions) validate() error {
+	if n := len(o.Passphrase); n > 0 && (n < 10 || n > 79) {
+		return errors.New("srt passphrase must be 10 to 79 characters long")
+	}
+	return nil
+}
+
+// SRTIngest is an MPEG-TS input received over SRT.
+type SRTIngest struct {
+	// Address is the address to listen on or to call, as host:port.
+	Address string
+	// Listen waits for a sender to connect to Address instead of calling it.
+	Listen bool
+	SRTOptions
+}
+
+// IngestSRT publishes the audio and video of an MPEG-TS stream received over SRT until the context is
+// done, reconnecting whenever the stream ends. The tracks are published with Options.StreamID as their
+// stream id and named video and audio, so they can be subscribed to like any other track.
+func (s *TranscoderServer) IngestSRT(ctx context.Context, ingest SRTIngest) error {
+	if _, _, err := net.SplitHostPort(ingest.Address); err != nil {
+		return err
+	}
+	if err := ingest.validate(); err != nil {
+		return err
+	}
+	mode := "caller"
+	if ingest.Listen {
+		mode = "listener"
+	}
+	return s.ingestLoop(ctx, ingestInput{
+		url:      ingest.url(ingest.Address, mode),
+		format:   "mpegts",
+		streamID: ingest.StreamID,
+	})
+}
+
+// WithSRTPush enables the PushSRT rpc. It should only be enabled for trusted clients as it connects to
+// arbitrary addresses from the server.
+func WithSRTPush() ServerOption {
+	return func(s *TranscoderServer) {
+		s.srtPush = true
+	}
+}
+
+func (s *TranscoderServer) PushSRT(ctx context.Context, request *api.PushSRTRequest) (*api.PushSRTResponse, error) {
+	if !s.srtPush {
+		return nil, status.Error(codes.PermissionDenied, "srt push is not enabled")
+	}
+	if len(request.Tracks) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing tracks")
+	}
+	for _, track := range request.Tracks {
+		if err := validateRecordTrack(track); err != nil {
+			return nil, err
+		}
+	}
+	if _, _, err := net.SplitHostPort(request.Address); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid address: %v", err)
+	}
+	options := SRTOptions{
+		Latency:    time.Duration(request.Options.GetLatencyMs()) * time.Millisecond,
+		Passphrase: request.Options.GetPassphrase(),
+		StreamID:   request.Options.GetStreamId(),
+	}
+	if err := options.validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	sources, tracks, err := s.recorderTracks(ctx, request.Tracks)
+	if err != nil {
+		return nil, err
+	}
+	output := av.NewStreamOutput(options.url(request.Address, "caller"), "mpegts", tracks...)
+	if err := runRecorder(ctx, output, sources); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "srt push failed: %v", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return &api.PushSRTResponse{}, nil
+}
@@ -0,0 +1,150 @@
+package transcoder
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/muxable/transcoder/api"
+	"github.com/muxable/transcoder/pkg/av"
+	"github.com/pion/webrtc/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSRTOptionsURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		options SRTOptions
+		mode    string
+		want    string
+	}{
+		{name: "defaults", mode: "caller", want: "srt://127.0.0.1:9000?mode=caller"},
+		{
+			// libsrt takes the latency in microseconds.
+			name:    "latency",
+			options: SRTOptions{Latency: 120 * time.Millisecond},
+			mode:    "listener",
+			want:    "srt://127.0.0.1:9000?latency=120000&mode=listener",
+		},
+		{
+			name:    "passphrase",
+			options: SRTOptions{Passphrase: "pass word&x=1"},
+			mode:    "caller",
+			want:    "srt://127.0.0.1:9000?mode=caller&passphrase=pass+word%26x%3D1",
+		},
+		{
+			name:    "stream id",
+			options: SRTOptions{StreamID: "#!::r=live/cam,m=publish"},
+			mode:    "caller",
+			want:    "srt://127.0.0.1:9000?mode=caller&streamid=%23%21%3A%3Ar%3Dlive%2Fcam%2Cm%3Dpublish",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.options.url("127.0.0.1:9000", tt.mode); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSRTOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		passphrase string
+		wantErr    bool
+	}{
+		{name: "no passphrase"},
+		{name: "short passphrase", passphrase: "012345678", wantErr: true},
+		{name: "shortest passphrase", passphrase: "0123456789"},
+		{name: "longest passphrase", passphrase: string(make([]byte, 79))},
+		{name: "long passphrase", passphrase: string(make([]byte, 80)), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SRTOptions{Passphrase: tt.passphrase}.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// freeUDPAddress returns a loopback address that nothing listens on.
+func freeUDPAddress(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().String()
+}
+
+func TestSRTLoopback(t *testing.T) {
+	if !av.ProtocolSupported("srt") {
+		t.Skip("ffmpeg is built without libsrt")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	// the receiver listens, the sender calls it and pushes a track transcoded to H.264.
+	address := freeUDPAddress(t)
+	receiver := NewTranscoderServer(webrtc.Configuration{})
+	ingested := make(chan error, 1)
+	go func() {
+		ingested <- receiver.IngestSRT(ctx, SRTIngest{
+			Address:    address,
+			Listen:     true,
+			SRTOptions: SRTOptions{Passphrase: "0123456789", StreamID: "srt"},
+		})
+	}()
+
+	sender := NewTranscoderServer(webrtc.Configuration{}, WithSRTPush())
+	sender.addSource(newSource(newFileTrack(t, "file"), nil))
+	pushed := make(chan struct{})
+	go func() {
+		defer close(pushed)
+		for {
+			_, err := sender.PushSRT(ctx, &api.PushSRTRequest{
+				Tracks:  []*api.TranscodeRequest{{StreamId: "file", TrackId: "video", MimeType: webrtc.MimeTypeH264}},
+				Address: address,
+				Options: &api.SRTOptions{Passphrase: "0123456789", StreamId: "srt"},
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			// the call fails until the receiver listens.
+			if status.Code(err) != codes.Unavailable {
+				if err != nil {
+					t.Errorf("failed to push: %v", err)
+				}
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+
+	source, err := receiver.waitForSource(ctx, &api.TranscodeRequest{StreamId: "srt", TrackId: "video"})
+	if err != nil {
+		t.Fatalf("failed to receive the track: %v", err)
+	}
+	if codec := source.Track.Codec(); codec.MimeType != webrtc.MimeTypeH264 {
+		t.Errorf("got %s, want %s", codec.MimeType, webrtc.MimeTypeH264)
+	}
+	sink := newTestSink()
+	source.addSink(sink)
+	select {
+	case <-sink.packets:
+	case <-ctx.Done():
+		t.Fatal("expected the track to receive packets")
+	}
+
+	cancel()
+	if err := <-ingested; err != context.Canceled {
+		t.Errorf("expected the ingest to be canceled, got %v", err)
+	}
+	<-pushed
+}
@@ -0,0 +1,178 @@
+package transcoder
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/muxable/transcoder/api"
+	"github.com/pion/rtp"
+	"github.com/pion/rtpio/pkg/rtpio"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Tap mirrors the rtp packets of the tracks it matches to a writer, for example to inspect them with
+// Wireshark or ffplay.
+type Tap struct {
+	// StreamID, TrackID and RID select the tracks to mirror, empty values match any track.
+	StreamID, TrackID, RID string
+	// Direction selects whether the published packets, the transcoded packets or both are mirrored.
+	Direction api.TapDirection
+	// Writer receives the packets of every matching track.
+	Writer rtpio.RTPWriter
+
+	mu sync.Mutex
+}
+
+func (t *Tap) matches(tr Track) bool {
+	return (t.StreamID == "" || t.StreamID == tr.StreamID()) &&
+		(t.TrackID == "" || t.TrackID == tr.ID()) &&
+		(t.RID == "" || t.RID == tr.RID())
+}
+
+// write mirrors a packet if the tap includes the direction.
+func (t *Tap) write(p *rtp.Packet, direction api.TapDirection) {
+	if t.Direction != api.TapDirection_BOTH && t.Direction != direction {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.Writer.WriteRTP(p); err != nil {
+		zap.L().Debug("failed to write tapped rtp packet", zap.Error(err))
+	}
+}
+
+type udpTap struct {
+	rtpio.RTPWriter
+	net.Conn
+}
+
+// NewUDPTapWriter creates a writer that sends each rtp packet as a datagram to address.
+func NewUDPTapWriter(address string) (rtpio.RTPWriteCloser, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &udpTap{RTPWriter: rtpio.NewRTPWriter(conn), Conn: conn}, nil
+}
+
+// AddTap starts mirroring the packets of the matching tracks, including tracks that are published later.
+func (s *TranscoderServer) AddTap(tap *Tap) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.taps = append(s.taps, tap)
+	for _, source := range s.sources {
+		if tap.matches(source.Track) {
+			source.addTap(tap)
+		}
+	}
+}
+
+// RemoveTap stops mirroring packets to the tap. The tap's writer isn't closed.
+func (s *TranscoderServer) RemoveTap(tap *Tap) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.taps {
+		if t == tap {
+			s.taps = append(s.taps[:i], s.taps[i+1:]...)
+			break
+		}
+	}
+	for _, source := range s.sources {
+		source.removeTap(tap)
+	}
+}
+
+// tapQueueSize is the number of packets a Tap rpc buffers for a slow client before dropping them.
+const tapQueueSize = 256
+
+var errTapQueueFull = errors.New("tap queue is full")
+
+// tapStream queues tapped packets to be sent back to the caller of the Tap rpc. Packets are written
+// while the track is forwarded, so they're dropped instead of waiting for the client.
+type tapStream struct {
+	packets   chan<- *api.TapPacket
+	direction api.TapDirection
+}
+
+func (w *tapStream) WriteRTP(p *rtp.Packet) error {
+	buf, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	select {
+	case w.packets <- &api.TapPacket{Rtp: buf, Direction: w.direction}:
+		return nil
+	default:
+		return errTapQueueFull
+	}
+}
+
+func (s *TranscoderServer) Tap(request *api.TapRequest, stream api.Transcoder_TapServer) error {
+	if !s.tapRPC {
+		return status.Error(codes.PermissionDenied, "the tap rpc is not enabled")
+	}
+
+	tap := func(direction api.TapDirection, w rtpio.RTPWriter) *Tap {
+		return &Tap{
+			StreamID:  request.StreamId,
+			TrackID:   request.TrackId,
+			RID:       request.RtpStreamId,
+			Direction: direction,
+			Writer:    w,
+		}
+	}
+
+	var taps []*Tap
+	var packets chan *api.TapPacket
+	switch destination := request.Destination.(type) {
+	case *api.TapRequest_UdpAddress:
+		w, err := NewUDPTapWriter(destination.UdpAddress)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid udp address: %v", err)
+		}
+		defer w.Close()
+		taps = append(taps, tap(request.Direction, w))
+	case *api.TapRequest_PcapPath:
+		if s.tapDir == "" {
+			return status.Error(codes.PermissionDenied, "pcap files are not enabled")
+		}
+		path, err := confinedPath(s.tapDir, destination.PcapPath)
+		if err != nil {
+			return err
+		}
+		w, err := CreatePCAPFile(path)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "failed to create pcap file: %v", err)
+		}
+		defer w.Close()
+		taps = append(taps, tap(request.Direction, w))
+	default:
+		// tag the packets with their direction.
+		packets = make(chan *api.TapPacket, tapQueueSize)
+		for _, direction := range []api.TapDirection{api.TapDirection_INPUT, api.TapDirection_OUTPUT} {
+			if request.Direction == api.TapDirection_BOTH || request.Direction == direction {
+				taps = append(taps, tap(direction, &tapStream{packets: packets, direction: direction}))
+			}
+		}
+	}
+
+	for _, t := range taps {
+		s.AddTap(t)
+		defer s.RemoveTap(t)
+	}
+
+	// packets is nil for the other destinations, so this only waits for the call to end.
+	for {
+		select {
+		case p := <-packets:
+			if err := stream.Send(p); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
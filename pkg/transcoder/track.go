@@ -0,0 +1,45 @@
+package transcoder
+
+import (
+	"sync/atomic"
+
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// ridTrack is a TrackLocalStaticRTP that tags each packet with the rtp-stream-id header extension so
+// the receiver can tell the simulcast layers apart.
+type ridTrack struct {
+	*webrtc.TrackLocalStaticRTP
+
+	extensionID uint32
+}
+
+func newRIDTrack(codec webrtc.RTPCodecCapability, id, streamID, rid string) (*ridTrack, error) {
+	tl, err := webrtc.NewTrackLocalStaticRTP(codec, id, streamID, webrtc.WithRTPStreamID(rid))
+	if err != nil {
+		return nil, err
+	}
+	return &ridTrack{TrackLocalStaticRTP: tl}, nil
+}
+
+func (t *ridTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	for _, ext := range ctx.HeaderExtensions() {
+		if ext.URI == sdp.SDESRTPStreamIDURI {
+			atomic.StoreUint32(&t.extensionID, uint32(ext.ID))
+		}
+	}
+	return t.TrackLocalStaticRTP.Bind(ctx)
+}
+
+func (t *ridTrack) WriteRTP(p *rtp.Packet) error {
+	if id := atomic.LoadUint32(&t.extensionID); id != 0 {
+		// the packet is shared with the other subscribers of the layer, so don't modify it.
+		p = &rtp.Packet{Header: p.Header.Clone(), Payload: p.Payload}
+		if err := p.SetExtension(uint8(id), []byte(t.RID())); err != nil {
+			return err
+		}
+	}
+	return t.TrackLocalStaticRTP.WriteRTP(p)
+}
@@ -0,0 +1,179 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/muxable/transcoder/api"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// whepSourceTimeout is how long a WHEP request waits for the requested track to be published.
+const whepSourceTimeout = 10 * time.Second
+
+// WHEPConfiguration configures the WHEP endpoint, which subscribes to a transcoded track with a single
+// HTTP request instead of the Subscribe rpc, for example from a browser.
+type WHEPConfiguration struct {
+	// Token is the bearer token subscribers must send, subscribing is open to anyone if it's empty.
+	Token string
+}
+
+// WithWHEP serves the WHEP endpoint from the server's Handler.
+func WithWHEP(config WHEPConfiguration) ServerOption {
+	return func(s *TranscoderServer) {
+		s.whep = &config
+	}
+}
+
+// parseTranscodeRequest reads a TranscodeRequest from url parameters named like its fields, for example
+// ?stream_id=stream&track_id=video&mime_type=video/VP8&bitrate=500000. Simulcast layers aren't
+// supported.
+func parseTranscodeRequest(query url.Values) (*api.TranscodeRequest, error) {
+	request := &api.TranscodeRequest{
+		StreamId:    query.Get("stream_id"),
+		TrackId:     query.Get("track_id"),
+		RtpStreamId: query.Get("rtp_stream_id"),
+		MimeType:    query.Get("mime_type"),
+		Profile:     query.Get("profile"),
+	}
+	for key, field := range map[string]*uint32{
+		"bitrate":           &request.Bitrate,
+		"max_bitrate":       &request.MaxBitrate,
+		"width":             &request.Width,
+		"height":            &request.Height,
+		"keyframe_interval": &request.KeyframeInterval,
+	} {
+		if value := query.Get(key); value != "" {
+			n, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s", key)
+			}
+			*field = uint32(n)
+		}
+	}
+	if value := query.Get("framerate"); value != "" {
+		framerate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid framerate")
+		}
+		request.Framerate = framerate
+	}
+	if value := query.Get("scale_mode"); value != "" {
+		mode, ok := api.ScaleMode_value[value]
+		if !ok {
+			return nil, fmt.Errorf("invalid scale_mode")
+		}
+		request.ScaleMode = api.ScaleMode(mode)
+	}
+	return request, nil
+}
+
+// serveWHEP subscribes to a track with a POST request to /whep carrying an sdp offer, the track and the
+// encoder parameters are set by url parameters. The Location header of the answer is the url of the
+// session, a DELETE request to it ends the session.
+func (s *TranscoderServer) serveWHEP(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r, "POST, DELETE, OPTIONS") {
+		return
+	}
+	if !authorized(r, s.whep.Token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	// the session ids are hex, they don't need to be unescaped.
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/whep"), "/")
+	if strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		s.whepSubscribe(w, r)
+	case r.Method == http.MethodDelete && id != "":
+		if err := s.closeSession(sessionKey{endpoint: "whep", id: id}); err != nil {
+			http.NotFound(w, r)
+		}
+	case r.Method == http.MethodPatch && id != "":
+		// the answer has every candidate, trickle ICE and ICE restarts aren't supported.
+		http.Error(w, "trickle ice is not supported", http.StatusMethodNotAllowed)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *TranscoderServer) whepSubscribe(w http.ResponseWriter, r *http.Request) {
+	request, err := parseTranscodeRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offer, ok := readOffer(w, r)
+	if !ok {
+		return
+	}
+
+	if !acquire(&s.subscribers, s.maxSubscribers) {
+		http.Error(w, "too many subscribers", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), whepSourceTimeout)
+	defer cancel()
+	sub, err := s.newSubscriber(ctx, request)
+	if err != nil {
+		atomic.AddInt64(&s.subscribers, -1)
+		httpError(w, err)
+		return
+	}
+	// the resource url doesn't have a stream, the stream is set by the url parameters.
+	key, err := s.addSession("whep", "", sub.PeerConnection)
+	if err != nil {
+		atomic.AddInt64(&s.subscribers, -1)
+		sub.Close()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the session ends when the peer connection is closed or the publisher leaves.
+	closed := make(chan struct{})
+	var once sync.Once
+	closeSession := func() {
+		once.Do(func() {
+			close(closed)
+			s.removeSession(key)
+			sub.Close()
+			atomic.AddInt64(&s.subscribers, -1)
+		})
+	}
+	sub.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			// closing the session closes the peer connection, which calls this again.
+			go closeSession()
+		}
+	})
+	go func() {
+		select {
+		case <-sub.source.done:
+			closeSession()
+		case <-closed:
+		}
+	}()
+
+	desc, err := answer(r.Context(), sub.PeerConnection, offer)
+	if err != nil {
+		zap.L().Error("failed to answer whep offer", zap.Error(err))
+		closeSession()
+		http.Error(w, "failed to answer offer", http.StatusBadRequest)
+		return
+	}
+
+	writeAnswer(w, "/whep/"+key.id, desc)
+}
@@ -0,0 +1,167 @@
+package transcoder
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// WHIPConfiguration configures the WHIP endpoint, which publishes tracks with a single HTTP request
+// instead of the Publish rpc, for example from OBS or a browser.
+type WHIPConfiguration struct {
+	// Token is the bearer token publishers must send, publishing is open to anyone if it's empty.
+	Token string
+}
+
+// WithWHIP serves the WHIP endpoint from the server's Handler.
+func WithWHIP(config WHIPConfiguration) ServerOption {
+	return func(s *TranscoderServer) {
+		s.whip = &config
+	}
+}
+
+// setStreamID assigns the tracks of an offer to a stream so subscribers can find them by the stream id
+// in the url. The track ids of the offer are kept, tracks without one are named after their kind.
+func setStreamID(offer, streamID string) (string, error) {
+	desc := &sdp.SessionDescription{}
+	if err := desc.Unmarshal([]byte(offer)); err != nil {
+		return "", err
+	}
+	used := make(map[string]bool)
+	for _, md := range desc.MediaDescriptions {
+		kind := md.MediaName.Media
+		if kind != "audio" && kind != "video" {
+			continue
+		}
+		// the stream is set by msid attributes, either for the media or for each ssrc.
+		var trackID string
+		var attrs []sdp.Attribute
+		for _, attr := range md.Attributes {
+			fields := strings.Fields(attr.Value)
+			if attr.Key == sdp.AttrKeyMsid {
+				if len(fields) == 2 && trackID == "" {
+					trackID = fields[1]
+				}
+				continue
+			}
+			if attr.Key == sdp.AttrKeySSRC && len(fields) == 3 && strings.HasPrefix(fields[1], "msid:") {
+				if trackID == "" {
+					trackID = fields[2]
+				}
+				continue
+			}
+			attrs = append(attrs, attr)
+		}
+		if trackID == "" || used[trackID] {
+			trackID = kind
+			if mid, ok := md.Attribute(sdp.AttrKeyMID); ok && used[trackID] {
+				trackID += "-" + mid
+			}
+		}
+		used[trackID] = true
+		// the msid must come before the ssrcs, the tracks are created when their ssrc is parsed.
+		md.Attributes = append([]sdp.Attribute{sdp.NewAttribute(sdp.AttrKeyMsid, streamID+" "+trackID)}, attrs...)
+	}
+	buf, err := desc.Marshal()
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// serveWHIP publishes a stream with a POST request to /whip/{stream} carrying an sdp offer. The Location
+// header of the answer is the url of the session, a DELETE request to it ends the session.
+func (s *TranscoderServer) serveWHIP(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r, "POST, DELETE, OPTIONS") {
+		return
+	}
+	if !authorized(r, s.whip.Token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	elems, err := pathElems(r, "/whip/")
+	if err != nil || elems[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && len(elems) == 1:
+		s.whipPublish(w, r, elems[0])
+	case r.Method == http.MethodDelete && len(elems) == 2:
+		if err := s.closeSession(sessionKey{endpoint: "whip", streamID: elems[0], id: elems[1]}); err != nil {
+			http.NotFound(w, r)
+		}
+	case r.Method == http.MethodPatch && len(elems) == 2:
+		// the answer has every candidate, trickle ICE and ICE restarts aren't supported.
+		http.Error(w, "trickle ice is not supported", http.StatusMethodNotAllowed)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *TranscoderServer) whipPublish(w http.ResponseWriter, r *http.Request, streamID string) {
+	if strings.ContainsAny(streamID, " \t\r\n") {
+		http.Error(w, "invalid stream id", http.StatusBadRequest)
+		return
+	}
+	offer, ok := readOffer(w, r)
+	if !ok {
+		return
+	}
+	offer, err := setStreamID(offer, streamID)
+	if err != nil {
+		http.Error(w, "invalid offer", http.StatusBadRequest)
+		return
+	}
+
+	if !acquire(&s.publishers, s.maxPublishers) {
+		http.Error(w, "too many publishers", http.StatusServiceUnavailable)
+		return
+	}
+	var once sync.Once
+	release := func() { once.Do(func() { atomic.AddInt64(&s.publishers, -1) }) }
+
+	peerConnection, err := s.newPublisher()
+	if err != nil {
+		release()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key, err := s.addSession("whip", streamID, peerConnection)
+	if err != nil {
+		release()
+		peerConnection.Close()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// closing the peer connection ends its tracks, which removes their sources.
+	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		switch state {
+		case webrtc.PeerConnectionStateFailed:
+			peerConnection.Close()
+		case webrtc.PeerConnectionStateClosed:
+			s.removeSession(key)
+			release()
+		}
+	})
+
+	desc, err := answer(r.Context(), peerConnection, offer)
+	if err != nil {
+		zap.L().Error("failed to answer whip offer", zap.Error(err))
+		s.removeSession(key)
+		release()
+		peerConnection.Close()
+		http.Error(w, "failed to answer offer", http.StatusBadRequest)
+		return
+	}
+
+	writeAnswer(w, "/whip/"+url.PathEscape(streamID)+"/"+key.id, desc)
+}